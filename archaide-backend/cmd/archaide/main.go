@@ -2,13 +2,48 @@ package main
 
 import (
 	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Driemtax/Archaide/internal/config"
 
 	"github.com/Driemtax/Archaide/internal/server"
 )
 
-var addr = flag.String("addr", ":3030", "http service address")
-
 func main() {
+	cfg := server.DefaultConfig()
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "http service address")
+	flag.StringVar(&cfg.TLSCertFile, "tls-cert", "", "certificate file, serves HTTPS/WSS together with -tls-key")
+	flag.StringVar(&cfg.TLSKeyFile, "tls-key", "", "private key file of the -tls-cert certificate")
+	flag.BoolVar(&cfg.Compression.Enabled, "compress", cfg.Compression.Enabled, "compress websocket frames with permessage-deflate")
+	flag.IntVar(&cfg.Compression.MinBytes, "compress-min-bytes", cfg.Compression.MinBytes, "only compress messages of at least this size")
+	flag.IntVar(&cfg.Hub.MaxConsecutiveDrops, "max-dropped-messages", cfg.Hub.MaxConsecutiveDrops, "disconnect clients after this many dropped messages in a row")
+	flag.IntVar(&cfg.Hub.MaxParseFailures, "max-invalid-messages", cfg.Hub.MaxParseFailures, "disconnect clients after this many invalid messages in a row, 0 for no limit")
+	flag.IntVar(&cfg.Hub.MaxMessagesPerSecond, "max-messages-per-second", cfg.Hub.MaxMessagesPerSecond, "drop messages of clients that send more than this per second, 0 for no limit")
+	flag.IntVar(&cfg.Hub.MaxActiveGames, "max-games", cfg.Hub.MaxActiveGames, "games running at the same time before new ones wait, 0 for no limit")
+	flag.IntVar(&cfg.Hub.ScoreTierSize, "score-tier-size", cfg.Hub.ScoreTierSize, "points per matchmaking tier, 0 puts all voters into one game")
+	flag.DurationVar(&cfg.Hub.LobbySnapshotInterval, "lobby-snapshot-interval", cfg.Hub.LobbySnapshotInterval, "how often every client gets the full lobby again, 0 only sends updates on events")
+	flag.StringVar(&cfg.Hub.CaptureDir, "capture-dir", "", "directory for the state captures of single games, empty for the temp directory")
+	flag.StringVar(&cfg.AdminToken, "admin-token", os.Getenv("ARCHAIDE_ADMIN_TOKEN"), "bearer token for the /admin endpoints and /debug/vars, empty turns them off (default $ARCHAIDE_ADMIN_TOKEN)")
+	games := flag.String("games", "", "comma separated games players can choose from, e.g. \"Pong\", empty for all")
+	flag.IntVar(&cfg.SendBufferSize, "send-buffer", cfg.SendBufferSize, "messages buffered per client before they get dropped")
+	flag.DurationVar(&cfg.DrainPeriod, "drain-period", cfg.DrainPeriod, "how long /readyz reports 503 before the server shuts down")
+	configPath := flag.String("config", "", "JSON file with the game tunables, see internal/config")
 	flag.Parse()
-	server.Run(addr)
+	if *games != "" {
+		for _, name := range strings.Split(*games, ",") {
+			cfg.Hub.AvailableGames = append(cfg.Hub.AvailableGames, strings.TrimSpace(name))
+		}
+	}
+
+	if *configPath != "" {
+		games, err := config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Could not load the game config: %v", err)
+		}
+		cfg.Hub.Games = games
+		log.Printf("Loaded game config from %s", *configPath)
+	}
+	server.Run(cfg)
 }
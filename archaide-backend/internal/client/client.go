@@ -0,0 +1,123 @@
+// Package client is a small WebSocket client for the game server.
+// Integration tests and bots use it to drive the server like a browser would.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/gorilla/websocket"
+)
+
+// Returned by Next and WaitFor once the connection is gone
+var ErrClosed = errors.New("connection closed")
+
+// Returned by WaitFor if the message did not arrive in time
+var ErrTimeout = errors.New("timed out waiting for message")
+
+type Client struct {
+	conn     *websocket.Conn
+	messages chan message.Message
+	err      error // Why the read loop stopped, only read after messages is closed
+}
+
+// Connect dials the WebSocket endpoint of the server, e.g.
+// "ws://localhost:3030/ws", and says hello with message.ProtocolVersion
+func Connect(url string) (*Client, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %w", url, err)
+	}
+	c := &Client{
+		conn: conn,
+		// The server sends a state frame every tick, so keep a few around
+		// until the test gets to read them
+		messages: make(chan message.Message, 256),
+	}
+	go c.readLoop()
+	if err := c.Send(message.Hello, message.HelloPayload{ProtocolVersion: message.ProtocolVersion}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending hello: %w", err)
+	}
+	return c, nil
+}
+
+// Decodes all incoming frames into the messages channel until the connection closes
+func (c *Client) readLoop() {
+	defer close(c.messages)
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.err = err
+			return
+		}
+		var msg message.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.err = fmt.Errorf("decoding message: %w", err)
+			return
+		}
+		c.messages <- msg
+	}
+}
+
+// Send marshals the payload and sends it as a message of the given type
+func (c *Client) Send(msgType message.MessageType, payload any) error {
+	return c.Request(msgType, payload, "")
+}
+
+// Request is Send with a request ID, the direct response of the server carries the same ID
+func (c *Client) Request(msgType message.MessageType, payload any, id string) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshalling %s payload: %w", msgType, err)
+	}
+	return c.conn.WriteJSON(message.Message{Type: msgType, Payload: payloadBytes, ID: id})
+}
+
+// Messages returns the channel with all received messages.
+// It is closed when the connection closes.
+func (c *Client) Messages() <-chan message.Message {
+	return c.messages
+}
+
+// Next blocks until the next message arrives
+func (c *Client) Next() (message.Message, error) {
+	msg, ok := <-c.messages
+	if !ok {
+		return message.Message{}, c.closedErr()
+	}
+	return msg, nil
+}
+
+// WaitFor skips all other messages until one of the given type arrives
+func (c *Client) WaitFor(msgType message.MessageType, timeout time.Duration) (message.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg, ok := <-c.messages:
+			if !ok {
+				return message.Message{}, c.closedErr()
+			}
+			if msg.Type == msgType {
+				return msg, nil
+			}
+		case <-deadline:
+			return message.Message{}, fmt.Errorf("%w %s", ErrTimeout, msgType)
+		}
+	}
+}
+
+func (c *Client) closedErr() error {
+	if c.err != nil {
+		return fmt.Errorf("%w: %v", ErrClosed, c.err)
+	}
+	return ErrClosed
+}
+
+// Close closes the connection, the server unregisters the client
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
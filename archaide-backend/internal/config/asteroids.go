@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game/asteroids"
+)
+
+// The layout of the asteroids section in the config file
+type asteroidsFile struct {
+	TickRate     Duration `json:"tickRate"`
+	MaxTickDelta float64  `json:"maxTickDelta"`
+	MaxDuration  Duration `json:"maxDuration"`
+	WorldWidth   float64  `json:"worldWidth"`
+	WorldHeight  float64  `json:"worldHeight"`
+	MinPlayers   int      `json:"minPlayers"`
+
+	ReconnectGrace Duration `json:"reconnectGrace"`
+
+	MaxAsteroids       int     `json:"maxAsteroids"`
+	SplitCount         int     `json:"splitCount"`
+	SplitAngleVariance float64 `json:"splitAngleVariance"`
+
+	PlayerSpeed        float64  `json:"playerSpeed"`
+	Thrust             float64  `json:"thrust"`
+	Drag               float64  `json:"drag"`
+	PlayerHealth       float64  `json:"playerHealth"`
+	ShootCooldown      Duration `json:"shootCooldown"`
+	ProjectileSpeed    float64  `json:"projectileSpeed"`
+	ProjectileLifetime Duration `json:"projectileLifetime"`
+
+	PointsLarge  int `json:"pointsLarge"`
+	PointsMiddle int `json:"pointsMiddle"`
+	PointsSmall  int `json:"pointsSmall"`
+	PointsUFO    int `json:"pointsUfo"`
+
+	HealthLarge  float64 `json:"healthLarge"`
+	HealthMiddle float64 `json:"healthMiddle"`
+	HealthSmall  float64 `json:"healthSmall"`
+
+	DifficultyRampPerMinute float64 `json:"difficultyRampPerMinute"`
+	DifficultyMaxMultiplier float64 `json:"difficultyMaxMultiplier"`
+
+	PowerupSpawnChancePerSecond float64 `json:"powerupSpawnChancePerSecond"`
+	MaxPowerups                 int     `json:"maxPowerups"`
+
+	UFOSpawnInterval Duration `json:"ufoSpawnInterval"`
+	UFOShootCooldown Duration `json:"ufoShootCooldown"`
+
+	Hitboxes struct {
+		Player     float64 `json:"player"`
+		Asteroid   float64 `json:"asteroid"`
+		Projectile float64 `json:"projectile"`
+		Powerup    float64 `json:"powerup"`
+		UFO        float64 `json:"ufo"`
+	} `json:"hitboxes"`
+
+	WrapProjectiles    bool `json:"wrapProjectiles"`
+	AsteroidCollisions bool `json:"asteroidCollisions"`
+}
+
+func asteroidsFileFrom(c asteroids.AsteroidsConfig) asteroidsFile {
+	f := asteroidsFile{
+		TickRate:                    Duration(c.TickRate),
+		MaxTickDelta:                c.MaxTickDelta,
+		MaxDuration:                 Duration(c.MaxDuration),
+		WorldWidth:                  c.WorldWidth,
+		WorldHeight:                 c.WorldHeight,
+		MinPlayers:                  c.MinPlayers,
+		ReconnectGrace:              Duration(c.ReconnectGrace),
+		MaxAsteroids:                c.MaxAsteroids,
+		SplitCount:                  c.SplitCount,
+		SplitAngleVariance:          c.SplitAngleVariance,
+		PlayerSpeed:                 c.PlayerSpeed,
+		Thrust:                      c.Thrust,
+		Drag:                        c.Drag,
+		PlayerHealth:                c.PlayerHealth,
+		ShootCooldown:               Duration(c.ShootCooldown),
+		ProjectileSpeed:             c.ProjectileSpeed,
+		ProjectileLifetime:          Duration(c.ProjectileLifetime),
+		PointsLarge:                 c.PointsLarge,
+		PointsMiddle:                c.PointsMiddle,
+		PointsSmall:                 c.PointsSmall,
+		PointsUFO:                   c.PointsUFO,
+		HealthLarge:                 c.HealthLarge,
+		HealthMiddle:                c.HealthMiddle,
+		HealthSmall:                 c.HealthSmall,
+		DifficultyRampPerMinute:     c.DifficultyRampPerMinute,
+		DifficultyMaxMultiplier:     c.DifficultyMaxMultiplier,
+		PowerupSpawnChancePerSecond: c.PowerupSpawnChancePerSecond,
+		MaxPowerups:                 c.MaxPowerups,
+		UFOSpawnInterval:            Duration(c.UFOSpawnInterval),
+		UFOShootCooldown:            Duration(c.UFOShootCooldown),
+		WrapProjectiles:             c.WrapProjectiles,
+		AsteroidCollisions:          c.AsteroidCollisions,
+	}
+	f.Hitboxes.Player = c.Hitboxes.Player
+	f.Hitboxes.Asteroid = c.Hitboxes.Asteroid
+	f.Hitboxes.Projectile = c.Hitboxes.Projectile
+	f.Hitboxes.Powerup = c.Hitboxes.Powerup
+	f.Hitboxes.UFO = c.Hitboxes.UFO
+	return f
+}
+
+func (f asteroidsFile) config() asteroids.AsteroidsConfig {
+	return asteroids.AsteroidsConfig{
+		TickRate:                    time.Duration(f.TickRate),
+		MaxTickDelta:                f.MaxTickDelta,
+		MaxDuration:                 time.Duration(f.MaxDuration),
+		WorldWidth:                  f.WorldWidth,
+		WorldHeight:                 f.WorldHeight,
+		MinPlayers:                  f.MinPlayers,
+		ReconnectGrace:              time.Duration(f.ReconnectGrace),
+		MaxAsteroids:                f.MaxAsteroids,
+		SplitCount:                  f.SplitCount,
+		SplitAngleVariance:          f.SplitAngleVariance,
+		PlayerSpeed:                 f.PlayerSpeed,
+		Thrust:                      f.Thrust,
+		Drag:                        f.Drag,
+		PlayerHealth:                f.PlayerHealth,
+		ShootCooldown:               time.Duration(f.ShootCooldown),
+		ProjectileSpeed:             f.ProjectileSpeed,
+		ProjectileLifetime:          time.Duration(f.ProjectileLifetime),
+		PointsLarge:                 f.PointsLarge,
+		PointsMiddle:                f.PointsMiddle,
+		PointsSmall:                 f.PointsSmall,
+		PointsUFO:                   f.PointsUFO,
+		HealthLarge:                 f.HealthLarge,
+		HealthMiddle:                f.HealthMiddle,
+		HealthSmall:                 f.HealthSmall,
+		DifficultyRampPerMinute:     f.DifficultyRampPerMinute,
+		DifficultyMaxMultiplier:     f.DifficultyMaxMultiplier,
+		PowerupSpawnChancePerSecond: f.PowerupSpawnChancePerSecond,
+		MaxPowerups:                 f.MaxPowerups,
+		UFOSpawnInterval:            time.Duration(f.UFOSpawnInterval),
+		UFOShootCooldown:            time.Duration(f.UFOShootCooldown),
+		Hitboxes: asteroids.HitboxScale{
+			Player:     f.Hitboxes.Player,
+			Asteroid:   f.Hitboxes.Asteroid,
+			Projectile: f.Hitboxes.Projectile,
+			Powerup:    f.Hitboxes.Powerup,
+			UFO:        f.Hitboxes.UFO,
+		},
+		WrapProjectiles:    f.WrapProjectiles,
+		AsteroidCollisions: f.AsteroidCollisions,
+	}
+}
+
+func validateAsteroids(c asteroids.AsteroidsConfig) error {
+	if err := validateTickRate(c.TickRate); err != nil {
+		return err
+	}
+	if c.MaxTickDelta != 0 && c.MaxTickDelta < 1 {
+		return fmt.Errorf("maxTickDelta has to be at least 1 tick interval or 0 for no limit, got %.2f", c.MaxTickDelta)
+	}
+	// Asteroids spawn at least ASTEROID_SPAWN_PADDING away from the center,
+	// that needs some room
+	if c.WorldWidth < 400 || c.WorldHeight < 300 || c.WorldWidth > 4000 || c.WorldHeight > 4000 {
+		return fmt.Errorf("the world has to be between 400x300 and 4000x4000, got %.0fx%.0f", c.WorldWidth, c.WorldHeight)
+	}
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("maxDuration can not be negative, got %s", c.MaxDuration)
+	}
+	if c.MinPlayers < 1 {
+		return fmt.Errorf("minPlayers has to be at least 1, got %d", c.MinPlayers)
+	}
+	if c.ReconnectGrace < 0 {
+		return fmt.Errorf("reconnectGrace can not be negative, got %s", c.ReconnectGrace)
+	}
+	if c.MaxAsteroids < 1 {
+		return fmt.Errorf("maxAsteroids has to be at least 1, got %d", c.MaxAsteroids)
+	}
+	if c.SplitCount < 0 {
+		return fmt.Errorf("splitCount can not be negative, got %d", c.SplitCount)
+	}
+	// The pieces have to keep flying forward, at 90° they would split sideways
+	if c.SplitAngleVariance < 0 || c.SplitAngleVariance >= 90 {
+		return fmt.Errorf("splitAngleVariance has to be at least 0 and less than 90 degrees, got %.1f", c.SplitAngleVariance)
+	}
+	if c.PlayerSpeed <= 0 || c.ProjectileSpeed <= 0 {
+		return fmt.Errorf("playerSpeed and projectileSpeed have to be positive, got %.2f and %.2f", c.PlayerSpeed, c.ProjectileSpeed)
+	}
+	if c.Thrust <= 0 {
+		return fmt.Errorf("thrust has to be positive, got %.2f", c.Thrust)
+	}
+	if c.Drag < 0 {
+		return fmt.Errorf("drag can not be negative, got %.2f", c.Drag)
+	}
+	// Every hit costs a whole life, the client draws them as hearts
+	if c.PlayerHealth < 1 || c.PlayerHealth != math.Trunc(c.PlayerHealth) {
+		return fmt.Errorf("playerHealth has to be a whole number of at least 1, got %.2f", c.PlayerHealth)
+	}
+	if c.ShootCooldown <= 0 || c.ProjectileLifetime <= 0 {
+		return fmt.Errorf("shootCooldown and projectileLifetime have to be positive, got %s and %s", c.ShootCooldown, c.ProjectileLifetime)
+	}
+	// A wrapping projectile that flies further than the world is big laps it
+	// in every direction and can hit the ship that fired it. Without wrapping
+	// it just despawns at the edge.
+	if c.WrapProjectiles && c.ProjectileRange() > max(c.WorldWidth, c.WorldHeight) {
+		return fmt.Errorf("projectiles fly %.0f units and wrap around the whole %.0fx%.0f world, lower projectileSpeed or projectileLifetime or turn off wrapProjectiles",
+			c.ProjectileRange(), c.WorldWidth, c.WorldHeight)
+	}
+	if c.PointsLarge < 0 || c.PointsMiddle < 0 || c.PointsSmall < 0 || c.PointsUFO < 0 {
+		return fmt.Errorf("asteroid and ufo points can not be negative")
+	}
+	// Like with the players, every projectile takes one point of health
+	for _, health := range []float64{c.HealthLarge, c.HealthMiddle, c.HealthSmall} {
+		if health < 1 || health != math.Trunc(health) {
+			return fmt.Errorf("healthLarge, healthMiddle and healthSmall have to be whole numbers of at least 1, got %.2f, %.2f and %.2f",
+				c.HealthLarge, c.HealthMiddle, c.HealthSmall)
+		}
+	}
+	if c.DifficultyRampPerMinute < 0 {
+		return fmt.Errorf("difficultyRampPerMinute can not be negative, got %.2f", c.DifficultyRampPerMinute)
+	}
+	if c.DifficultyMaxMultiplier < 1 {
+		return fmt.Errorf("difficultyMaxMultiplier has to be at least 1, got %.2f", c.DifficultyMaxMultiplier)
+	}
+	if c.PowerupSpawnChancePerSecond < 0 || c.PowerupSpawnChancePerSecond > 1 {
+		return fmt.Errorf("powerupSpawnChancePerSecond has to be between 0 and 1, got %.2f", c.PowerupSpawnChancePerSecond)
+	}
+	if c.MaxPowerups < 0 {
+		return fmt.Errorf("maxPowerups can not be negative, got %d", c.MaxPowerups)
+	}
+	if c.UFOSpawnInterval < 0 {
+		return fmt.Errorf("ufoSpawnInterval can not be negative, got %s", c.UFOSpawnInterval)
+	}
+	if c.UFOSpawnInterval > 0 && c.UFOShootCooldown <= 0 {
+		return fmt.Errorf("ufoShootCooldown has to be positive, got %s", c.UFOShootCooldown)
+	}
+	for name, scale := range map[string]float64{
+		"player":     c.Hitboxes.Player,
+		"asteroid":   c.Hitboxes.Asteroid,
+		"projectile": c.Hitboxes.Projectile,
+		"powerup":    c.Hitboxes.Powerup,
+		"ufo":        c.Hitboxes.UFO,
+	} {
+		if scale <= 0 || scale > 2 {
+			return fmt.Errorf("hitboxes.%s has to be between 0 and 2, got %.2f", name, scale)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game/asteroids"
+	"github.com/Driemtax/Archaide/internal/game/pong"
+)
+
+// Games holds the tunables of every game, loaded from a JSON file so
+// operators can balance the games without recompiling
+type Games struct {
+	Pong      pong.PongConfig
+	Asteroids asteroids.AsteroidsConfig
+}
+
+// Defaults returns the built in settings of every game
+func Defaults() Games {
+	return Games{
+		Pong:      pong.DefaultPongConfig(),
+		Asteroids: asteroids.DefaultAsteroidsConfig(),
+	}
+}
+
+// Load reads the game config file at path. Fields that are missing in the
+// file keep their default value. A value that makes no sense is an error,
+// the server should not start with a broken balance.
+//
+// Durations are written as strings like "250ms" or "1.5s":
+//
+//	{
+//		"pong": { "targetScore": 7, "serveDelay": "2s" },
+//		"asteroids": { "shootCooldown": "200ms", "pointsLarge": 25 }
+//	}
+func Load(path string) (Games, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Games{}, fmt.Errorf("reading game config: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse works like Load but with the file contents
+func Parse(data []byte) (Games, error) {
+	// The file structs start out with the defaults, json leaves
+	// everything alone that is not in the file
+	defaults := Defaults()
+	f := gamesFile{
+		Pong:      pongFileFrom(defaults.Pong),
+		Asteroids: asteroidsFileFrom(defaults.Asteroids),
+	}
+	// A typo in a field name would silently keep the default otherwise
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&f); err != nil {
+		return Games{}, fmt.Errorf("parsing game config: %w", err)
+	}
+
+	games := Games{
+		Pong:      f.Pong.config(),
+		Asteroids: f.Asteroids.config(),
+	}
+	if err := validatePong(games.Pong); err != nil {
+		return Games{}, fmt.Errorf("invalid pong config: %w", err)
+	}
+	if err := validateAsteroids(games.Asteroids); err != nil {
+		return Games{}, fmt.Errorf("invalid asteroids config: %w", err)
+	}
+	return games, nil
+}
+
+// Duration is a time.Duration that is written as "250ms" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations have to be strings like \"250ms\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type gamesFile struct {
+	Pong      pongFile      `json:"pong"`
+	Asteroids asteroidsFile `json:"asteroids"`
+}
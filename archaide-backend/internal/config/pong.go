@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game/pong"
+)
+
+// The layout of the pong section in the config file
+type pongFile struct {
+	SpeedMultiplier float64  `json:"speedMultiplier"`
+	PaddleHeight    float64  `json:"paddleHeight"`
+	TargetScore     int      `json:"targetScore"`
+	Sets            int      `json:"sets"`
+	TickRate        Duration `json:"tickRate"`
+	ServeDelay      Duration `json:"serveDelay"`
+	MaxPause        Duration `json:"maxPause"`
+	PausesPerPlayer int      `json:"pausesPerPlayer"`
+	MaxDuration     Duration `json:"maxDuration"`
+
+	PaddleMomentum     bool    `json:"paddleMomentum"`
+	PaddleAcceleration float64 `json:"paddleAcceleration"`
+	PaddleDeceleration float64 `json:"paddleDeceleration"`
+}
+
+func pongFileFrom(c pong.PongConfig) pongFile {
+	return pongFile{
+		SpeedMultiplier: c.SpeedMultiplier,
+		PaddleHeight:    c.PaddleHeight,
+		TargetScore:     c.TargetScore,
+		Sets:            c.Sets,
+		TickRate:        Duration(c.TickRate),
+		ServeDelay:      Duration(c.ServeDelay),
+		MaxPause:        Duration(c.MaxPause),
+		PausesPerPlayer: c.PausesPerPlayer,
+		MaxDuration:     Duration(c.MaxDuration),
+
+		PaddleMomentum:     c.PaddleMomentum,
+		PaddleAcceleration: c.PaddleAcceleration,
+		PaddleDeceleration: c.PaddleDeceleration,
+	}
+}
+
+func (f pongFile) config() pong.PongConfig {
+	return pong.PongConfig{
+		SpeedMultiplier: f.SpeedMultiplier,
+		PaddleHeight:    f.PaddleHeight,
+		TargetScore:     f.TargetScore,
+		Sets:            f.Sets,
+		TickRate:        time.Duration(f.TickRate),
+		ServeDelay:      time.Duration(f.ServeDelay),
+		MaxPause:        time.Duration(f.MaxPause),
+		PausesPerPlayer: f.PausesPerPlayer,
+		MaxDuration:     time.Duration(f.MaxDuration),
+
+		PaddleMomentum:     f.PaddleMomentum,
+		PaddleAcceleration: f.PaddleAcceleration,
+		PaddleDeceleration: f.PaddleDeceleration,
+	}
+}
+
+func validatePong(c pong.PongConfig) error {
+	if c.SpeedMultiplier <= 0 || c.SpeedMultiplier > 5 {
+		return fmt.Errorf("speedMultiplier has to be between 0 and 5, got %.2f", c.SpeedMultiplier)
+	}
+	if c.PaddleHeight <= 0 || c.PaddleHeight > pong.GAME_HEIGHT {
+		return fmt.Errorf("paddleHeight has to be between 0 and %.0f, got %.2f", float64(pong.GAME_HEIGHT), c.PaddleHeight)
+	}
+	// The same bounds the host has in the room settings
+	if c.TargetScore < 1 || c.TargetScore > pong.MAX_TARGET_SCORE {
+		return fmt.Errorf("targetScore has to be between 1 and %d, got %d", pong.MAX_TARGET_SCORE, c.TargetScore)
+	}
+	// With an even number both players could win half of the sets
+	if c.Sets < 1 || c.Sets%2 == 0 {
+		return fmt.Errorf("sets has to be an odd number of at least 1, got %d", c.Sets)
+	}
+	if err := validateTickRate(c.TickRate); err != nil {
+		return err
+	}
+	if c.ServeDelay < 0 {
+		return fmt.Errorf("serveDelay can not be negative, got %s", c.ServeDelay)
+	}
+	if c.MaxPause < 0 || c.MaxPause > 5*time.Minute {
+		return fmt.Errorf("maxPause has to be between 0 and 5m, got %s", c.MaxPause)
+	}
+	if c.PausesPerPlayer < 0 {
+		return fmt.Errorf("pausesPerPlayer can not be negative, got %d", c.PausesPerPlayer)
+	}
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("maxDuration can not be negative, got %s", c.MaxDuration)
+	}
+	// A paddle without acceleration would never move, one without deceleration never stop
+	if c.PaddleAcceleration <= 0 {
+		return fmt.Errorf("paddleAcceleration has to be positive, got %.2f", c.PaddleAcceleration)
+	}
+	if c.PaddleDeceleration <= 0 {
+		return fmt.Errorf("paddleDeceleration has to be positive, got %.2f", c.PaddleDeceleration)
+	}
+	return nil
+}
+
+// Faster than 200 FPS is pointless, slower than 1 FPS is not a game anymore
+func validateTickRate(tickRate time.Duration) error {
+	if tickRate < 5*time.Millisecond || tickRate > time.Second {
+		return fmt.Errorf("tickRate has to be between 5ms and 1s, got %s", tickRate)
+	}
+	return nil
+}
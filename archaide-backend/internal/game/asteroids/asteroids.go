@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
+	"math/rand/v2"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
@@ -13,13 +17,19 @@ import (
 )
 
 const (
+	GAME_NAME = "Asteroids"
+
 	// Player Settings
-	INITIAL_PLAYER_SPEED      float64       = 250.0 // Units per secon
+	INITIAL_PLAYER_SPEED      float64       = 250.0 // Units per secon, the top speed
+	PLAYER_THRUST             float64       = 350.0 // Units per second², how fast the ship speeds up
+	PLAYER_DRAG               float64       = 0.6   // Share of the velocity lost per second
 	INITIAL_TURN_SPEED_DEG    float64       = 180.0 // Degrees per second
 	INITIAL_PLAYER_HEALTH     float64       = 3.0
 	PLAYER_RADIUS             float64       = 15.0
 	PLAYER_RESPAWN_INVINCIBLE time.Duration = 3 * time.Second
+	PLAYER_SPAWN_RING_RADIUS  float64       = 80.0 // The players start spread on a ring around the center
 	PLAYER_SHOOT_COOLDOWN     time.Duration = 250 * time.Millisecond
+	INPUT_TIMEOUT             time.Duration = 500 * time.Millisecond // Without new input for this long all buttons count as released
 
 	// Projectile Settings
 	PROJECTILE_SPEED    float64       = 400.0 // Units per second
@@ -34,30 +44,77 @@ const (
 	ASTEROID_POINTS_LARGE     int     = 20
 	ASTEROID_POINTS_MIDDLE    int     = 50
 	ASTEROID_POINTS_SMALL     int     = 100
+	ASTEROID_HEALTH_LARGE     float64 = 1 // Hits before an asteroid breaks, 1 is the classic one hit
+	ASTEROID_HEALTH_MIDDLE    float64 = 1
+	ASTEROID_HEALTH_SMALL     float64 = 1
 	ASTEROID_SPLIT_COUNT      int     = 3  // Into how many pieces an asteroid breaks after getting hit
 	ASTEROID_SPLIT_ANGLE_VARY float64 = 30 // The degress of variance for the direction of asteroids after splitting
+	MAX_ASTEROIDS             int     = 48 // Upper limit for all asteroids in the world, keeps the state frames small
+
+	// Powerup Settings
+	POWERUP_RADIUS         float64       = 12.0
+	POWERUP_LIFETIME       time.Duration = 10 * time.Second // How long an uncollected powerup stays in the world
+	SHIELD_DURATION        time.Duration = 5 * time.Second
+	RAPID_FIRE_DURATION    time.Duration = 8 * time.Second
+	RAPID_FIRE_COOLDOWN    time.Duration = 100 * time.Millisecond
+	EXTRA_LIFE_HEALTH_GAIN float64       = 1.0
+
+	// UFO Settings
+	UFO_RADIUS           float64       = 20.0
+	UFO_SPEED            float64       = 90.0  // Units per second
+	UFO_PROJECTILE_SPEED float64       = 250.0 // Slower than the players shots, so they can be dodged
+	UFO_POINTS           int           = 200
+	UFO_SPAWN_INTERVAL   time.Duration = 30 * time.Second
+	UFO_SHOOT_COOLDOWN   time.Duration = 1500 * time.Millisecond
 
 	// Game World Settings
 	WORLD_WIDTH  float64 = 800.0
 	WORLD_HEIGHT float64 = 600.0
 
 	// Game Loop
-	TICK_RATE time.Duration = 33 * time.Millisecond // ~30 FPS
+	TICK_RATE    time.Duration = 33 * time.Millisecond // ~30 FPS
+	MAX_DURATION time.Duration = 8 * time.Minute       // Afterwards the leading survivor wins, on a tie the next point or death decides
+	// The longest step of a single tick in tick intervals. After a stall, e.g. a GC
+	// pause, the game rather slows down for a moment than teleporting everything.
+	MAX_TICK_DELTA float64 = 3
 )
 
 type Player struct {
 	Pos            component.Vector2D `json:"pos"`
-	Speed          float64            `json:"speed"`
+	Speed          float64            `json:"speed"` // Top speed
 	Dir            component.Vector2D `json:"dir"`
+	Vel            component.Vector2D `json:"vel"` // Units per second, the ship keeps drifting without thrust
 	TurnSpeed      float64
 	Health         component.Health
 	LastInput      AsteroidsInputPayload
-	PlayerID       string // Saving the id of the game.Player aka Client
+	LastInputTime  time.Time // When the last input message arrived, stale inputs are cleared
+	PlayerID       string    // Saving the id of the game.Player aka Client
+	Name           string    // Display name of the game.Player
 	Score          int
 	LastShotTime   time.Time
 	IsInvincible   bool
 	InvincibleTime time.Time
-	Radius         float64
+	Radius         float64                   // Drawn size, collisions use playerHitbox
+	Effects        map[PowerupType]time.Time // Active powerup effects and when they expire
+	Slot           int                       // Order in which the player joined, decides the spawn position
+	Stats          game.PlayerStats
+}
+
+// Counts a shot of the player that destroyed target, e.g. an asteroid size
+func (p *Player) countHit(target string) {
+	p.Stats.Hits++
+	if p.Stats.Destroyed == nil {
+		p.Stats.Destroyed = make(map[string]int)
+	}
+	p.Stats.Destroyed[target]++
+}
+
+// How long the player stays invincible, 0 if they are not
+func (p *Player) invincibleLeft(now time.Time) time.Duration {
+	if !p.IsInvincible || !p.InvincibleTime.After(now) {
+		return 0
+	}
+	return p.InvincibleTime.Sub(now)
 }
 
 type AsteroidType string
@@ -74,14 +131,34 @@ type Asteroid struct {
 	Dir    component.Vector2D
 	Type   AsteroidType
 	Speed  float64
-	Radius float64
+	Radius float64          // Drawn size, collisions use asteroidHitbox
+	Health component.Health // Projectiles wear it down, it breaks at 0
 	// Just for the display variant in the frontend
 	VariantIndex int
 }
 
+type PowerupType string
+
+const (
+	SHIELD     PowerupType = "shield"
+	RAPID_FIRE PowerupType = "rapid_fire"
+	EXTRA_LIFE PowerupType = "extra_life"
+)
+
+var powerupTypes = []PowerupType{SHIELD, RAPID_FIRE, EXTRA_LIFE}
+
+type Powerup struct {
+	ID        string
+	Pos       component.Vector2D
+	Type      PowerupType
+	SpawnTime time.Time
+	Radius    float64
+}
+
 type Projectile struct {
 	ID        string
-	OwnerID   string
+	OwnerID   string // The player or the UFO that fired it
+	Hostile   bool   // Fired by a UFO, hurts players and scores nothing
 	Pos       component.Vector2D
 	Dir       component.Vector2D
 	Speed     float64
@@ -94,31 +171,63 @@ type AsteroidsGame struct {
 	// But anyways we are getting an interface to notify the hub
 	gameFinisher game.GameFinisher
 
+	config       AsteroidsConfig
 	gameID       string
 	players      map[string]*Player     // Map Player Id to AsteroidPlayer State
 	playerMap    map[string]game.Player // Map Player Id to game.Player aka Client
+	spectators   map[string]game.Player // Map Spectator Id to game.Player, they only get the game messages
+	recorder     game.Recorder          // Optional, records the sent frames for replays
+	debugSink    game.DebugSink         // Off unless someone debugs this game, gets every state
+	observer     game.GameObserver
 	asteroids    map[string]*Asteroid
 	projectiles  map[string]*Projectile
+	powerups     map[string]*Powerup
+	ufos         map[string]*UFO
+	ufoTimer     float64 // Seconds counted towards the next UFO
 	playerMux    sync.RWMutex
-	ticker       *time.Ticker
+	clock        game.Clock // Source of the time, a fake one in tests
+	ticker       game.Ticker
+	tickMonitor  *game.TickMonitor
 	stopChan     chan bool
 	isRunning    bool
+	stopped      bool // For good, the hub was told and Start does nothing anymore
 	minPlayers   int
 	maxPlayers   int
+	nextSlot     int
 	lastTickTime time.Time // For my delta time
+	startTime    time.Time
+	matchTime    float64        // Seconds played, accumulated from dt so it does not depend on the tick rate
+	suddenDeath  bool           // The time ran out on a tie, the next point or death decides
+	sentScores   map[string]int // The scores of the last score update
+	seed         uint32         // Cosmetic only, see AsteroidsConfigPayload
+
+	// Too few players are left and the game waits for the ones that dropped,
+	// see AsteroidsConfig.ReconnectGrace. It still runs, but stands still.
+	paused        bool
+	reconnectLeft time.Duration      // The game ends when this runs out
+	disconnected  map[string]*Player // The state of the players that dropped, they get it back on their return
 }
 
-func NewAsteroidsGame(finisher game.GameFinisher, id string) *AsteroidsGame {
+func NewAsteroidsGame(finisher game.GameFinisher, id string, config AsteroidsConfig, clock game.Clock) *AsteroidsGame {
 	return &AsteroidsGame{
 		gameFinisher: finisher,
+		config:       config,
+		clock:        clock,
 		gameID:       id,
 		players:      make(map[string]*Player),
 		playerMap:    make(map[string]game.Player),
+		spectators:   make(map[string]game.Player),
 		asteroids:    make(map[string]*Asteroid),
 		projectiles:  make(map[string]*Projectile),
+		powerups:     make(map[string]*Powerup),
+		ufos:         make(map[string]*UFO),
+		disconnected: make(map[string]*Player),
+		seed:         rand.Uint32(),
+		observer:     game.NopObserver{},
+		tickMonitor:  game.NewTickMonitor(id, config.TickRate),
 		stopChan:     make(chan bool),
 		isRunning:    false,
-		minPlayers:   2,
+		minPlayers:   config.MinPlayers,
 		maxPlayers:   8,
 	}
 }
@@ -129,63 +238,225 @@ func (g *AsteroidsGame) GetID() string {
 	return g.gameID
 }
 
+func (g *AsteroidsGame) Name() string {
+	return GAME_NAME
+}
+
+// MinPlayers returns how many players are needed to start the game
+func (g *AsteroidsGame) MinPlayers() int {
+	return g.minPlayers
+}
+
 func (g *AsteroidsGame) AddPlayer(player game.Player) error {
 	g.playerMux.Lock()
 	defer g.playerMux.Unlock()
 
-	if len(g.players) >= g.maxPlayers {
-		return fmt.Errorf("game %s is full (%d/%d players)", g.gameID, len(g.players), g.maxPlayers)
-	}
-
 	playerID := player.GetID()
 	if _, exists := g.players[playerID]; exists {
 		return fmt.Errorf("player %s already in game %s", playerID, g.gameID)
 	}
-
-	spwanPos := component.NewVector2D(WORLD_WIDTH/2, WORLD_HEIGHT/2)
+	if len(g.players) >= g.maxPlayers {
+		return fmt.Errorf("game %s is full (%d/%d players)", g.gameID, len(g.players), g.maxPlayers)
+	}
 
 	newPlayer := &Player{
-		Pos:            spwanPos,
-		Speed:          INITIAL_PLAYER_SPEED,
-		Dir:            component.NewVector2D(0, -1), // Point up
+		Slot:           g.nextSlot,
+		Speed:          g.config.PlayerSpeed,
 		LastInput:      AsteroidsInputPayload{},
-		Health:         component.NewHealth(INITIAL_PLAYER_HEALTH),
-		TurnSpeed:      degreesToRadians(INITIAL_PLAYER_SPEED),
+		Health:         component.NewHealth(g.config.PlayerHealth),
+		TurnSpeed:      degreesToRadians(INITIAL_TURN_SPEED_DEG),
 		PlayerID:       playerID,
+		Name:           player.GetName(),
 		Score:          0,
 		IsInvincible:   true,
-		InvincibleTime: time.Now().Add(PLAYER_RESPAWN_INVINCIBLE),
+		InvincibleTime: g.clock.Now().Add(PLAYER_RESPAWN_INVINCIBLE),
 		Radius:         PLAYER_RADIUS,
+		Effects:        make(map[PowerupType]time.Time),
 	}
+	g.nextSlot++
 	g.players[playerID] = newPlayer
 	g.playerMap[playerID] = player // Saving the game.Player instance
+	g.placeOnSpawnRing()
 
 	log.Printf("[Game %s] Player %s added.", g.gameID, playerID)
 	return nil
 }
 
 func (g *AsteroidsGame) RemovePlayer(player game.Player) {
+	g.removePlayer(player, true)
+}
+
+// LeavePlayer removes a player who left on purpose, the game never waits for them
+func (g *AsteroidsGame) LeavePlayer(player game.Player) {
+	g.removePlayer(player, false)
+}
+
+func (g *AsteroidsGame) removePlayer(player game.Player, mayReconnect bool) {
 	g.playerMux.Lock()
 	defer g.playerMux.Unlock()
 
 	playerID := player.GetID()
-	if _, ok := g.players[playerID]; ok {
+	if pState, ok := g.players[playerID]; ok {
 		delete(g.players, playerID)
 		delete(g.playerMap, playerID)
+		// Its shots leave with it. Otherwise they would still break up
+		// asteroids that nobody gets the points for.
+		for id, proj := range g.projectiles {
+			if proj.OwnerID == playerID {
+				delete(g.projectiles, id)
+			}
+		}
 		log.Printf("[Game %s] Player %s removed.", g.gameID, playerID)
 
-		if len(g.players) < g.minPlayers && g.isRunning {
-			log.Printf("[Game %s] Not enough players remaining (%d/%d). Stopping game.", g.gameID, len(g.players), g.minPlayers)
-			// Stopping the game
-			// Its important to stop the game inside of a goroutine to not create
+		if !g.isRunning {
+			return
+		}
+		humansLeft := g.hasHumansInternal()
+		if len(g.players) < g.minPlayers || !humansLeft {
+			// Waits for the ones that dropped, unless nobody is left to wait with.
+			// Bots don't count, they would only play against each other.
+			if mayReconnect && g.config.ReconnectGrace > 0 && humansLeft {
+				g.waitForReconnectInternal(pState)
+				return
+			}
+			if humansLeft {
+				log.Printf("[Game %s] Not enough players remaining (%d/%d). Stopping game.", g.gameID, len(g.players), g.minPlayers)
+			} else {
+				log.Printf("[Game %s] Only bots remaining. Stopping game.", g.gameID)
+			}
+			// The result is taken right now, while we still hold the lock. If the
+			// other players leave at the same time their removals find the game
+			// stopped already and neither change the result nor notify the hub again.
+			result := g.finish()
+			// Its important to notify the hub inside of a goroutine to not create
 			// a deadlock... It looks a bit weird but we need it *sob*
-			go g.Stop()
+			go g.gameFinisher.GameFinished(g.gameID, result)
 		}
 	}
 }
 
+// Tells if anyone but bots is still in the game.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) hasHumansInternal() bool {
+	for _, player := range g.playerMap {
+		if !game.IsBot(player) {
+			return true
+		}
+	}
+	return false
+}
+
+// RejoinPlayer puts a player that dropped back into the game, if the game
+// still waits for them
+func (g *AsteroidsGame) RejoinPlayer(player game.Player) bool {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+
+	dropped, ok := g.disconnected[player.GetID()]
+	if !ok || g.stopped {
+		return false
+	}
+	g.rejoinInternal(player, dropped)
+	return true
+}
+
+// Keeps the state of a player that dropped below MinPlayers and pauses
+// the game until they come back or the grace period runs out.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) waitForReconnectInternal(p *Player) {
+	g.disconnected[p.PlayerID] = p
+	if g.paused {
+		// Another one dropped, the grace period does not start over
+		return
+	}
+	g.paused = true
+	g.reconnectLeft = g.config.ReconnectGrace
+	log.Printf("[Game %s] Not enough players remaining (%d/%d). Waiting %s for %s to come back.",
+		g.gameID, len(g.players), g.minPlayers, g.config.ReconnectGrace, p.PlayerID)
+}
+
+// Puts a player that dropped back into the game, with the ship and the score
+// they had. Once there are enough players again the game goes on.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) rejoinInternal(player game.Player, p *Player) {
+	delete(g.disconnected, p.PlayerID)
+	// Whatever they held down when they dropped is not held anymore
+	p.LastInput = AsteroidsInputPayload{}
+	g.players[p.PlayerID] = p
+	g.playerMap[p.PlayerID] = player
+	log.Printf("[Game %s] Player %s is back.", g.gameID, p.PlayerID)
+	// The game loop only sends the config when it starts
+	player.SendMessage(message.AsteroidsConfig, g.configPayload())
+
+	if g.paused && len(g.players) >= g.minPlayers {
+		g.paused = false
+		g.reconnectLeft = 0
+		// Who is still missing now drops out for good
+		clear(g.disconnected)
+		log.Printf("[Game %s] Enough players again (%d/%d), resuming.", g.gameID, len(g.players), g.minPlayers)
+	}
+}
+
+// PlayerScore returns the points the player scored so far in this game
+func (g *AsteroidsGame) PlayerScore(playerID string) (int, bool) {
+	g.playerMux.RLock()
+	defer g.playerMux.RUnlock()
+	p, ok := g.players[playerID]
+	if !ok {
+		return 0, false
+	}
+	return p.Score, true
+}
+
+func (g *AsteroidsGame) AddSpectator(spectator game.Player) {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+	g.spectators[spectator.GetID()] = spectator
+	if g.isRunning {
+		spectator.SendMessage(message.AsteroidsConfig, g.configPayload())
+	}
+	log.Printf("[Game %s] Spectator %s added.", g.gameID, spectator.GetID())
+}
+
+func (g *AsteroidsGame) configPayload() AsteroidsConfigPayload {
+	return AsteroidsConfigPayload{
+		WorldWidth:   g.config.WorldWidth,
+		WorldHeight:  g.config.WorldHeight,
+		PlayerHealth: g.config.PlayerHealth,
+		Seed:         g.seed,
+	}
+}
+
+func (g *AsteroidsGame) RemoveSpectator(spectator game.Player) {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+	delete(g.spectators, spectator.GetID())
+	log.Printf("[Game %s] Spectator %s removed.", g.gameID, spectator.GetID())
+}
+
+// Has to be called before the game is started
+func (g *AsteroidsGame) SetRecorder(recorder game.Recorder) {
+	g.recorder = recorder
+}
+
+// Has to be called before the game is started
+func (g *AsteroidsGame) SetObserver(observer game.GameObserver) {
+	g.observer = observer
+}
+
+// Can be called at any time, nil stops the debug capture again
+func (g *AsteroidsGame) SetDebugSink(recorder game.Recorder) {
+	g.debugSink.Set(recorder)
+}
+
 func (g *AsteroidsGame) Start() {
 	g.playerMux.Lock()
+	// E.g. everyone left before the game loop got going
+	if g.stopped {
+		g.playerMux.Unlock()
+		log.Printf("[Game %s] Already stopped, not starting.", g.gameID)
+		return
+	}
 	if len(g.players) < g.minPlayers {
 		g.playerMux.Unlock()
 		log.Printf("[Game %s] Cannot start, not enough players (%d/%d).", g.gameID, len(g.players), g.minPlayers)
@@ -193,12 +464,16 @@ func (g *AsteroidsGame) Start() {
 		return
 	}
 	g.isRunning = true
-	g.lastTickTime = time.Now()
-	g.ticker = time.NewTicker(TICK_RATE)
+	g.startTime = g.clock.Now()
+	g.lastTickTime = g.startTime
+	g.ticker = g.clock.NewTicker(g.config.TickRate)
 	g.initializeAsteroids()
 	g.playerMux.Unlock()
 
 	log.Printf("[Game %s] Starting game loop.", g.gameID)
+	g.observer.GameStarted(g.gameID, GAME_NAME)
+	// If the game logic panics only this game ends, not the whole server
+	defer g.recoverFromPanic()
 	defer func() {
 		if g.ticker != nil {
 			g.ticker.Stop()
@@ -207,26 +482,26 @@ func (g *AsteroidsGame) Start() {
 		// Calling gameFinisher.GameFinished happens in game.Stop()
 	}()
 
+	// Before the first state, so the client knows how big the world is
+	g.playerMux.RLock()
+	recipients := g.recipients()
+	g.playerMux.RUnlock()
+	for _, p := range recipients {
+		p.SendMessage(message.AsteroidsConfig, g.configPayload())
+	}
+
 	for {
 		select {
-		case <-g.ticker.C:
+		case now := <-g.ticker.C():
 			if !g.isRunning {
 				return
 			}
-			// Calculate Delta Time
-			now := time.Now()
+			// Calculate Delta Time, from the time of the tick and not when
+			// we got to handle it, so a fake clock can step the game exactly
 			dt := now.Sub(g.lastTickTime).Seconds()
 			g.lastTickTime = now
 
-			g.playerMux.Lock()
-
-			g.update(dt)
-
-			gameOver, _ := g.checkGameOver() // internal check
-
-			g.sendGameState()
-
-			g.playerMux.Unlock()
+			gameOver := g.tick(dt)
 			if gameOver {
 				log.Printf("[Game %s] Game over condition met.", g.gameID)
 				g.playerMux.RLock()
@@ -244,13 +519,100 @@ func (g *AsteroidsGame) Start() {
 	}
 }
 
+// Updates the game, sends the new state and checks if the game is over.
+// Unlocks with defer so a panic in the game logic does not leave the game locked.
+func (g *AsteroidsGame) tick(dt float64) bool {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+
+	// The loop reads isRunning without the lock, a tick can still come in
+	// after the game finished. The stopChan ends the loop right after.
+	if g.stopped {
+		return false
+	}
+
+	if maxDt := g.config.MaxTickDelta * g.config.TickRate.Seconds(); maxDt > 0 && dt > maxDt {
+		dt = maxDt
+	}
+
+	started := g.clock.Now()
+	gameOver := false
+	if g.paused {
+		// Nothing moves or spawns while the game waits, it only counts down
+		g.reconnectLeft -= time.Duration(dt * float64(time.Second))
+		if g.reconnectLeft <= 0 {
+			log.Printf("[Game %s] Nobody came back in time.", g.gameID)
+			g.paused = false
+			gameOver = true
+		}
+	} else {
+		g.update(dt)
+		gameOver, _ = g.checkGameOver() // internal check
+	}
+	g.sendScoreUpdate()
+	// A game that can not keep up skips every other state, see game.TickMonitor
+	if g.tickMonitor.ShouldSend() {
+		g.sendGameState()
+	}
+	g.tickMonitor.Record(g.clock.Now().Sub(started))
+	return gameOver
+}
+
+// Has to be deferred in the game loop. A panic stops the game and the hub
+// gets an empty result, which sends all players back to the lobby.
+func (g *AsteroidsGame) recoverFromPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("[Game %s] Game loop panicked: %v\n%s", g.gameID, r, debug.Stack())
+
+	g.playerMux.Lock()
+	alreadyStopped := g.stopped
+	g.isRunning = false
+	g.stopped = true
+	g.tickMonitor.Close()
+	select {
+	case <-g.stopChan: // Already closed
+	default:
+		close(g.stopChan)
+	}
+	g.playerMux.Unlock()
+
+	// Otherwise the game was stopped before and the hub knows already
+	if !alreadyStopped {
+		g.gameFinisher.GameFinished(g.gameID, game.GameResult{Scores: make(map[string]int)})
+	}
+}
+
+// Stops the game and tells the hub, exactly once. That also works before
+// Start, then the game never starts.
 func (g *AsteroidsGame) Stop() {
 	g.playerMux.Lock()
-	if !g.isRunning {
+	if g.stopped {
 		g.playerMux.Unlock()
 		return
 	}
+	result := g.finish()
+	g.playerMux.Unlock()
+
+	// Inform the hub that the game is finished and retrieve all
+	// players back to the lobby
+	g.gameFinisher.GameFinished(g.gameID, result)
+}
+
+// Marks the game as stopped, ends the game loop and returns the final result.
+// Only the caller that saw the game running may report the result to the hub.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) finish() game.GameResult {
+	if g.isRunning {
+		log.Printf("[Game %s] Stopping game after %s.", g.gameID, g.clock.Now().Sub(g.startTime).Round(time.Second))
+	} else {
+		log.Printf("[Game %s] Stopping game before it started.", g.gameID)
+	}
 	g.isRunning = false
+	g.stopped = true
+	g.tickMonitor.Close()
 
 	if g.ticker != nil {
 		g.ticker.Stop()
@@ -264,24 +626,25 @@ func (g *AsteroidsGame) Stop() {
 		close(g.stopChan)
 	}
 
+	// The bots would otherwise keep running until they time out
+	for _, player := range g.playerMap {
+		if bot, ok := player.(*AsteroidsBot); ok {
+			bot.stop()
+		}
+	}
+
 	result := game.GameResult{
 		Scores: make(map[string]int),
+		Stats:  g.playerStats(),
 	}
 	for playerID, playerState := range g.players {
+		if game.IsBot(g.playerMap[playerID]) {
+			delete(result.Stats, playerID)
+			continue
+		}
 		result.Scores[playerID] = playerState.Score
 	}
-
-	playersSnapshot := make([]game.Player, 0, len(g.playerMap))
-	for _, p := range g.playerMap {
-		playersSnapshot = append(playersSnapshot, p)
-	}
-	g.playerMux.Unlock()
-
-	log.Printf("[Game %s] Stopping game.", g.gameID)
-
-	// Inform the hub that the game is finished and retrieve all
-	// players back to the lobby
-	g.gameFinisher.GameFinished(g.gameID, result)
+	return result
 }
 
 func (g *AsteroidsGame) HandleMessage(player game.Player, msg message.Message) {
@@ -289,16 +652,17 @@ func (g *AsteroidsGame) HandleMessage(player game.Player, msg message.Message) {
 
 	switch msg.Type {
 	case message.AsteroidsInput:
-		var payload AsteroidsInputPayload
-		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
-			log.Printf("[Game %s] Error unmarshalling AsteroidsInput from %s: %v", g.gameID, playerID, err)
+		payload, err := validateInput(msg.Payload)
+		if err != nil {
+			log.Printf("[Game %s] Invalid AsteroidsInput from %s: %v", g.gameID, playerID, err)
+			player.SendMessage(message.Error, message.ErrorMessage{Message: err.Error()})
 			return
 		}
 
 		g.playerMux.Lock()
 		pState, ok := g.players[playerID]
 		if ok {
-			pState.HandleInput(payload)
+			pState.HandleInput(payload, g.clock.Now())
 		} else {
 			log.Printf("[Game %s] Received input from player %s who is not in the internal state map.", g.gameID, playerID)
 		}
@@ -322,8 +686,13 @@ func (g *AsteroidsGame) checkGameOver() (bool, string) {
 	numPlayers := len(g.players)
 	numAlive := len(alivePlayers)
 
-	// Game ends if 0 or 1 players are left alive in a multiplayer game,
-	// or if the only player dies in a single-player game.
+	// In the single-player sandbox the lone player blasts asteroids
+	// until they die, there is no one to outlive
+	if numPlayers == 1 {
+		return numAlive == 0, ""
+	}
+
+	// Game ends if 0 or 1 players are left alive in a multiplayer game
 	if numPlayers >= g.minPlayers && numAlive <= 1 {
 		if numAlive == 1 {
 			return true, alivePlayers[0] // Last one standing wins
@@ -332,21 +701,55 @@ func (g *AsteroidsGame) checkGameOver() (bool, string) {
 		}
 	}
 
+	// Out of time, the survivor with the most points wins. On a tie it is
+	// sudden death and this check ends the game once someone leads alone.
+	if g.config.MaxDuration > 0 && g.matchTime >= g.config.MaxDuration.Seconds() {
+		if leader := g.survivingLeader(); leader != "" {
+			return true, leader
+		}
+		if !g.suddenDeath {
+			g.suddenDeath = true
+			log.Printf("[Game %s] Time is up with a tie, sudden death!", g.gameID)
+			for _, player := range g.recipients() {
+				player.SendMessage(message.SuddenDeath, nil)
+			}
+		}
+	}
+
 	// Game doesn't end yet
 	return false, ""
 }
 
 // Sends the current game state to all connected players
 func (g *AsteroidsGame) sendGameState() {
+	now := g.clock.Now()
 	playerStates := make(map[string]PlayerState)
 	for pID, pState := range g.players {
+		effects := make([]PowerupType, 0, len(pState.Effects))
+		for effect := range pState.Effects {
+			effects = append(effects, effect)
+		}
+		sort.Slice(effects, func(i, j int) bool { return effects[i] < effects[j] })
+		input := pState.LastInput
+		if pState.Health.IsDead() {
+			input = AsteroidsInputPayload{}
+		}
 		playerStates[pID] = PlayerState{
 			Pos:          pState.Pos,
 			Dir:          pState.Dir,
+			Vel:          pState.Vel,
 			Health:       pState.Health.HP,
 			IsInvincible: pState.IsInvincible,
+			InvincibleMs: pState.invincibleLeft(now).Milliseconds(),
 			Score:        pState.Score,
 			ID:           pState.PlayerID,
+			Name:         pState.Name,
+			Effects:      effects,
+			Thrusting:    input.Up,
+			// Both at once cancel out, the ship does not turn then
+			TurningLeft:  input.Left && !input.Right,
+			TurningRight: input.Right && !input.Left,
+			Shooting:     input.Shoot,
 		}
 	}
 
@@ -356,23 +759,61 @@ func (g *AsteroidsGame) sendGameState() {
 			ID:           ast.ID,
 			Pos:          ast.Pos,
 			Dir:          ast.Dir,
+			Vel:          ast.Dir.Mul(ast.Speed),
 			Typ:          ast.Type,
 			VariantIndex: ast.VariantIndex,
+			Health:       ast.Health.HP,
+			MaxHealth:    ast.Health.MaxHP,
 		})
 	}
 
 	projectileStates := make([]ProjectileState, 0, len(g.projectiles))
 	for _, proj := range g.projectiles {
 		projectileStates = append(projectileStates, ProjectileState{
-			ID:  proj.ID,
-			Pos: proj.Pos,
+			ID:      proj.ID,
+			Pos:     proj.Pos,
+			Vel:     proj.Dir.Mul(proj.Speed),
+			Hostile: proj.Hostile,
+		})
+	}
+
+	powerupStates := make([]PowerupState, 0, len(g.powerups))
+	for _, pu := range g.powerups {
+		powerupStates = append(powerupStates, PowerupState{
+			ID:   pu.ID,
+			Pos:  pu.Pos,
+			Type: pu.Type,
+		})
+	}
+
+	ufoStates := make([]UFOState, 0, len(g.ufos))
+	for _, ufo := range g.ufos {
+		ufoStates = append(ufoStates, UFOState{
+			ID:  ufo.ID,
+			Pos: ufo.Pos,
+			Vel: ufo.Dir.Mul(ufo.Speed),
 		})
 	}
 
+	// The objects come out of maps in random order. Sorted by ID the arrays keep
+	// their order from frame to frame, which makes it easier for the clients
+	// to track them. The players need nothing, JSON sorts the keys of maps.
+	sort.Slice(asteroidStates, func(i, j int) bool { return asteroidStates[i].ID < asteroidStates[j].ID })
+	sort.Slice(projectileStates, func(i, j int) bool { return projectileStates[i].ID < projectileStates[j].ID })
+	sort.Slice(powerupStates, func(i, j int) bool { return powerupStates[i].ID < powerupStates[j].ID })
+	sort.Slice(ufoStates, func(i, j int) bool { return ufoStates[i].ID < ufoStates[j].ID })
+
 	gameStatePayload := AsteroidsStatePayload{
 		Players:     playerStates,
 		Asteroids:   asteroidStates,
 		Projectiles: projectileStates,
+		Powerups:    powerupStates,
+		UFOs:        ufoStates,
+		SuddenDeath: g.suddenDeath,
+		Paused:      g.paused,
+	}
+	if g.paused {
+		gameStatePayload.ReconnectLeftMs = g.reconnectLeft.Milliseconds()
 	}
 
 	// Send to each player
@@ -387,11 +828,28 @@ func (g *AsteroidsGame) sendGameState() {
 		Payload: payloadBytes,
 	}
 
+	if g.recorder != nil {
+		g.recorder.RecordFrame(stateMessage.Type, gameStatePayload)
+	}
+	if sink := g.debugSink.Get(); sink != nil {
+		sink.RecordFrame(stateMessage.Type, gameStatePayload)
+	}
+
 	// fmt.Printf("[Game %s] Sending State: %d players, %d asteroids, %d projectiles\n", g.gameID, len(playerStates), len(asteroidStates), len(projectileStates))
 
-	for pID, p := range g.playerMap {
-		if err := p.SendMessage(stateMessage.Type, gameStatePayload); err != nil { // Send the struct directly if SendMessage handles marshalling
-			log.Printf("[Game %s] Error sending state to player %s: %v", g.gameID, pID, err)
+	// Only built if someone asked for it, most clients wrap on their own
+	var ghostStatePayload *AsteroidsStatePayload
+	for _, p := range g.recipients() {
+		payload := gameStatePayload
+		if game.HasCapability(p, message.CapabilityWrapGhosts) {
+			if ghostStatePayload == nil {
+				withGhosts := g.withWrapGhosts(gameStatePayload)
+				ghostStatePayload = &withGhosts
+			}
+			payload = *ghostStatePayload
+		}
+		if err := p.SendMessage(stateMessage.Type, payload); err != nil { // Send the struct directly if SendMessage handles marshalling
+			log.Printf("[Game %s] Error sending state to player %s: %v", g.gameID, p.GetID(), err)
 			// TODO we could consider to build that
 			// a player gets removed from a game if sending packages to him
 			// fails multiple time
@@ -399,20 +857,170 @@ func (g *AsteroidsGame) sendGameState() {
 	}
 }
 
+// Returns a copy of the state where ships and asteroids that stick out over
+// an edge carry the positions of their copies on the other side.
+// This method requires the playerMux to be (read) locked by the caller.
+func (g *AsteroidsGame) withWrapGhosts(state AsteroidsStatePayload) AsteroidsStatePayload {
+	players := make(map[string]PlayerState, len(state.Players))
+	for id, playerState := range state.Players {
+		if p, ok := g.players[id]; ok {
+			playerState.Ghosts = g.wrapGhosts(p.Pos, p.Radius)
+		}
+		players[id] = playerState
+	}
+	state.Players = players
+
+	asteroids := make([]AsteroidState, len(state.Asteroids))
+	for i, asteroidState := range state.Asteroids {
+		if ast, ok := g.asteroids[asteroidState.ID]; ok {
+			asteroidState.Ghosts = g.wrapGhosts(ast.Pos, ast.Radius)
+		}
+		asteroids[i] = asteroidState
+	}
+	state.Asteroids = asteroids
+	return state
+}
+
 func (g *AsteroidsGame) sendGameOver(winnerID string) {
 	g.playerMux.RLock()
 	defer g.playerMux.RUnlock()
 
 	gameOverPayload := AsteroidsGameOverPayload{
-		Winner: winnerID,
+		Winner:    winnerID,
+		Standings: g.standings(),
+		Stats:     g.playerStats(),
+	}
+
+	if g.recorder != nil {
+		g.recorder.RecordFrame(message.AsteroidsGameOver, gameOverPayload)
 	}
 
 	log.Printf("[Game %s] Sending game over message. Winner: %s", g.gameID, winnerID)
 
-	for pID, p := range g.playerMap {
-		err := p.SendMessage(message.AsteroidsGameOver, gameOverPayload)
+	for _, p := range g.recipients() {
+		// Everyone gets their own copy, so the players can see if they won
+		payload := gameOverPayload
+		if _, isPlayer := g.players[p.GetID()]; isPlayer {
+			payload.Result = playerResult(p.GetID(), winnerID, gameOverPayload.Standings)
+		}
+		err := p.SendMessage(message.AsteroidsGameOver, payload)
 		if err != nil {
-			log.Printf("[Game %s] Error sending game over to player %s: %v", g.gameID, pID, err)
+			log.Printf("[Game %s] Error sending game over to player %s: %v", g.gameID, p.GetID(), err)
+		}
+	}
+}
+
+// Tells a player if they won. On a draw everyone ranked
+// like the best player drew and the rest lost.
+func playerResult(playerID, winnerID string, standings []game.PlayerStanding) string {
+	// Alone there is nobody to beat, dying in the sandbox is a loss even
+	// though determineWinner names the player for the best score
+	if len(standings) == 1 {
+		if standings[0].ID == playerID && standings[0].Survived {
+			return game.RESULT_WIN
+		}
+		return game.RESULT_LOSS
+	}
+	switch winnerID {
+	case playerID:
+		return game.RESULT_WIN
+	case "draw", "":
+		if len(standings) == 0 {
+			return game.RESULT_DRAW
+		}
+		best := standings[0]
+		for _, standing := range standings {
+			if standing.ID == playerID && standing.Survived == best.Survived && standing.Score == best.Score {
+				return game.RESULT_DRAW
+			}
+		}
+		return game.RESULT_LOSS
+	default:
+		return game.RESULT_LOSS
+	}
+}
+
+// The final results table. Needs the playerMux to be (read) locked.
+func (g *AsteroidsGame) standings() []game.PlayerStanding {
+	standings := make([]game.PlayerStanding, 0, len(g.players))
+	for playerID, p := range g.players {
+		standing := game.PlayerStanding{
+			ID:       playerID,
+			Name:     p.Name,
+			Score:    p.Score,
+			Survived: !p.Health.IsDead(),
+		}
+		if player, ok := g.playerMap[playerID]; ok {
+			standing.AvatarURL = player.GetAvatarURL()
+		}
+		standings = append(standings, standing)
+	}
+	// Surviving wins the game, so survivors are always ranked first
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Survived != b.Survived {
+			return a.Survived
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.ID < b.ID
+	})
+	return standings
+}
+
+// Copies the stats of every player, so they can be handed out while the game goes on.
+// Needs the playerMux to be (read) locked.
+func (g *AsteroidsGame) playerStats() map[string]game.PlayerStats {
+	stats := make(map[string]game.PlayerStats, len(g.players))
+	for playerID, p := range g.players {
+		playerStats := p.Stats
+		playerStats.Destroyed = maps.Clone(p.Stats.Destroyed)
+		stats[playerID] = playerStats
+	}
+	return stats
+}
+
+// Sends the scores if any of them changed since the last update.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) sendScoreUpdate() {
+	changed := len(g.sentScores) != len(g.players)
+	for playerID, p := range g.players {
+		if score, ok := g.sentScores[playerID]; !ok || score != p.Score {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	scores := make(map[string]int, len(g.players))
+	for playerID, p := range g.players {
+		scores[playerID] = p.Score
+	}
+	g.sentScores = scores
+	for _, p := range g.recipients() {
+		if err := p.SendMessage(message.AsteroidsScoreUpdate, AsteroidsScoreUpdatePayload{Scores: scores}); err != nil {
+			log.Printf("[Game %s] Error sending score update to player %s: %v", g.gameID, p.GetID(), err)
 		}
 	}
 }
+
+// Everyone that should receive the game messages, players and spectators.
+// Needs the playerMux to be (read) locked.
+func (g *AsteroidsGame) recipients() []game.Player {
+	recipients := make([]game.Player, 0, len(g.playerMap)+len(g.spectators))
+	for _, p := range g.playerMap {
+		recipients = append(recipients, p)
+	}
+	for _, s := range g.spectators {
+		recipients = append(recipients, s)
+	}
+	return recipients
+}
+
+// Compile time checks
+var _ game.Game = (*AsteroidsGame)(nil)
+var _ game.ScoreKeeper = (*AsteroidsGame)(nil)
+var _ game.Leaver = (*AsteroidsGame)(nil)
+var _ game.Rejoiner = (*AsteroidsGame)(nil)
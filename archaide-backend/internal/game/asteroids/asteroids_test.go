@@ -0,0 +1,1116 @@
+package asteroids
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/component"
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/game/gametest"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+func newTestGame(t *testing.T, playerIDs ...string) (*AsteroidsGame, *gametest.FakeFinisher) {
+	t.Helper()
+	finisher := gametest.NewFakeFinisher()
+	g := NewAsteroidsGame(finisher, "test-game", DefaultAsteroidsConfig(), gametest.NewFakeClock())
+	for _, id := range playerIDs {
+		if err := g.AddPlayer(gametest.NewFakePlayer(id)); err != nil {
+			t.Fatalf("adding %s: %v", id, err)
+		}
+	}
+	return g, finisher
+}
+
+func TestSplitLargeAsteroid(t *testing.T) {
+	g, _ := newTestGame(t)
+	large := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+
+	children := g.splitAsteroid(large)
+	if len(children) != ASTEROID_SPLIT_COUNT {
+		t.Fatalf("got %d children, want %d", len(children), ASTEROID_SPLIT_COUNT)
+	}
+	for _, child := range children {
+		if child.Type != MIDDLE {
+			t.Errorf("child %s has type %s, want %s", child.ID, child.Type, MIDDLE)
+		}
+	}
+}
+
+func TestSplitFollowsTheConfiguredCountAndSpread(t *testing.T) {
+	g, _ := newTestGame(t)
+	g.config.SplitCount = 2
+	g.config.SplitAngleVariance = 10
+	large := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+	large.Dir = component.NewVector2D(1, 0)
+
+	children := g.splitAsteroid(large)
+	if len(children) != 2 {
+		t.Fatalf("got %d children, want 2", len(children))
+	}
+	for _, child := range children {
+		angle := math.Atan2(child.Dir.Y, child.Dir.X) * 180 / math.Pi
+		if math.Abs(math.Abs(angle)-10) > 1e-9 {
+			t.Errorf("child flies at %.4f°, want ±10°", angle)
+		}
+	}
+
+	// Without pieces the asteroid just vanishes
+	g.config.SplitCount = 0
+	if children := g.splitAsteroid(g.spawnAsteroid(component.NewVector2D(300, 300), LARGE)); len(children) != 0 {
+		t.Errorf("got %d children with a split count of 0", len(children))
+	}
+}
+
+func TestSplitConservesMomentum(t *testing.T) {
+	g, _ := newTestGame(t)
+	large := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+	large.Dir = component.NewVector2D(1, 1).Normalize()
+	large.Speed = 80
+
+	children := g.splitAsteroid(large)
+	if len(children) == 0 {
+		t.Fatal("large asteroid did not split")
+	}
+	average := component.Vector2D{}
+	for _, child := range children {
+		average = average.Add(child.Dir.Mul(child.Speed))
+	}
+	average = average.Mul(1 / float64(len(children)))
+
+	// Same heading as the parent, faster by the size like spawned asteroids
+	parent := large.Dir.Mul(large.Speed * asteroidSpeedFactor(MIDDLE))
+	if diff := average.Sub(parent).Len(); diff > 1e-6 {
+		t.Errorf("average child velocity %v differs from %v by %.6f", average, parent, diff)
+	}
+	for _, child := range children {
+		if child.Speed <= large.Speed {
+			t.Errorf("piece flies at %.2f, want it faster than its parent at %.2f", child.Speed, large.Speed)
+		}
+	}
+}
+
+func TestSmallAsteroidDoesNotSplit(t *testing.T) {
+	g, _ := newTestGame(t)
+	small := g.spawnAsteroid(component.NewVector2D(100, 100), SMALL)
+
+	if children := g.splitAsteroid(small); len(children) != 0 {
+		t.Errorf("small asteroid split into %d children, want 0", len(children))
+	}
+}
+
+func TestLastPlayerAliveWins(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	g.players["p2"].Health.Damage(INITIAL_PLAYER_HEALTH)
+
+	gameOver, winnerID := g.checkGameOver()
+	if !gameOver || winnerID != "p1" {
+		t.Errorf("checkGameOver() = %v, %q, want true, \"p1\"", gameOver, winnerID)
+	}
+	if got := g.determineWinner(); got != "p1" {
+		t.Errorf("determineWinner() = %q, want \"p1\"", got)
+	}
+}
+
+func TestSoloGameEndsWhenThePlayerDies(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+
+	if gameOver, _ := g.checkGameOver(); gameOver {
+		t.Fatal("solo game is over while the player is still alive")
+	}
+
+	g.players["p1"].Health.Damage(INITIAL_PLAYER_HEALTH)
+	if gameOver, winnerID := g.checkGameOver(); !gameOver || winnerID != "" {
+		t.Errorf("checkGameOver() = %v, %q, want true, \"\"", gameOver, winnerID)
+	}
+}
+
+// Blows up as soon as the game sends it anything
+func TestGameEndsWhenOnlyBotsAreLeft(t *testing.T) {
+	g, finisher := newTestGame(t, "p1")
+	g.config.ReconnectGrace = 10 * time.Second
+	bots := []*AsteroidsBot{NewAsteroidsBot(g), NewAsteroidsBot(g)}
+	for _, bot := range bots {
+		if err := g.AddPlayer(bot); err != nil {
+			t.Fatalf("adding bot: %v", err)
+		}
+	}
+	g.isRunning = true
+
+	// Even a player that may come back is not waited for by bots alone
+	g.RemovePlayer(g.playerMap["p1"])
+	if g.paused {
+		t.Error("bots wait for the last player")
+	}
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("game kept running with only bots left")
+	}
+	for _, bot := range bots {
+		select {
+		case <-bot.done:
+		default:
+			t.Errorf("bot %s still runs after the game ended", bot.id)
+		}
+	}
+}
+
+func TestStopEndsTheBots(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	bot := NewAsteroidsBot(g)
+	if err := g.AddPlayer(bot); err != nil {
+		t.Fatalf("adding bot: %v", err)
+	}
+	g.isRunning = true
+
+	g.Stop()
+	select {
+	case <-bot.done:
+	default:
+		t.Fatal("bot still runs after the game was stopped")
+	}
+	// A game over after the stop must not close it twice
+	bot.SendMessage(message.AsteroidsGameOver, AsteroidsGameOverPayload{})
+}
+
+func TestPanicInGameLoopFinishesGame(t *testing.T) {
+	g, finisher := newTestGame(t, "p1")
+	if err := g.AddPlayer(gametest.NewPanickingPlayer("p2")); err != nil {
+		t.Fatalf("adding p2: %v", err)
+	}
+	// Runs the real game loop, so it needs real ticks
+	g.clock = game.RealClock{}
+
+	go g.Start()
+
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("GameFinished was not called after the game loop panicked")
+	}
+	if result, _ := finisher.Result(); len(result.Scores) != 0 {
+		t.Errorf("got scores %v, want an empty result", result.Scores)
+	}
+	// The lock has to be released again, otherwise this blocks forever
+	g.playerMux.Lock()
+	running := g.isRunning
+	g.playerMux.Unlock()
+	if running {
+		t.Error("game is still marked as running")
+	}
+}
+
+// Takes delay of the fake clock for every state it gets, like a slow network write
+type slowPlayer struct {
+	*gametest.FakePlayer
+	clock *gametest.FakeClock
+	delay time.Duration
+}
+
+func (p *slowPlayer) SendMessage(msgType message.MessageType, payload any) error {
+	if msgType == message.AsteroidsState {
+		p.clock.Advance(p.delay)
+	}
+	return p.FakePlayer.SendMessage(msgType, payload)
+}
+
+func TestSlowTicksOnlySendEveryOtherState(t *testing.T) {
+	clock := gametest.NewFakeClock()
+	g := NewAsteroidsGame(gametest.NewFakeFinisher(), "test-game", DefaultAsteroidsConfig(), clock)
+	slow := &slowPlayer{gametest.NewFakePlayer("p1"), clock, 2 * TICK_RATE}
+	g.AddPlayer(slow)
+	g.AddPlayer(gametest.NewFakePlayer("p2"))
+
+	for range game.SLOW_TICKS_TO_DEGRADE {
+		g.tick(TICK_RATE.Seconds())
+	}
+	if !g.tickMonitor.Degraded() {
+		t.Fatalf("game is not degraded after %d slow ticks", game.SLOW_TICKS_TO_DEGRADE)
+	}
+
+	slow.Reset()
+	for range 10 {
+		g.tick(TICK_RATE.Seconds())
+	}
+	if got := len(slow.MessagesOfType(message.AsteroidsState)); got != 5 {
+		t.Errorf("got %d states in 10 ticks, want 5", got)
+	}
+
+	// Fast again, every state is sent after a while
+	slow.delay = 0
+	for range 2 * game.FAST_TICKS_TO_RECOVER {
+		g.tick(TICK_RATE.Seconds())
+	}
+	if g.tickMonitor.Degraded() {
+		t.Error("game is still degraded after the ticks got fast again")
+	}
+}
+
+func TestPlayerAsteroidCollisionThreshold(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.Pos = component.NewVector2D(400, 300)
+	large := g.spawnAsteroid(component.NewVector2D(0, 0), LARGE)
+
+	// Ship 15 * 0.8 + large asteroid 30 * 0.9
+	const threshold = 39.0
+	if got := g.playerHitbox(p) + g.asteroidHitbox(large); got != threshold {
+		t.Fatalf("collision threshold = %.2f, want %.2f", got, threshold)
+	}
+
+	tests := []struct {
+		distance float64
+		want     bool
+	}{
+		{threshold - 0.5, true},
+		{threshold + 0.5, false},
+		{p.Radius + large.Radius - 1, false}, // Touching the drawn circles is not a hit anymore
+	}
+	for _, tt := range tests {
+		large.Pos = p.Pos.Add(component.NewVector2D(tt.distance, 0))
+		if got := g.checkCollision(p.Pos, large.Pos, g.playerHitbox(p), g.asteroidHitbox(large)); got != tt.want {
+			t.Errorf("collision at distance %.1f = %v, want %v", tt.distance, got, tt.want)
+		}
+	}
+}
+
+func TestProjectileAsteroidCollisionThreshold(t *testing.T) {
+	g, _ := newTestGame(t)
+	small := g.spawnAsteroid(component.NewVector2D(100, 100), SMALL)
+	proj := &Projectile{Pos: component.NewVector2D(100, 100), Radius: PROJECTILE_RADIUS}
+
+	// Projectile 3 * 1.0 + small asteroid 10 * 0.9
+	const threshold = 12.0
+	if got := g.projectileHitbox(proj) + g.asteroidHitbox(small); got != threshold {
+		t.Fatalf("collision threshold = %.2f, want %.2f", got, threshold)
+	}
+}
+
+func TestProjectileDespawnsAtEdgeWithoutWrapping(t *testing.T) {
+	g, _ := newTestGame(t)
+	g.config.WrapProjectiles = false
+	g.projectiles["p"] = &Projectile{
+		ID:        "p",
+		Pos:       component.NewVector2D(WORLD_WIDTH-1, 300),
+		Dir:       component.NewVector2D(1, 0),
+		Speed:     PROJECTILE_SPEED,
+		SpawnTime: g.clock.Now(),
+		Radius:    PROJECTILE_RADIUS,
+	}
+
+	g.update(0.05)
+
+	if proj, exists := g.projectiles["p"]; exists {
+		t.Errorf("projectile still exists at %v, want it removed at the right edge", proj.Pos)
+	}
+}
+
+func TestProjectileWrapsByDefault(t *testing.T) {
+	g, _ := newTestGame(t)
+	g.projectiles["p"] = &Projectile{
+		ID:        "p",
+		Pos:       component.NewVector2D(WORLD_WIDTH-1, 300),
+		Dir:       component.NewVector2D(1, 0),
+		Speed:     PROJECTILE_SPEED,
+		SpawnTime: g.clock.Now(),
+		Radius:    PROJECTILE_RADIUS,
+	}
+
+	g.update(0.05)
+
+	proj, exists := g.projectiles["p"]
+	if !exists {
+		t.Fatal("projectile was removed, want it wrapped to the left")
+	}
+	if proj.Pos.X >= WORLD_WIDTH/2 {
+		t.Errorf("projectile is at x=%.1f, want it on the left side", proj.Pos.X)
+	}
+}
+
+func TestProjectileRangeIsSpeedTimesLifetime(t *testing.T) {
+	config := DefaultAsteroidsConfig()
+	config.ProjectileSpeed = 500
+	config.ProjectileLifetime = 1200 * time.Millisecond
+	// Nothing in the way of the projectile
+	config.MaxAsteroids = 0
+	config.UFOSpawnInterval = 0
+	clock := gametest.NewFakeClock()
+	g := NewAsteroidsGame(gametest.NewFakeFinisher(), "test-game", config, clock)
+	g.AddPlayer(gametest.NewFakePlayer("p1"))
+	p := g.players["p1"]
+	p.Pos = component.NewVector2D(400, 300)
+	p.Dir = component.NewVector2D(1, 0)
+	g.spawnProjectile(p)
+	if len(g.projectiles) != 1 {
+		t.Fatalf("got %d projectiles, want 1", len(g.projectiles))
+	}
+	var proj *Projectile
+	for _, spawned := range g.projectiles {
+		proj = spawned
+	}
+	start := proj.Pos
+
+	// 600 units to the right, so it crosses the right edge once
+	step := 100 * time.Millisecond
+	for range 12 {
+		clock.Advance(step)
+		g.update(step.Seconds())
+	}
+	if _, alive := g.projectiles[proj.ID]; !alive {
+		t.Fatal("projectile expired before its lifetime was over")
+	}
+	want := g.wrapPosition(start.Add(component.NewVector2D(config.ProjectileRange(), 0)))
+	if math.Abs(proj.Pos.X-want.X) > 1e-6 || proj.Pos.Y != want.Y {
+		t.Errorf("projectile is at %v, want %v", proj.Pos, want)
+	}
+
+	clock.Advance(step)
+	g.update(step.Seconds())
+	if _, alive := g.projectiles[proj.ID]; alive {
+		t.Error("projectile outlived its lifetime")
+	}
+}
+
+func TestLongStallDoesNotTeleportAsteroids(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	ast := g.spawnAsteroid(component.NewVector2D(400, 300), LARGE)
+	ast.Dir = component.NewVector2D(1, 0)
+	start := ast.Pos
+
+	// A 10 second stall, e.g. the process was suspended
+	g.tick(10)
+
+	maxStep := ast.Speed * g.config.MaxTickDelta * g.config.TickRate.Seconds()
+	if moved := g.wrappedDistanceSq(start, ast.Pos); moved > maxStep*maxStep+1e-9 {
+		t.Errorf("asteroid moved %.1f units, want at most %.1f", math.Sqrt(moved), maxStep)
+	}
+}
+
+func TestPlayerTurnsAtConfiguredSpeed(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.Dir = component.NewVector2D(1, 0)
+	p.HandleInput(AsteroidsInputPayload{Right: true}, g.clock.Now())
+
+	// Half a second at 180°/sec has to be a quarter turn
+	g.update(0.5)
+
+	turned := math.Atan2(p.Dir.Y, p.Dir.X) * 180 / math.Pi
+	if math.Abs(turned-90) > 1e-9 {
+		t.Errorf("player turned %.4f°, want 90°", turned)
+	}
+}
+
+func TestDoubleHitAwardsClosestProjectile(t *testing.T) {
+	// Map iteration is random, so a single run could pass by chance
+	for range 20 {
+		g, _ := newTestGame(t, "p1", "p2")
+		ast := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+		ast.Speed = 0
+		g.projectiles["far"] = &Projectile{
+			ID: "far", OwnerID: "p1", Pos: component.NewVector2D(100+ast.Radius*0.8, 100),
+			Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+		}
+		g.projectiles["close"] = &Projectile{
+			ID: "close", OwnerID: "p2", Pos: component.NewVector2D(100, 100+ast.Radius*0.2),
+			Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+		}
+
+		g.update(0)
+
+		if p1, p2 := g.players["p1"].Score, g.players["p2"].Score; p1 != 0 || p2 != g.config.PointsLarge {
+			t.Fatalf("scores p1=%d p2=%d, want the kill for p2 with the closer projectile", p1, p2)
+		}
+		if _, exists := g.projectiles["far"]; !exists {
+			t.Fatal("the projectile that missed the kill was removed")
+		}
+	}
+}
+
+func TestToughAsteroidBreaksWithTheLastHit(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	g.config.HealthLarge = 3
+	ast := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+	ast.Speed = 0
+
+	for shot := 1; shot <= 3; shot++ {
+		g.projectiles["shot"] = &Projectile{
+			ID: "shot", OwnerID: "p1", Pos: component.NewVector2D(100, 100),
+			Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+		}
+		g.update(0)
+
+		if _, exists := g.projectiles["shot"]; exists {
+			t.Fatalf("shot %d was not used up by the hit", shot)
+		}
+		_, exists := g.asteroids[ast.ID]
+		if shot < 3 {
+			if !exists || ast.Health.HP != float64(3-shot) {
+				t.Fatalf("after shot %d the asteroid exists=%v with %.0f health, want it there with %d", shot, exists, ast.Health.HP, 3-shot)
+			}
+			if score := g.players["p1"].Score; score != 0 {
+				t.Fatalf("shot %d already scored %d", shot, score)
+			}
+		} else if exists {
+			t.Fatal("asteroid survived its last point of health")
+		}
+	}
+	if score := g.players["p1"].Score; score != g.config.PointsLarge {
+		t.Errorf("score = %d, want %d for breaking it", score, g.config.PointsLarge)
+	}
+	// The refill spawns large ones, the pieces are the middle ones
+	pieces := 0
+	for _, other := range g.asteroids {
+		if other.Type == MIDDLE {
+			pieces++
+		}
+	}
+	if pieces != ASTEROID_SPLIT_COUNT {
+		t.Errorf("got %d pieces, want %d", pieces, ASTEROID_SPLIT_COUNT)
+	}
+}
+
+func TestDoubleHitAtSameDistanceAwardsEarlierProjectile(t *testing.T) {
+	for range 20 {
+		g, _ := newTestGame(t, "p1", "p2")
+		ast := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+		ast.Speed = 0
+		offset := ast.Radius * 0.5
+		g.projectiles["late"] = &Projectile{
+			ID: "late", OwnerID: "p1", Pos: component.NewVector2D(100+offset, 100),
+			Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+		}
+		g.projectiles["early"] = &Projectile{
+			ID: "early", OwnerID: "p2", Pos: component.NewVector2D(100-offset, 100),
+			Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now().Add(-time.Second),
+		}
+
+		g.update(0)
+
+		if p1, p2 := g.players["p1"].Score, g.players["p2"].Score; p1 != 0 || p2 != g.config.PointsLarge {
+			t.Fatalf("scores p1=%d p2=%d, want the kill for p2 who fired first", p1, p2)
+		}
+	}
+}
+
+func TestProjectilesOfALeavingPlayerDespawn(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2", "p3")
+	ast := g.spawnAsteroid(component.NewVector2D(100, 100), LARGE)
+	ast.Speed = 0
+	g.projectiles["gone"] = &Projectile{
+		ID: "gone", OwnerID: "p1", Pos: ast.Pos,
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+	g.projectiles["stays"] = &Projectile{
+		ID: "stays", OwnerID: "p2", Pos: component.NewVector2D(500, 500),
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+
+	g.RemovePlayer(g.playerMap["p1"])
+	g.update(0)
+
+	if _, exists := g.projectiles["gone"]; exists {
+		t.Error("projectile of the player that left is still flying")
+	}
+	if _, exists := g.asteroids[ast.ID]; !exists {
+		t.Error("asteroid was destroyed by a projectile of the player that left")
+	}
+	if _, exists := g.projectiles["stays"]; !exists {
+		t.Error("projectile of another player was removed")
+	}
+}
+
+func TestShootingDownUFOAwardsBonus(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	ufo := g.spawnUFO(g.clock.Now())
+	ufo.Pos = component.NewVector2D(400, 100)
+	ufo.Speed = 0
+	g.projectiles["p"] = &Projectile{
+		ID: "p", OwnerID: "p1", Pos: component.NewVector2D(400, 100+ufo.Radius*0.5),
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+
+	g.update(0)
+
+	if _, exists := g.ufos[ufo.ID]; exists {
+		t.Error("UFO survived the hit")
+	}
+	if got := g.players["p1"].Score; got != g.config.PointsUFO {
+		t.Errorf("score = %d, want the UFO bonus of %d", got, g.config.PointsUFO)
+	}
+}
+
+func TestUFOProjectileDamagesPlayer(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.IsInvincible = false
+	p.Pos = component.NewVector2D(100, 100)
+	g.projectiles["u"] = &Projectile{
+		ID: "u", OwnerID: "ufo", Hostile: true, Pos: p.Pos,
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+
+	g.update(0)
+
+	if got, want := p.Health.HP, g.config.PlayerHealth-1; got != want {
+		t.Errorf("health = %.0f, want %.0f", got, want)
+	}
+	if _, exists := g.projectiles["u"]; exists {
+		t.Error("UFO projectile still exists after hitting the player")
+	}
+}
+
+func TestUFOProjectileFliesThroughAsteroids(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	g.players["p1"].Pos = component.NewVector2D(100, 100)
+	ast := g.spawnAsteroid(component.NewVector2D(400, 400), LARGE)
+	ast.Speed = 0
+	g.projectiles["u"] = &Projectile{
+		ID: "u", OwnerID: "ufo", Hostile: true, Pos: ast.Pos,
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+
+	g.update(0)
+
+	if _, exists := g.asteroids[ast.ID]; !exists || ast.Health.HP != ast.Health.MaxHP {
+		t.Error("UFO projectile damaged an asteroid")
+	}
+	if _, exists := g.projectiles["u"]; !exists {
+		t.Error("UFO projectile was used up by an asteroid")
+	}
+}
+
+func TestShipCollidesWithAnyOfSeveralAsteroids(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.IsInvincible = false
+	p.Pos = component.NewVector2D(100, 100)
+	// Plenty of asteroids far away, only one of them touches the ship
+	for i := range 10 {
+		far := g.spawnAsteroid(component.NewVector2D(300+float64(i)*40, 500), SMALL)
+		far.Speed = 0
+	}
+	touching := g.spawnAsteroid(p.Pos, SMALL)
+	touching.Speed = 0
+
+	g.update(0)
+
+	if got, want := p.Health.HP, g.config.PlayerHealth-1; got != want {
+		t.Errorf("health = %.0f, want %.0f after touching an asteroid", got, want)
+	}
+	if _, exists := g.asteroids[touching.ID]; exists {
+		t.Error("the asteroid the ship touched is still there")
+	}
+	if len(g.asteroids) < 10 {
+		t.Errorf("%d asteroids left, the ones far away must not break", len(g.asteroids))
+	}
+}
+
+func TestPlayerResult(t *testing.T) {
+	alive := func(id string, score int) game.PlayerStanding {
+		return game.PlayerStanding{ID: id, Score: score, Survived: true}
+	}
+	dead := func(id string, score int) game.PlayerStanding {
+		return game.PlayerStanding{ID: id, Score: score}
+	}
+	tests := []struct {
+		name      string
+		playerID  string
+		winnerID  string
+		standings []game.PlayerStanding
+		want      string
+	}{
+		{"survivor wins", "p1", "p1", []game.PlayerStanding{alive("p1", 10), dead("p2", 50)}, game.RESULT_WIN},
+		{"the other one loses", "p2", "p1", []game.PlayerStanding{alive("p1", 10), dead("p2", 50)}, game.RESULT_LOSS},
+		{"top scorers draw", "p1", "draw", []game.PlayerStanding{dead("p1", 30), dead("p2", 30), dead("p3", 10)}, game.RESULT_DRAW},
+		{"below the top scorers loses", "p3", "draw", []game.PlayerStanding{dead("p1", 30), dead("p2", 30), dead("p3", 10)}, game.RESULT_LOSS},
+		{"solo survivor wins", "p1", "p1", []game.PlayerStanding{alive("p1", 10)}, game.RESULT_WIN},
+		{"solo death loses", "p1", "p1", []game.PlayerStanding{dead("p1", 10)}, game.RESULT_LOSS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := playerResult(tt.playerID, tt.winnerID, tt.standings); got != tt.want {
+				t.Errorf("playerResult() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSoloDeathIsALoss(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	player := g.playerMap["p1"].(*gametest.FakePlayer)
+	g.players["p1"].Score = 40
+	g.players["p1"].Health.Damage(INITIAL_PLAYER_HEALTH)
+
+	g.sendGameOver(g.determineWinner())
+
+	var payload AsteroidsGameOverPayload
+	if !player.Last(message.AsteroidsGameOver, &payload) {
+		t.Fatal("no game over message sent")
+	}
+	if payload.Result != game.RESULT_LOSS {
+		t.Errorf("result = %q, want %q", payload.Result, game.RESULT_LOSS)
+	}
+}
+
+func TestShipDriftsAfterThrust(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.Dir = component.NewVector2D(1, 0)
+	p.HandleInput(AsteroidsInputPayload{Up: true}, g.clock.Now())
+	g.update(0.1)
+
+	if p.Vel.X <= 0 {
+		t.Fatalf("velocity is %v after thrusting, want it to point along the nose", p.Vel)
+	}
+	thrustSpeed := p.Vel.Len()
+
+	p.HandleInput(AsteroidsInputPayload{}, g.clock.Now())
+	start := p.Pos
+	g.update(0.1)
+
+	if p.Pos.X <= start.X {
+		t.Error("ship stopped right after releasing the thrust")
+	}
+	if p.Vel.Len() >= thrustSpeed {
+		t.Errorf("speed went from %.2f to %.2f without thrust, want drag to slow it down", thrustSpeed, p.Vel.Len())
+	}
+
+	g.respawnPlayer(p)
+	if p.Vel.LengthSq() != 0 {
+		t.Errorf("velocity is %v after respawning, want zero", p.Vel)
+	}
+}
+
+func TestCollisionAcrossTheWrapSeam(t *testing.T) {
+	tests := []struct {
+		name       string
+		pos1, pos2 component.Vector2D
+		collide    bool
+	}{
+		{"left and right edge", component.NewVector2D(5, 300), component.NewVector2D(WORLD_WIDTH-5, 300), true},
+		{"top and bottom edge", component.NewVector2D(400, 2), component.NewVector2D(400, WORLD_HEIGHT-2), true},
+		{"opposite corners", component.NewVector2D(3, 3), component.NewVector2D(WORLD_WIDTH-3, WORLD_HEIGHT-3), true},
+		{"far apart across the seam", component.NewVector2D(50, 300), component.NewVector2D(WORLD_WIDTH-50, 300), false},
+	}
+	g, _ := newTestGame(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.checkCollision(tt.pos1, tt.pos2, 10, 10); got != tt.collide {
+				t.Errorf("checkCollision(%v, %v) = %v, want %v", tt.pos1, tt.pos2, got, tt.collide)
+			}
+		})
+	}
+}
+
+func TestProjectileHitsAsteroidAcrossTheSeam(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	ast := g.spawnAsteroid(component.NewVector2D(5, 300), LARGE)
+	ast.Speed = 0
+	g.projectiles["p"] = &Projectile{
+		ID: "p", OwnerID: "p1", Pos: component.NewVector2D(WORLD_WIDTH-5, 300),
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+
+	g.update(0)
+
+	if _, exists := g.asteroids[ast.ID]; exists {
+		t.Error("asteroid on the left edge was not hit by the projectile on the right edge")
+	}
+	if got := g.players["p1"].Score; got != g.config.PointsLarge {
+		t.Errorf("score = %d, want %d", got, g.config.PointsLarge)
+	}
+}
+
+func TestStatsCountShotsAndHits(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	p := g.players["p1"]
+	p.Pos = component.NewVector2D(100, 300)
+	p.Dir = component.NewVector2D(1, 0)
+	g.spawnProjectile(p)
+	ast := g.spawnAsteroid(component.NewVector2D(400, 100), MIDDLE)
+	ast.Speed = 0
+	g.projectiles["p"] = &Projectile{
+		ID: "p", OwnerID: "p1", Pos: ast.Pos,
+		Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now(),
+	}
+	p.Stats.ShotsFired++
+
+	g.update(0)
+
+	stats := g.finish().Stats["p1"]
+	if stats.ShotsFired != 2 || stats.Hits != 1 || stats.Destroyed[string(MIDDLE)] != 1 {
+		t.Errorf("got stats %+v, want 2 shots and 1 middle asteroid destroyed", stats)
+	}
+	if stats.Accuracy() != 0.5 {
+		t.Errorf("accuracy = %v, want 0.5", stats.Accuracy())
+	}
+}
+
+func TestLeaderWinsWhenTimeIsUp(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	g.players["p1"].Score = 100
+	g.players["p2"].Score = 100
+	g.matchTime = g.config.MaxDuration.Seconds()
+
+	if gameOver, _ := g.checkGameOver(); gameOver || !g.suddenDeath {
+		t.Fatalf("gameOver = %v, suddenDeath = %v, want a tie to go to sudden death", gameOver, g.suddenDeath)
+	}
+
+	g.players["p1"].Score += g.config.PointsSmall
+	if gameOver, winnerID := g.checkGameOver(); !gameOver || winnerID != "p1" {
+		t.Errorf("checkGameOver() = %v, %q, want true, \"p1\"", gameOver, winnerID)
+	}
+}
+
+func TestWrappingUsesTheWorldSizeOfTheMatch(t *testing.T) {
+	finisher := gametest.NewFakeFinisher()
+	config := DefaultAsteroidsConfig()
+	config.WorldWidth = 1600
+	config.WorldHeight = 1200
+	g := NewAsteroidsGame(finisher, "big-game", config, gametest.NewFakeClock())
+
+	// Outside the default world, but still inside this one
+	inside := component.NewVector2D(1000, 900)
+	if got := g.wrapPosition(inside); got != inside {
+		t.Errorf("wrapPosition(%v) = %v, want it unchanged", inside, got)
+	}
+	if got := g.wrapPosition(component.NewVector2D(1605, -5)); got != component.NewVector2D(5, 1195) {
+		t.Errorf("wrapPosition(1605, -5) = %v, want (5, 1195)", got)
+	}
+	if !g.checkCollision(component.NewVector2D(2, 600), component.NewVector2D(1598, 600), 5, 5) {
+		t.Error("no collision across the seam of the bigger world")
+	}
+}
+
+func TestScoreUpdateOnlyWhenAScoreChanges(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	p1 := g.playerMap["p1"].(*gametest.FakePlayer)
+
+	g.tick(0)
+	g.tick(0)
+	if got := len(p1.MessagesOfType(message.AsteroidsScoreUpdate)); got != 1 {
+		t.Fatalf("got %d score updates without a change, want only the initial one", got)
+	}
+
+	g.players["p2"].Score += g.config.PointsLarge
+	g.tick(0)
+	var update AsteroidsScoreUpdatePayload
+	if !p1.Last(message.AsteroidsScoreUpdate, &update) {
+		t.Fatal("no score update after p2 scored")
+	}
+	if len(p1.MessagesOfType(message.AsteroidsScoreUpdate)) != 2 || update.Scores["p2"] != g.config.PointsLarge {
+		t.Errorf("got %v, want one more update with p2 at %d", update.Scores, g.config.PointsLarge)
+	}
+}
+
+func TestHeadOnAsteroidsBounceBack(t *testing.T) {
+	g, _ := newTestGame(t)
+	g.config.AsteroidCollisions = true
+	a := g.spawnAsteroid(component.NewVector2D(200, 200), MIDDLE)
+	b := g.spawnAsteroid(component.NewVector2D(200+a.Radius, 200), MIDDLE)
+	a.Dir, a.Speed = component.NewVector2D(1, 0), 50
+	b.Dir, b.Speed = component.NewVector2D(-1, 0), 50
+
+	g.bounceAsteroids()
+
+	if a.Dir.X >= 0 || b.Dir.X <= 0 {
+		t.Fatalf("asteroids did not reverse, directions %v and %v", a.Dir, b.Dir)
+	}
+	// Same size and speed, so they swap their velocities
+	if math.Abs(a.Speed-50) > 1e-9 || math.Abs(b.Speed-50) > 1e-9 {
+		t.Errorf("speeds changed to %.2f and %.2f, want 50", a.Speed, b.Speed)
+	}
+
+	// Right after the bounce they still overlap, but must not bounce back together
+	g.bounceAsteroids()
+	if a.Dir.X >= 0 || b.Dir.X <= 0 {
+		t.Errorf("separating asteroids bounced again, directions %v and %v", a.Dir, b.Dir)
+	}
+}
+
+func TestLosingTheLastLifeAnnouncesElimination(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	observer := &gametest.FakeObserver{}
+	g.SetObserver(observer)
+	p2 := g.playerMap["p2"].(*gametest.FakePlayer)
+
+	g.hitPlayer(g.players["p1"])
+	if len(p2.MessagesOfType(message.AsteroidsEliminated)) != 0 {
+		t.Fatal("elimination was announced with lives left")
+	}
+
+	g.players["p1"].Score = 42
+	g.players["p1"].Health.HP = 1
+	g.hitPlayer(g.players["p1"])
+
+	var payload AsteroidsEliminatedPayload
+	if !p2.Last(message.AsteroidsEliminated, &payload) {
+		t.Fatal("p2 was not told that p1 is out")
+	}
+	if payload.PlayerID != "p1" || payload.Score != 42 {
+		t.Errorf("got elimination %+v, want p1 with a score of 42", payload)
+	}
+	if events := observer.Events(); !slices.Equal(events, []string{"eliminated p1"}) {
+		t.Errorf("observer got %v, want the elimination of p1", events)
+	}
+}
+
+func TestConcurrentRemovalsFinishGameOnce(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		ids := []string{"p1", "p2", "p3", "p4"}
+		g, finisher := newTestGame(t, ids...)
+		g.isRunning = true
+
+		players := make([]game.Player, 0, len(ids))
+		for _, id := range ids {
+			players = append(players, g.playerMap[id])
+		}
+
+		var wg sync.WaitGroup
+		for _, player := range players {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.RemovePlayer(player)
+			}()
+		}
+		// The hub may also stop the game while the players leave
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Stop()
+		}()
+		wg.Wait()
+
+		select {
+		case <-finisher.Done():
+		case <-time.After(time.Second):
+			t.Fatal("GameFinished was not called")
+		}
+		// Give a second notification the chance to arrive
+		time.Sleep(time.Millisecond)
+		if calls := len(finisher.Calls()); calls != 1 {
+			t.Fatalf("GameFinished was called %d times, want 1", calls)
+		}
+	}
+}
+
+func TestReconnectWithinTheGraceResumesTheGame(t *testing.T) {
+	g, finisher := newTestGame(t, "p1", "p2")
+	g.config.ReconnectGrace = 10 * time.Second
+	g.config.MaxTickDelta = 0 // Whole seconds per tick
+	g.isRunning = true
+	ast := g.spawnAsteroid(component.NewVector2D(400, 300), LARGE)
+	g.players["p1"].Score = 120
+	shipPos := g.players["p1"].Pos
+
+	g.RemovePlayer(g.playerMap["p1"])
+	if !g.paused {
+		t.Fatal("game did not wait for the player that dropped")
+	}
+	g.tick(1)
+
+	// Nothing moves while the game waits, the others see that it is paused
+	if ast.Pos != component.NewVector2D(400, 300) {
+		t.Errorf("asteroid moved to %v during the pause", ast.Pos)
+	}
+	var state AsteroidsStatePayload
+	g.playerMap["p2"].(*gametest.FakePlayer).Last(message.AsteroidsState, &state)
+	if !state.Paused || state.ReconnectLeftMs != 9000 {
+		t.Errorf("got paused %v with %dms left, want paused with 9000ms left", state.Paused, state.ReconnectLeftMs)
+	}
+
+	back := gametest.NewFakePlayer("p1")
+	if !g.RejoinPlayer(back) {
+		t.Fatal("game did not take the player back")
+	}
+	if g.paused {
+		t.Fatal("game is still paused after the player came back")
+	}
+	if p1 := g.players["p1"]; p1.Score != 120 || p1.Pos != shipPos {
+		t.Errorf("p1 came back with %d points at %v, want 120 at %v", p1.Score, p1.Pos, shipPos)
+	}
+	if len(back.MessagesOfType(message.AsteroidsConfig)) != 1 {
+		t.Error("returning player did not get the config of the world")
+	}
+	if gameOver := g.tick(0.1); gameOver || len(finisher.Calls()) != 0 {
+		t.Error("game ended although the player came back in time")
+	}
+}
+
+func TestNobodyWaitsForAPlayerWhoLeaves(t *testing.T) {
+	g, finisher := newTestGame(t, "p1", "p2")
+	g.config.ReconnectGrace = 10 * time.Second
+	g.isRunning = true
+
+	g.LeavePlayer(g.playerMap["p1"])
+	if g.paused {
+		t.Error("game waits for a player who left on purpose")
+	}
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("game did not end with only one player left")
+	}
+}
+
+func TestGameEndsWhenTheGraceRunsOut(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	g.config.ReconnectGrace = time.Second
+	g.config.MaxTickDelta = 0
+	g.isRunning = true
+
+	g.RemovePlayer(g.playerMap["p1"])
+	if gameOver := g.tick(0.5); gameOver {
+		t.Fatal("game ended before the grace period was over")
+	}
+	if gameOver := g.tick(0.6); !gameOver {
+		t.Fatal("game still waits after the grace period")
+	}
+	if winner := g.determineWinner(); winner != "p2" {
+		t.Errorf("winner = %q, want the player that stayed", winner)
+	}
+}
+
+func TestStartAfterStopDoesNothing(t *testing.T) {
+	g, finisher := newTestGame(t, "p1", "p2")
+
+	g.Stop()
+	g.Stop()
+	// Would block in the game loop if it started
+	g.Start()
+
+	if calls := len(finisher.Calls()); calls != 1 {
+		t.Fatalf("GameFinished was called %d times, want 1", calls)
+	}
+	if g.isRunning {
+		t.Error("stopped game started running")
+	}
+}
+
+func TestSplittingNeverExceedsMaxAsteroids(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	g.config.MaxAsteroids = 10
+	g.players["p1"].IsInvincible = true
+	for i := range 8 {
+		g.spawnAsteroid(component.NewVector2D(100+float64(i)*100, 300), LARGE)
+	}
+
+	// Every tick each asteroid gets shot, so they all break at the same time
+	for range 5 {
+		for _, ast := range g.asteroids {
+			proj := &Projectile{ID: "shot-" + ast.ID, OwnerID: "p1", Pos: ast.Pos, Radius: PROJECTILE_RADIUS, SpawnTime: g.clock.Now()}
+			g.projectiles[proj.ID] = proj
+		}
+		g.update(0)
+		if len(g.asteroids) > g.config.MaxAsteroids {
+			t.Fatalf("got %d asteroids, want at most %d", len(g.asteroids), g.config.MaxAsteroids)
+		}
+	}
+}
+
+// A client that asked for the wrap ghosts in its hello
+type ghostPlayer struct {
+	*gametest.FakePlayer
+}
+
+func (p ghostPlayer) HasCapability(capability string) bool {
+	return capability == message.CapabilityWrapGhosts
+}
+
+func TestWrapGhostsOnlyForClientsThatAskForThem(t *testing.T) {
+	g, _ := newTestGame(t, "p1")
+	withGhosts := ghostPlayer{gametest.NewFakePlayer("p2")}
+	g.AddPlayer(withGhosts)
+	ast := g.spawnAsteroid(component.NewVector2D(5, 300), LARGE)
+
+	g.sendGameState()
+
+	var state AsteroidsStatePayload
+	withGhosts.Last(message.AsteroidsState, &state)
+	for _, asteroidState := range state.Asteroids {
+		if asteroidState.ID != ast.ID {
+			continue
+		}
+		want := component.NewVector2D(5+g.config.WorldWidth, 300)
+		if len(asteroidState.Ghosts) != 1 || asteroidState.Ghosts[0] != want {
+			t.Errorf("got ghosts %v, want [%v]", asteroidState.Ghosts, want)
+		}
+	}
+
+	var plainState AsteroidsStatePayload
+	g.playerMap["p1"].(*gametest.FakePlayer).Last(message.AsteroidsState, &plainState)
+	for _, asteroidState := range plainState.Asteroids {
+		if len(asteroidState.Ghosts) != 0 {
+			t.Errorf("client without the capability got ghosts for %s", asteroidState.ID)
+		}
+	}
+}
+
+func TestStateArraysKeepTheirOrderAcrossTicks(t *testing.T) {
+	g, _ := newTestGame(t, "p1", "p2")
+	p1 := g.playerMap["p1"].(*gametest.FakePlayer)
+	for i := range 20 {
+		g.spawnAsteroid(component.NewVector2D(float64(40*i), 100), LARGE)
+		g.spawnProjectile(g.players["p1"])
+	}
+
+	g.tick(0)
+	g.tick(0)
+
+	var orders [][]string
+	for _, msg := range p1.MessagesOfType(message.AsteroidsState) {
+		var state AsteroidsStatePayload
+		if err := json.Unmarshal(msg.Payload, &state); err != nil {
+			t.Fatalf("decoding state: %v", err)
+		}
+		ids := []string{}
+		for _, ast := range state.Asteroids {
+			ids = append(ids, ast.ID)
+		}
+		projectileIDs := []string{}
+		for _, proj := range state.Projectiles {
+			projectileIDs = append(projectileIDs, proj.ID)
+		}
+		if !slices.IsSorted(ids) || !slices.IsSorted(projectileIDs) {
+			t.Fatalf("state is not sorted by ID: %v %v", ids, projectileIDs)
+		}
+		orders = append(orders, append(ids, projectileIDs...))
+	}
+	if len(orders) != 2 {
+		t.Fatalf("got %d states, want 2", len(orders))
+	}
+	if !slices.Equal(orders[0], orders[1]) {
+		t.Errorf("order changed between ticks:\n%v\n%v", orders[0], orders[1])
+	}
+}
+
+func TestPlayersSpawnOnDistinctSpots(t *testing.T) {
+	for n := 1; n <= 8; n++ {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = fmt.Sprintf("p%d", i)
+		}
+		g, _ := newTestGame(t, ids...)
+
+		seen := map[component.Vector2D]string{}
+		for id, p := range g.players {
+			if other, taken := seen[p.Pos]; taken {
+				t.Fatalf("%d players: %s and %s both spawn at %v", n, id, other, p.Pos)
+			}
+			seen[p.Pos] = id
+			// Facing away from the center
+			outwards := p.Pos.Sub(component.NewVector2D(g.config.WorldWidth/2, g.config.WorldHeight/2)).Normalize()
+			if p.Dir.Dot(outwards) < 0.99 {
+				t.Errorf("%d players: %s faces %v, want %v", n, id, p.Dir, outwards)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package asteroids
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/google/uuid"
+)
+
+const (
+	BOT_REACTION_DELAY  time.Duration = 100 * time.Millisecond
+	BOT_IDLE_TIMEOUT    time.Duration = 5 * time.Second // The game is gone if the bot gets no state for this long
+	BOT_AIM_TOLERANCE   float64       = 0.1             // Sine of the angle below which the bot stops turning
+	BOT_SHOOT_TOLERANCE float64       = 15              // Degrees the target may be off before the bot shoots
+	BOT_THRUST_DISTANCE float64       = 200             // The bot only flies towards targets further away than this
+)
+
+// AsteroidsBot is a computer controlled ship. It implements game.Player:
+// it reads the game state from SendMessage and feeds AsteroidsInput
+// messages directly into the game.
+type AsteroidsBot struct {
+	id       string
+	game     *AsteroidsGame
+	states   chan AsteroidsStatePayload // Only ever holds the newest state
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewAsteroidsBot creates a bot for the given game and starts its decision loop.
+// The bot still has to be added to the game with AddPlayer.
+func NewAsteroidsBot(asteroidsGame *AsteroidsGame) *AsteroidsBot {
+	bot := &AsteroidsBot{
+		id:     "bot-" + uuid.NewString(),
+		game:   asteroidsGame,
+		states: make(chan AsteroidsStatePayload, 1),
+		done:   make(chan struct{}),
+	}
+	go bot.run()
+	return bot
+}
+
+/// --- Implementing the game.Player Interface
+
+func (b *AsteroidsBot) GetID() string {
+	return b.id
+}
+
+func (b *AsteroidsBot) GetName() string {
+	return "Bot"
+}
+
+func (b *AsteroidsBot) GetAvatarURL() string {
+	return ""
+}
+
+// SendMessage is called from inside the game loop, so it must never block.
+func (b *AsteroidsBot) SendMessage(msgType message.MessageType, payload any) error {
+	switch msgType {
+	case message.AsteroidsState:
+		state, ok := payload.(AsteroidsStatePayload)
+		if !ok {
+			return nil
+		}
+		// Replace an old state the bot did not look at yet
+		select {
+		case <-b.states:
+		default:
+		}
+		select {
+		case b.states <- state:
+		default:
+		}
+	case message.AsteroidsGameOver:
+		b.stop()
+	}
+	return nil
+}
+
+/// --- End of implementing the game.Player interface
+
+func (b *AsteroidsBot) IsBot() bool {
+	return true
+}
+
+var _ game.Bot = (*AsteroidsBot)(nil)
+
+// Ends the decision loop of the bot, it is fine to call this more than once
+func (b *AsteroidsBot) stop() {
+	b.stopOnce.Do(func() { close(b.done) })
+}
+
+// The decision loop of the bot, runs in its own goroutine
+func (b *AsteroidsBot) run() {
+	for {
+		select {
+		case state := <-b.states:
+			time.Sleep(BOT_REACTION_DELAY)
+
+			input := b.decide(state)
+			payload, _ := json.Marshal(input)
+			b.game.HandleMessage(b, message.Message{Type: message.AsteroidsInput, Payload: payload})
+
+		case <-b.done:
+			log.Printf("[Game %s] Bot %s stopped.", b.game.GetID(), b.id)
+			return
+
+		case <-time.After(BOT_IDLE_TIMEOUT):
+			log.Printf("[Game %s] Bot %s got no state for %s, stopping.", b.game.GetID(), b.id, BOT_IDLE_TIMEOUT)
+			return
+		}
+	}
+}
+
+// The bot turns towards the nearest asteroid, flies towards it
+// if it is far away and shoots once it is roughly aimed at it
+func (b *AsteroidsBot) decide(state AsteroidsStatePayload) AsteroidsInputPayload {
+	self, ok := state.Players[b.id]
+	if !ok || self.Health <= 0 {
+		return AsteroidsInputPayload{}
+	}
+
+	var target *AsteroidState
+	nearestDistSq := math.Inf(1)
+	for i := range state.Asteroids {
+		distSq := state.Asteroids[i].Pos.Sub(self.Pos).LengthSq()
+		if distSq < nearestDistSq {
+			nearestDistSq = distSq
+			target = &state.Asteroids[i]
+		}
+	}
+	if target == nil {
+		return AsteroidsInputPayload{}
+	}
+
+	toTarget := target.Pos.Sub(self.Pos).Normalize()
+	// The cross product tells us on which side of our heading the target is
+	cross := self.Dir.X*toTarget.Y - self.Dir.Y*toTarget.X
+	aimed := self.Dir.Dot(toTarget) >= math.Cos(degreesToRadians(BOT_SHOOT_TOLERANCE))
+
+	return AsteroidsInputPayload{
+		Left:  cross < -BOT_AIM_TOLERANCE,
+		Right: cross > BOT_AIM_TOLERANCE,
+		Up:    aimed && nearestDistSq > BOT_THRUST_DISTANCE*BOT_THRUST_DISTANCE,
+		Shoot: aimed,
+	}
+}
@@ -0,0 +1,156 @@
+package asteroids
+
+import "time"
+
+// AsteroidsConfig holds the tunables of a single Asteroids match.
+// Use DefaultAsteroidsConfig and override what you need.
+type AsteroidsConfig struct {
+	TickRate     time.Duration // Time between two game loop ticks
+	MaxTickDelta float64       // Longest step of a single tick in tick intervals, 0 for no limit
+
+	// Size of the arena, e.g. bigger for 4 players. Clients get it with
+	// the asteroids_config message when the game starts.
+	WorldWidth  float64
+	WorldHeight float64
+
+	// Playing time before the leading survivor wins or it goes to
+	// sudden death, 0 for no limit. The solo sandbox has no limit.
+	MaxDuration time.Duration
+
+	// Players needed to start the game. With 1 a lone player can
+	// practice until they die.
+	MinPlayers int
+
+	// When players drop and less than MinPlayers are left, the game stands
+	// still this long and goes on if they come back, the hub puts them back
+	// when they connect with their session token. 0 ends it right away.
+	// Players who leave on purpose are never waited for.
+	ReconnectGrace time.Duration
+
+	// No more asteroids than this exist at the same time. At the limit a hit
+	// asteroid breaks into fewer pieces or just vanishes, and none are refilled.
+	MaxAsteroids int
+
+	// Into how many pieces a large or middle asteroid breaks, 0 and it just
+	// vanishes. They spread up to SplitAngleVariance degrees to each side of its
+	// heading. MaxAsteroids wins, close to the limit there are fewer pieces.
+	SplitCount         int
+	SplitAngleVariance float64
+
+	PlayerSpeed        float64 // Top speed in units per second
+	Thrust             float64 // Acceleration while thrusting, units per second²
+	Drag               float64 // Share of the velocity lost per second, 0 lets ships drift forever
+	PlayerHealth       float64 // Lives every ship starts with, 1 for a quick deathmatch
+	ShootCooldown      time.Duration
+	ProjectileSpeed    float64       // Units per second
+	ProjectileLifetime time.Duration // Together with the speed the range, bigger worlds need more of it
+
+	// Points for shooting an asteroid of each size
+	PointsLarge  int
+	PointsMiddle int
+	PointsSmall  int
+	PointsUFO    int // Bonus for shooting down a UFO
+
+	// Projectile hits an asteroid of each size takes before it breaks,
+	// 1 breaks it with the first hit. Ramming it always breaks it.
+	HealthLarge  float64
+	HealthMiddle float64
+	HealthSmall  float64
+
+	// Difficulty ramp: the asteroid speed and the refill threshold are
+	// multiplied by 1 + DifficultyRampPerMinute * minutes played,
+	// capped at DifficultyMaxMultiplier. A ramp of 0 disables it.
+	DifficultyRampPerMinute float64
+	DifficultyMaxMultiplier float64
+
+	// Powerups: the chance per second that a new powerup spawns
+	// while there are less than MaxPowerups in the world
+	PowerupSpawnChancePerSecond float64
+	MaxPowerups                 int
+
+	// UFOs: one appears every UFOSpawnInterval and fires at the nearest
+	// player every UFOShootCooldown. Both get shorter with the difficulty
+	// ramp. An interval of 0 disables UFOs.
+	UFOSpawnInterval time.Duration
+	UFOShootCooldown time.Duration
+
+	Hitboxes HitboxScale
+
+	// Classic Asteroids wraps bullets around the screen edges. Without
+	// wrapping they despawn at the edge and can not hit anything across the map.
+	WrapProjectiles bool
+
+	// Asteroids bounce off each other like billiard balls instead of
+	// passing through. The bigger one pushes the smaller one around.
+	AsteroidCollisions bool
+}
+
+// How far a projectile flies before it expires
+func (c AsteroidsConfig) ProjectileRange() float64 {
+	return c.ProjectileSpeed * c.ProjectileLifetime.Seconds()
+}
+
+// HitboxScale scales the radius of each entity type for the collision checks.
+// The radii stay the size things are drawn with, so the feel of the game can be
+// tuned without changing the visuals. E.g. the ship is a triangle and
+// does not fill its whole circle.
+type HitboxScale struct {
+	Player     float64
+	Asteroid   float64
+	Projectile float64
+	Powerup    float64
+	UFO        float64
+}
+
+// DefaultAsteroidsConfig returns the config used for regular matches
+func DefaultAsteroidsConfig() AsteroidsConfig {
+	return AsteroidsConfig{
+		TickRate:     TICK_RATE,
+		MaxTickDelta: MAX_TICK_DELTA,
+		WorldWidth:   WORLD_WIDTH,
+		WorldHeight:  WORLD_HEIGHT,
+		MaxDuration:  MAX_DURATION,
+		MinPlayers:   2,
+
+		MaxAsteroids:       MAX_ASTEROIDS,
+		SplitCount:         ASTEROID_SPLIT_COUNT,
+		SplitAngleVariance: ASTEROID_SPLIT_ANGLE_VARY,
+
+		PlayerSpeed:        INITIAL_PLAYER_SPEED,
+		Thrust:             PLAYER_THRUST,
+		Drag:               PLAYER_DRAG,
+		PlayerHealth:       INITIAL_PLAYER_HEALTH,
+		ShootCooldown:      PLAYER_SHOOT_COOLDOWN,
+		ProjectileSpeed:    PROJECTILE_SPEED,
+		ProjectileLifetime: PROJECTILE_LIFETIME,
+
+		PointsLarge:  ASTEROID_POINTS_LARGE,
+		PointsMiddle: ASTEROID_POINTS_MIDDLE,
+		PointsSmall:  ASTEROID_POINTS_SMALL,
+		PointsUFO:    UFO_POINTS,
+
+		HealthLarge:  ASTEROID_HEALTH_LARGE,
+		HealthMiddle: ASTEROID_HEALTH_MIDDLE,
+		HealthSmall:  ASTEROID_HEALTH_SMALL,
+
+		DifficultyRampPerMinute: 0.25,
+		DifficultyMaxMultiplier: 2.0,
+
+		PowerupSpawnChancePerSecond: 0.05, // Roughly one every 20 seconds
+		MaxPowerups:                 2,
+
+		UFOSpawnInterval: UFO_SPAWN_INTERVAL,
+		UFOShootCooldown: UFO_SHOOT_COOLDOWN,
+
+		Hitboxes: HitboxScale{
+			Player:     0.8,
+			Asteroid:   0.9,
+			Projectile: 1.0,
+			Powerup:    1.0, // Picking up powerups may feel generous
+			UFO:        0.9,
+		},
+
+		WrapProjectiles:    true,
+		AsteroidCollisions: false,
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"log"
 	"math"
 	"math/rand/v2"
+	"sort"
 	"time"
 
 	"github.com/Driemtax/Archaide/internal/component"
+	"github.com/Driemtax/Archaide/internal/message"
 	"github.com/google/uuid"
 )
 
@@ -18,25 +20,42 @@ import (
 // new player infos!
 
 // This function determines how much the player is allowed to turn
-func (p *Player) HandleInput(i AsteroidsInputPayload) {
+func (p *Player) HandleInput(i AsteroidsInputPayload, now time.Time) {
 	p.LastInput = i
+	p.LastInputTime = now
 }
 
 func (g *AsteroidsGame) update(dt float64) {
-	now := time.Now()
+	now := g.clock.Now()
+	g.matchTime += dt
 
 	// Update the players
+	// Only dead players are skipped, invincible ones still move, shoot and
+	// are sent with the state. Invincibility only protects from collisions.
 	for _, p := range g.players {
 		if p.Health.IsDead() {
 			continue
 		}
 
+		// The client resends its input all the time, if it stops doing that
+		// it probably lost the connection and the ship should not fly off forever
+		if !p.LastInputTime.IsZero() && now.Sub(p.LastInputTime) > INPUT_TIMEOUT {
+			p.LastInput = AsteroidsInputPayload{}
+		}
+
 		// Stop invincibility
 		if p.IsInvincible && now.After(p.InvincibleTime) {
 			p.IsInvincible = false
 			log.Printf("[Game %s] Player %s invincibility ended.", g.gameID, p.PlayerID)
 		}
 
+		// Expire powerup effects
+		for effect, expiry := range p.Effects {
+			if now.After(expiry) {
+				delete(p.Effects, effect)
+			}
+		}
+
 		// Apply Input
 		turnDirection := 0.0
 		if p.LastInput.Left && !p.LastInput.Right {
@@ -54,19 +73,24 @@ func (g *AsteroidsGame) update(dt float64) {
 			p.Dir = component.NewVector2D(newX, newY).Normalize()
 		}
 
+		// Thrust speeds the ship up along its nose, drag slowly takes the
+		// speed away again. Without drag it drifts forever like in space.
 		if p.LastInput.Up {
-			// TODO lets add some kind of fancy velocity in here later on
-			moveStep := p.Dir.Mul(p.Speed * dt)
-			p.Pos = p.Pos.Add(moveStep)
+			p.Vel = p.Vel.Add(p.Dir.Mul(g.config.Thrust * dt))
+		}
+		p.Vel = p.Vel.Mul(math.Max(0, 1-g.config.Drag*dt))
+		if speed := p.Vel.Len(); speed > p.Speed {
+			p.Vel = p.Vel.Mul(p.Speed / speed)
 		}
+		p.Pos = p.Pos.Add(p.Vel.Mul(dt))
 
-		if p.LastInput.Shoot && now.After(p.LastShotTime.Add(PLAYER_SHOOT_COOLDOWN)) {
+		if p.LastInput.Shoot && now.After(p.LastShotTime.Add(p.shootCooldown(g.config.ShootCooldown))) {
 			g.spawnProjectile(p)
 			p.LastShotTime = now
 		}
 
 		// Screen Wrapping
-		p.Pos = wrapPosition(p.Pos)
+		p.Pos = g.wrapPosition(p.Pos)
 	}
 
 	/// --- Update Projectiles ---
@@ -74,11 +98,16 @@ func (g *AsteroidsGame) update(dt float64) {
 	for id, proj := range g.projectiles {
 		// Move the projectile
 		proj.Pos = proj.Pos.Add(proj.Dir.Mul(proj.Speed * dt))
-		// Projectiles are also getting wrapped...
-		proj.Pos = wrapPosition(proj.Pos)
+		// Projectiles are also getting wrapped... if the game wants it
+		if g.config.WrapProjectiles {
+			proj.Pos = g.wrapPosition(proj.Pos)
+		} else if g.outsideWorld(proj.Pos) {
+			projectilesToRemove = append(projectilesToRemove, id)
+			continue
+		}
 
 		// Check if the lifetime is expired
-		if now.Sub(proj.SpawnTime) > PROJECTILE_LIFETIME {
+		if now.Sub(proj.SpawnTime) > g.config.ProjectileLifetime {
 			projectilesToRemove = append(projectilesToRemove, id)
 		}
 	}
@@ -87,12 +116,28 @@ func (g *AsteroidsGame) update(dt float64) {
 		delete(g.projectiles, id)
 	}
 
+	/// --- Update Powerups ---
+	for id, pu := range g.powerups {
+		if now.Sub(pu.SpawnTime) > POWERUP_LIFETIME {
+			delete(g.powerups, id)
+		}
+	}
+	if len(g.powerups) < g.config.MaxPowerups && rand.Float64() < g.config.PowerupSpawnChancePerSecond*dt {
+		g.spawnPowerup()
+	}
+
+	/// --- Update UFOs ---
+	g.updateUFOs(dt, now)
+
 	/// --- Update Asteroids ---
 	for _, ast := range g.asteroids {
 		// Move the Asteroid
 		ast.Pos = ast.Pos.Add(ast.Dir.Mul(ast.Speed * dt))
 		// Wrap the Asteroid Position
-		ast.Pos = wrapPosition(ast.Pos)
+		ast.Pos = g.wrapPosition(ast.Pos)
+	}
+	if g.config.AsteroidCollisions {
+		g.bounceAsteroids()
 	}
 
 	/// --- Collision Detection ---
@@ -106,60 +151,79 @@ func (g *AsteroidsGame) update(dt float64) {
 			continue
 		}
 		for astID, ast := range g.asteroids {
-			if checkCollision(p.Pos, ast.Pos, p.Radius, ast.Radius) {
-				p.Health.Damage(1)
-				g.respawnPlayer(p)
-				if _, exists := g.asteroids[astID]; exists {
-					clearAsteroids = append(clearAsteroids, astID)
-					newAsteroids := g.splitAsteroid(ast)
-					asteroidsToAdd = append(asteroidsToAdd, newAsteroids...)
-				}
+			if !g.checkCollision(p.Pos, ast.Pos, g.playerHitbox(p), g.asteroidHitbox(ast)) {
+				continue
 			}
+			g.hitPlayer(p)
+			// Another ship may have broken it already in this tick
+			if _, marked := findString(clearAsteroids, astID); !marked {
+				clearAsteroids = append(clearAsteroids, astID)
+				newAsteroids := g.splitAsteroid(ast)
+				asteroidsToAdd = append(asteroidsToAdd, newAsteroids...)
+			}
+			// One hit per tick is enough, the ship is invincible afterwards
 			break
 		}
 	}
 
-	// Projectile vs Asteroid
-	for projID, proj := range g.projectiles {
-		if _, marked := findString(clearProjectiles, projID); marked {
-			// Skip projectiles that have already been marked for removal
+	// Player vs Powerup
+	for _, p := range g.players {
+		if p.Health.IsDead() {
 			continue
 		}
-		for astID, ast := range g.asteroids {
-			if _, marked := findString(clearAsteroids, astID); marked {
-				// Skip Asteroids that have already been marked for removal
-				continue
+		for puID, pu := range g.powerups {
+			if g.checkCollision(p.Pos, pu.Pos, g.playerHitbox(p), g.powerupHitbox(pu)) {
+				g.applyPowerup(p, pu.Type)
+				delete(g.powerups, puID)
 			}
+		}
+	}
 
-			if checkCollision(proj.Pos, ast.Pos, proj.Radius, ast.Radius) {
-				log.Printf("[Game %s] Projectile %s hit asteroid %s!", g.gameID, projID, astID)
+	// UFOs, their projectiles and the players
+	clearProjectiles = g.checkUFOCollisions(clearProjectiles)
 
-				clearProjectiles = append(clearProjectiles, projID)
-				clearAsteroids = append(clearAsteroids, astID)
-
-				// Award score to the owner of the projectile
-				if owner, ok := g.players[proj.OwnerID]; ok {
-					points := 0
-					switch ast.Type {
-					case LARGE:
-						points = ASTEROID_POINTS_LARGE
-					case MIDDLE:
-						points = ASTEROID_POINTS_MIDDLE
-					case SMALL:
-						points = ASTEROID_POINTS_SMALL
-					}
-					owner.Score += points
-					log.Printf("[Game %s] Player %s score: %d (+%d)", g.gameID, owner.PlayerID, owner.Score, points)
-				}
-
-				// Split the asteroid if not small
-				newAsteroids := g.splitAsteroid(ast)
-				asteroidsToAdd = append(asteroidsToAdd, newAsteroids...)
+	// Projectile vs Asteroid
+	// The hits are sorted, so if two projectiles hit the same asteroid in one tick
+	// the kill always goes to the same one and not to whoever the map returns first
+	for _, hit := range g.projectileHits() {
+		proj, ast := hit.proj, hit.ast
+		if _, marked := findString(clearProjectiles, proj.ID); marked {
+			// Each projectile can only hit one asteroid
+			continue
+		}
+		if _, marked := findString(clearAsteroids, ast.ID); marked {
+			// Skip Asteroids that have already been marked for removal
+			continue
+		}
+		log.Printf("[Game %s] Projectile %s hit asteroid %s!", g.gameID, proj.ID, ast.ID)
 
-				// Each projectile can only hit one asteroid. Break inner loop.
-				break
+		clearProjectiles = append(clearProjectiles, proj.ID)
+		// Tougher asteroids take a few hits, only the one that breaks it scores
+		ast.Health.Damage(1)
+		if !ast.Health.IsDead() {
+			continue
+		}
+		clearAsteroids = append(clearAsteroids, ast.ID)
+
+		// Award score to the owner of the projectile
+		if owner, ok := g.players[proj.OwnerID]; ok {
+			points := 0
+			switch ast.Type {
+			case LARGE:
+				points = g.config.PointsLarge
+			case MIDDLE:
+				points = g.config.PointsMiddle
+			case SMALL:
+				points = g.config.PointsSmall
 			}
+			owner.Score += points
+			owner.countHit(string(ast.Type))
+			log.Printf("[Game %s] Player %s score: %d (+%d)", g.gameID, owner.PlayerID, owner.Score, points)
 		}
+
+		// Split the asteroid if not small
+		newAsteroids := g.splitAsteroid(ast)
+		asteroidsToAdd = append(asteroidsToAdd, newAsteroids...)
 	}
 
 	/// --- Apply Removals and Additions ---
@@ -178,32 +242,115 @@ func (g *AsteroidsGame) update(dt float64) {
 
 	/// --- Spawn new Asteroids ---
 	// If there are not enough asteroids left, spawn more
-	if len(g.asteroids) < INITIAL_ASTEROID_COUNT && len(g.players) > 0 {
+	// The longer the match runs the more asteroids we keep around
+	refillThreshold := int(float64(INITIAL_ASTEROID_COUNT) * g.difficultyMultiplier())
+	refillThreshold = min(refillThreshold, g.config.MaxAsteroids)
+	if len(g.asteroids) < refillThreshold && len(g.players) > 0 {
 		// Spawn one new large asteroid at edge
 		edge := rand.IntN(4) // 0: top, 1: bottom, 2: left, 3: right
 		var spawnPos component.Vector2D
 		switch edge {
 		case 0:
-			spawnPos = component.NewVector2D(rand.Float64()*WORLD_WIDTH, -ASTEROID_SPAWN_PADDING)
+			spawnPos = component.NewVector2D(rand.Float64()*g.config.WorldWidth, -ASTEROID_SPAWN_PADDING)
 		case 1:
-			spawnPos = component.NewVector2D(rand.Float64()*WORLD_WIDTH, WORLD_HEIGHT+ASTEROID_SPAWN_PADDING)
+			spawnPos = component.NewVector2D(rand.Float64()*g.config.WorldWidth, g.config.WorldHeight+ASTEROID_SPAWN_PADDING)
 		case 2:
-			spawnPos = component.NewVector2D(-ASTEROID_SPAWN_PADDING, rand.Float64()*WORLD_HEIGHT)
+			spawnPos = component.NewVector2D(-ASTEROID_SPAWN_PADDING, rand.Float64()*g.config.WorldHeight)
 		case 3:
-			spawnPos = component.NewVector2D(WORLD_WIDTH+ASTEROID_SPAWN_PADDING, rand.Float64()*WORLD_HEIGHT)
+			spawnPos = component.NewVector2D(g.config.WorldWidth+ASTEROID_SPAWN_PADDING, rand.Float64()*g.config.WorldHeight)
 		}
 		log.Printf("[Game %s] Asteroid count low, spawning new one.", g.gameID)
 		g.spawnAsteroid(spawnPos, LARGE)
 	}
 }
 
+type projectileHit struct {
+	proj   *Projectile
+	ast    *Asteroid
+	distSq float64 // Between the centers, the closer projectile got there first
+}
+
+// Returns all projectile vs asteroid collisions of this tick. The closest
+// projectile comes first, then the one that was fired earlier and
+// the IDs break the last ties.
+func (g *AsteroidsGame) projectileHits() []projectileHit {
+	hits := []projectileHit{}
+	for _, proj := range g.projectiles {
+		if proj.Hostile {
+			// UFO shots are aimed at the players and fly through the asteroids,
+			// the UFO would clear the field for them otherwise
+			continue
+		}
+		for _, ast := range g.asteroids {
+			if g.checkCollision(proj.Pos, ast.Pos, g.projectileHitbox(proj), g.asteroidHitbox(ast)) {
+				hits = append(hits, projectileHit{proj: proj, ast: ast, distSq: g.wrappedDistanceSq(proj.Pos, ast.Pos)})
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.distSq != b.distSq {
+			return a.distSq < b.distSq
+		}
+		if !a.proj.SpawnTime.Equal(b.proj.SpawnTime) {
+			return a.proj.SpawnTime.Before(b.proj.SpawnTime)
+		}
+		if a.proj.ID != b.proj.ID {
+			return a.proj.ID < b.proj.ID
+		}
+		return a.ast.ID < b.ast.ID
+	})
+	return hits
+}
+
+// Lets touching asteroids bounce off each other with an elastic collision.
+// Their mass grows with the area, so a small asteroid barely moves a large one.
+// Checks every pair, which is fine for the few asteroids we have.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) bounceAsteroids() {
+	// Sorted, so the outcome of three asteroids touching does not depend on the map order
+	ids := make([]string, 0, len(g.asteroids))
+	for id := range g.asteroids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id1 := range ids {
+		a := g.asteroids[id1]
+		for _, id2 := range ids[i+1:] {
+			b := g.asteroids[id2]
+			if !g.checkCollision(a.Pos, b.Pos, g.asteroidHitbox(a), g.asteroidHitbox(b)) {
+				continue
+			}
+			normal := g.wrappedDelta(a.Pos, b.Pos).Normalize()
+			if normal.LengthSq() == 0 {
+				continue
+			}
+			velA := a.Dir.Mul(a.Speed)
+			velB := b.Dir.Mul(b.Speed)
+			// Already moving apart, they still overlap from the last bounce
+			approach := velA.Sub(velB).Dot(normal)
+			if approach <= 0 {
+				continue
+			}
+
+			massA := a.Radius * a.Radius
+			massB := b.Radius * b.Radius
+			velA = velA.Sub(normal.Mul(2 * massB / (massA + massB) * approach))
+			velB = velB.Add(normal.Mul(2 * massA / (massA + massB) * approach))
+			a.Dir, a.Speed = velA.Normalize(), velA.Len()
+			b.Dir, b.Speed = velB.Normalize(), velB.Len()
+		}
+	}
+}
+
 func (g *AsteroidsGame) initializeAsteroids() {
-	log.Printf("[Game %s] Initializing %d asteroids.", g.gameID, INITIAL_ASTEROID_COUNT)
-	center := component.NewVector2D(WORLD_WIDTH/2, WORLD_HEIGHT/2)
-	for range INITIAL_ASTEROID_COUNT {
+	count := min(INITIAL_ASTEROID_COUNT, g.config.MaxAsteroids)
+	log.Printf("[Game %s] Initializing %d asteroids.", g.gameID, count)
+	center := component.NewVector2D(g.config.WorldWidth/2, g.config.WorldHeight/2)
+	for range count {
 		// Spawn asteroids away from the center
 		angle := rand.Float64() * 2 * math.Pi
-		dist := ASTEROID_SPAWN_PADDING + rand.Float64()*(math.Min(WORLD_WIDTH, WORLD_HEIGHT)/2-ASTEROID_SPAWN_PADDING)
+		dist := ASTEROID_SPAWN_PADDING + rand.Float64()*(math.Min(g.config.WorldWidth, g.config.WorldHeight)/2-ASTEROID_SPAWN_PADDING)
 		pos := center.Add(component.NewVector2D(math.Cos(angle)*dist, math.Sin(angle)*dist))
 
 		g.spawnAsteroid(pos, LARGE)
@@ -217,17 +364,19 @@ func (g *AsteroidsGame) spawnAsteroid(pos component.Vector2D, typ AsteroidType)
 		dir = component.NewVector2D(1, 0)
 	}
 	speed := ASTEROID_SPEED_MIN + rand.Float64()*(ASTEROID_SPEED_MAX-ASTEROID_SPEED_MIN)
-	var radius float64
+	speed *= g.difficultyMultiplier() * asteroidSpeedFactor(typ)
+	var radius, health float64
 
 	switch typ {
 	case LARGE:
 		radius = 30.0
+		health = g.config.HealthLarge
 	case MIDDLE:
 		radius = 18.0
-		speed *= 1.3 // The smaller the asteroid the faster the asteroid
+		health = g.config.HealthMiddle
 	case SMALL:
 		radius = 10.0
-		speed *= 1.6
+		health = g.config.HealthSmall
 	default:
 		log.Printf("[Game %s] Warning: Tried to spawn unknown asteroid type '%s'", g.gameID, typ)
 		return nil
@@ -240,6 +389,7 @@ func (g *AsteroidsGame) spawnAsteroid(pos component.Vector2D, typ AsteroidType)
 		Type:         typ,
 		Speed:        speed,
 		Radius:       radius,
+		Health:       component.NewHealth(max(health, 1)),
 		VariantIndex: rand.IntN(2),
 	}
 	g.asteroids[id] = asteroid
@@ -248,9 +398,9 @@ func (g *AsteroidsGame) spawnAsteroid(pos component.Vector2D, typ AsteroidType)
 }
 
 func (g *AsteroidsGame) spawnProjectile(p *Player) {
-	now := time.Now()
+	now := g.clock.Now()
 
-	if now.Sub(p.LastShotTime) < PLAYER_SHOOT_COOLDOWN {
+	if now.Sub(p.LastShotTime) < p.shootCooldown(g.config.ShootCooldown) {
 		return
 	}
 
@@ -264,11 +414,72 @@ func (g *AsteroidsGame) spawnProjectile(p *Player) {
 		OwnerID:   p.PlayerID,
 		Pos:       spawnPos,
 		Dir:       p.Dir,
-		Speed:     PROJECTILE_SPEED,
+		Speed:     g.config.ProjectileSpeed,
 		SpawnTime: now,
 		Radius:    PROJECTILE_RADIUS,
 	}
 	g.projectiles[id] = projectile
+	p.Stats.ShotsFired++
+}
+
+func (g *AsteroidsGame) spawnPowerup() *Powerup {
+	powerup := &Powerup{
+		ID:        uuid.NewString(),
+		Pos:       component.NewVector2D(rand.Float64()*g.config.WorldWidth, rand.Float64()*g.config.WorldHeight),
+		Type:      powerupTypes[rand.IntN(len(powerupTypes))],
+		SpawnTime: g.clock.Now(),
+		Radius:    POWERUP_RADIUS,
+	}
+	g.powerups[powerup.ID] = powerup
+	log.Printf("[Game %s] Spawned %s powerup at %.1f, %.1f", g.gameID, powerup.Type, powerup.Pos.X, powerup.Pos.Y)
+	return powerup
+}
+
+// Grants the effect of a collected powerup and tells everyone about it
+func (g *AsteroidsGame) applyPowerup(p *Player, typ PowerupType) {
+	now := g.clock.Now()
+	switch typ {
+	case SHIELD:
+		expiry := now.Add(SHIELD_DURATION)
+		p.Effects[SHIELD] = expiry
+		// The shield just extends the invincibility the player already has
+		p.IsInvincible = true
+		if expiry.After(p.InvincibleTime) {
+			p.InvincibleTime = expiry
+		}
+	case RAPID_FIRE:
+		p.Effects[RAPID_FIRE] = now.Add(RAPID_FIRE_DURATION)
+	case EXTRA_LIFE:
+		p.Health.MaxHP += EXTRA_LIFE_HEALTH_GAIN
+		p.Health.Heal(EXTRA_LIFE_HEALTH_GAIN)
+	}
+	log.Printf("[Game %s] Player %s picked up %s powerup", g.gameID, p.PlayerID, typ)
+
+	payload := PowerupPickupPayload{PlayerID: p.PlayerID, Type: typ}
+	for _, player := range g.recipients() {
+		if err := player.SendMessage(message.AsteroidsPowerupPickup, payload); err != nil {
+			log.Printf("[Game %s] Error sending powerup pickup to player %s: %v", g.gameID, player.GetID(), err)
+		}
+	}
+}
+
+// Returns how long the player has to wait between two shots
+func (p *Player) shootCooldown(cooldown time.Duration) time.Duration {
+	if _, ok := p.Effects[RAPID_FIRE]; ok {
+		return RAPID_FIRE_COOLDOWN
+	}
+	return cooldown
+}
+
+// The smaller the asteroid the faster the asteroid
+func asteroidSpeedFactor(typ AsteroidType) float64 {
+	switch typ {
+	case MIDDLE:
+		return 1.3
+	case SMALL:
+		return 1.6
+	}
+	return 1
 }
 
 func (g *AsteroidsGame) splitAsteroid(original *Asteroid) []*Asteroid {
@@ -287,17 +498,35 @@ func (g *AsteroidsGame) splitAsteroid(original *Asteroid) []*Asteroid {
 		canSplit = false
 	}
 
+	// The pieces are added right away, the original is still counted until it
+	// gets removed at the end of the tick. So this stays below the limit even
+	// if several asteroids break in the same tick.
+	pieces := min(g.config.SplitCount, g.config.MaxAsteroids-len(g.asteroids)+1)
+	if canSplit && g.config.SplitCount <= 0 {
+		canSplit = false
+	} else if canSplit && pieces <= 0 {
+		log.Printf("[Game %s] Too many asteroids, %s breaks without pieces", g.gameID, original.ID)
+		canSplit = false
+	}
+
 	if canSplit {
-		log.Printf("[Game %s] Splitting asteroid %s (%s) into %d %s asteroids", g.gameID, original.ID, original.Type, ASTEROID_SPLIT_COUNT, nextType)
+		log.Printf("[Game %s] Splitting asteroid %s (%s) into %d %s asteroids", g.gameID, original.ID, original.Type, pieces, nextType)
 		baseAngleRad := math.Atan2(original.Dir.Y, original.Dir.X)
-		angleVarianceRad := degreesToRadians(ASTEROID_SPLIT_ANGLE_VARY)
-
-		for range ASTEROID_SPLIT_COUNT {
-			// Each new angle should get a slightly diffrent angle
-			offsetAngle := (rand.Float64()*2 - 1) * angleVarianceRad
-			// TODO this here could be an alternative split angle that could be tested
-			// offsetAngle := (float64(i)/float64(ASTEROID_SPLIT_COUNT-1) - 0.5) * 2 * angleVarianceRad
+		offsets := splitAngleOffsets(pieces, degreesToRadians(g.config.SplitAngleVariance))
+
+		// The pieces fly apart, so only part of their speed points along the
+		// parent's heading. They get a bit faster to make up for it, that way
+		// their average velocity points exactly along the parent's. On top
+		// they are faster by the size, like freshly spawned ones.
+		forwardShare := 0.0
+		for _, offset := range offsets {
+			forwardShare += math.Cos(offset)
+		}
+		forwardShare /= float64(len(offsets))
+		sizeFactor := asteroidSpeedFactor(nextType) / asteroidSpeedFactor(original.Type)
+		childSpeed := original.Speed / forwardShare * sizeFactor
 
+		for _, offsetAngle := range offsets {
 			newAngle := baseAngleRad + offsetAngle
 			newDir := component.NewVector2D(math.Cos(newAngle), math.Sin(newAngle))
 
@@ -308,6 +537,7 @@ func (g *AsteroidsGame) splitAsteroid(original *Asteroid) []*Asteroid {
 			spawned := g.spawnAsteroid(newPos, nextType)
 			if spawned != nil {
 				spawned.Dir = newDir
+				spawned.Speed = childSpeed
 				newAsteroids = append(newAsteroids, spawned)
 			}
 		}
@@ -315,14 +545,97 @@ func (g *AsteroidsGame) splitAsteroid(original *Asteroid) []*Asteroid {
 	return newAsteroids
 }
 
+// Spreads count angles evenly between -variance and +variance
+func splitAngleOffsets(count int, variance float64) []float64 {
+	if count == 1 {
+		return []float64{0}
+	}
+	offsets := make([]float64, count)
+	for i := range offsets {
+		offsets[i] = (float64(i)/float64(count-1) - 0.5) * 2 * variance
+	}
+	return offsets
+}
+
+// Returns the factor the difficulty is ramped up by, based on how long the match is running
+func (g *AsteroidsGame) difficultyMultiplier() float64 {
+	if g.config.DifficultyRampPerMinute <= 0 {
+		return 1
+	}
+	multiplier := 1 + g.config.DifficultyRampPerMinute*(g.matchTime/60)
+	return math.Min(multiplier, math.Max(1, g.config.DifficultyMaxMultiplier))
+}
+
+// Spreads the players evenly on a ring around the center, in the order they
+// joined, each one facing outwards. Before the game started everyone is
+// moved, so the ring stays even while players are added. A player that
+// joins a running game is put on the spot it would have had among the others.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) placeOnSpawnRing() {
+	players := make([]*Player, 0, len(g.players))
+	for _, p := range g.players {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].Slot < players[j].Slot })
+
+	center := component.NewVector2D(g.config.WorldWidth/2, g.config.WorldHeight/2)
+	for i, p := range players {
+		if g.isRunning && i != len(players)-1 {
+			continue
+		}
+		// The first player starts on top, pointing up like before
+		angle := -math.Pi/2 + 2*math.Pi*float64(i)/float64(len(players))
+		p.Dir = component.NewVector2D(math.Cos(angle), math.Sin(angle))
+		p.Pos = center.Add(p.Dir.Mul(PLAYER_SPAWN_RING_RADIUS))
+	}
+}
+
+// Costs the player a life and respawns them. Everyone is told when it
+// was the last one.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) hitPlayer(p *Player) {
+	p.Health.Damage(1)
+	g.respawnPlayer(p)
+	if !p.Health.IsDead() {
+		return
+	}
+
+	log.Printf("[Game %s] Player %s was eliminated with a score of %d.", g.gameID, p.PlayerID, p.Score)
+	g.observer.PlayerEliminated(g.gameID, p.PlayerID)
+	payload := AsteroidsEliminatedPayload{PlayerID: p.PlayerID, Name: p.Name, Score: p.Score}
+	for _, player := range g.recipients() {
+		if err := player.SendMessage(message.AsteroidsEliminated, payload); err != nil {
+			log.Printf("[Game %s] Error sending elimination to player %s: %v", g.gameID, player.GetID(), err)
+		}
+	}
+}
+
 func (g *AsteroidsGame) respawnPlayer(p *Player) {
 	log.Printf("[Game %s] Respawning player %s", g.gameID, p.PlayerID)
-	p.Pos = component.NewVector2D(WORLD_WIDTH/2, WORLD_HEIGHT/2) // Respawn at center
+	p.Pos = component.NewVector2D(g.config.WorldWidth/2, g.config.WorldHeight/2) // Respawn at center
 	p.Dir = component.NewVector2D(0, -1)
+	p.Vel = component.Vector2D{}
 	p.IsInvincible = true
-	p.InvincibleTime = time.Now().Add(PLAYER_RESPAWN_INVINCIBLE)
-	// TODO i want to implement some fancy velocity later on!
-	// for that i will have to reset it here...
+	p.InvincibleTime = g.clock.Now().Add(PLAYER_RESPAWN_INVINCIBLE)
+}
+
+// Returns the alive player with the highest score, or "" if that is a tie.
+// This method requires the playerMux to be (read) locked by the caller.
+func (g *AsteroidsGame) survivingLeader() string {
+	leader := ""
+	highestScore := -1
+	for _, p := range g.players {
+		if p.Health.IsDead() {
+			continue
+		}
+		if p.Score > highestScore {
+			leader = p.PlayerID
+			highestScore = p.Score
+		} else if p.Score == highestScore {
+			leader = ""
+		}
+	}
+	return leader
 }
 
 func (g *AsteroidsGame) determineWinner() string {
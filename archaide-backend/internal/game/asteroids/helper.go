@@ -10,22 +10,94 @@ func degreesToRadians(degrees float64) float64 {
 	return degrees * math.Pi / 180.0
 }
 
-func wrapPosition(pos component.Vector2D) component.Vector2D {
+// The world size can differ per match, so everything that depends on it
+// reads it from the config of the game
+
+func (g *AsteroidsGame) wrapPosition(pos component.Vector2D) component.Vector2D {
+	width, height := g.config.WorldWidth, g.config.WorldHeight
 	if pos.X < 0 {
-		pos.X += WORLD_WIDTH
-	} else if pos.X >= WORLD_WIDTH {
-		pos.X -= WORLD_WIDTH
+		pos.X += width
+	} else if pos.X >= width {
+		pos.X -= width
 	}
 	if pos.Y < 0 {
-		pos.Y += WORLD_HEIGHT
-	} else if pos.Y >= WORLD_HEIGHT {
-		pos.Y -= WORLD_HEIGHT
+		pos.Y += height
+	} else if pos.Y >= height {
+		pos.Y -= height
 	}
 	return pos
 }
 
-func checkCollision(pos1, pos2 component.Vector2D, r1, r2 float64) bool {
-	distSq := pos1.Sub(pos2).LengthSq()
+func (g *AsteroidsGame) outsideWorld(pos component.Vector2D) bool {
+	return pos.X < 0 || pos.X >= g.config.WorldWidth || pos.Y < 0 || pos.Y >= g.config.WorldHeight
+}
+
+// Returns the squared distance between two positions. The world wraps, so
+// things close to opposite edges are close to each other across the seam.
+func (g *AsteroidsGame) wrappedDistanceSq(pos1, pos2 component.Vector2D) float64 {
+	dx := wrappedAxisDistance(pos1.X, pos2.X, g.config.WorldWidth)
+	dy := wrappedAxisDistance(pos1.Y, pos2.Y, g.config.WorldHeight)
+	return dx*dx + dy*dy
+}
+
+// The shorter way between a and b, either directly or around the edge
+func wrappedAxisDistance(a, b, size float64) float64 {
+	d := math.Mod(math.Abs(a-b), size)
+	return math.Min(d, size-d)
+}
+
+// Returns the shortest vector from one position to the other, which may
+// point across the seam
+func (g *AsteroidsGame) wrappedDelta(from, to component.Vector2D) component.Vector2D {
+	return component.NewVector2D(
+		wrappedAxisDelta(from.X, to.X, g.config.WorldWidth),
+		wrappedAxisDelta(from.Y, to.Y, g.config.WorldHeight),
+	)
+}
+
+// Like wrappedAxisDistance, but keeps the direction
+func wrappedAxisDelta(a, b, size float64) float64 {
+	d := math.Mod(b-a, size)
+	if d > size/2 {
+		d -= size
+	} else if d < -size/2 {
+		d += size
+	}
+	return d
+}
+
+// Returns where else something with the radius has to be drawn, because it
+// sticks out over an edge and comes in again on the other side.
+// Near a corner that is up to three copies.
+func (g *AsteroidsGame) wrapGhosts(pos component.Vector2D, radius float64) []component.Vector2D {
+	width, height := g.config.WorldWidth, g.config.WorldHeight
+	shiftX, shiftY := 0.0, 0.0
+	if pos.X < radius {
+		shiftX = width
+	} else if pos.X > width-radius {
+		shiftX = -width
+	}
+	if pos.Y < radius {
+		shiftY = height
+	} else if pos.Y > height-radius {
+		shiftY = -height
+	}
+
+	var ghosts []component.Vector2D
+	if shiftX != 0 {
+		ghosts = append(ghosts, component.NewVector2D(pos.X+shiftX, pos.Y))
+	}
+	if shiftY != 0 {
+		ghosts = append(ghosts, component.NewVector2D(pos.X, pos.Y+shiftY))
+	}
+	if shiftX != 0 && shiftY != 0 {
+		ghosts = append(ghosts, component.NewVector2D(pos.X+shiftX, pos.Y+shiftY))
+	}
+	return ghosts
+}
+
+func (g *AsteroidsGame) checkCollision(pos1, pos2 component.Vector2D, r1, r2 float64) bool {
+	distSq := g.wrappedDistanceSq(pos1, pos2)
 	radiiSumSq := (r1 + r2) * (r1 + r2)
 	return distSq <= radiiSumSq
 }
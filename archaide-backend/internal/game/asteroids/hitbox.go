@@ -0,0 +1,23 @@
+package asteroids
+
+// The radii used for collisions, see HitboxScale
+
+func (g *AsteroidsGame) playerHitbox(p *Player) float64 {
+	return p.Radius * g.config.Hitboxes.Player
+}
+
+func (g *AsteroidsGame) asteroidHitbox(ast *Asteroid) float64 {
+	return ast.Radius * g.config.Hitboxes.Asteroid
+}
+
+func (g *AsteroidsGame) projectileHitbox(proj *Projectile) float64 {
+	return proj.Radius * g.config.Hitboxes.Projectile
+}
+
+func (g *AsteroidsGame) powerupHitbox(pu *Powerup) float64 {
+	return pu.Radius * g.config.Hitboxes.Powerup
+}
+
+func (g *AsteroidsGame) ufoHitbox(ufo *UFO) float64 {
+	return ufo.Radius * g.config.Hitboxes.UFO
+}
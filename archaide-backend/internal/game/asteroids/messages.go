@@ -1,6 +1,25 @@
 package asteroids
 
-import "github.com/Driemtax/Archaide/internal/component"
+import (
+	"github.com/Driemtax/Archaide/internal/component"
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+func init() {
+	game.MustRegisterMessages(GAME_NAME, MessagePayloads)
+}
+
+// The payload of every asteroids message. Used to describe the protocol.
+var MessagePayloads = map[message.MessageType]any{
+	message.AsteroidsInput:         AsteroidsInputPayload{},
+	message.AsteroidsState:         AsteroidsStatePayload{},
+	message.AsteroidsGameOver:      AsteroidsGameOverPayload{},
+	message.AsteroidsConfig:        AsteroidsConfigPayload{},
+	message.AsteroidsScoreUpdate:   AsteroidsScoreUpdatePayload{},
+	message.AsteroidsPowerupPickup: PowerupPickupPayload{},
+	message.AsteroidsEliminated:    AsteroidsEliminatedPayload{},
+}
 
 // Always tells the server if the button is currently pressed or not
 type AsteroidsInputPayload struct {
@@ -12,32 +31,110 @@ type AsteroidsInputPayload struct {
 
 type PlayerState struct {
 	ID           string             `json:"id"`
+	Name         string             `json:"name"`
 	Pos          component.Vector2D `json:"pos"`
 	Dir          component.Vector2D `json:"dir"`
+	Vel          component.Vector2D `json:"vel"` // Units per second, lets the client extrapolate between frames
 	Health       float64            `json:"health"`
 	IsInvincible bool               `json:"isInvincible"`
+	InvincibleMs int64              `json:"invincibleMs"` // Time left until the invincibility ends, lets the client blink and fade it out
 	Score        int                `json:"score"`
+	Effects      []PowerupType      `json:"effects"` // Currently active powerup effects
+	// The current input of the player, so the client can show engine flames
+	// or turn effects. Always false for dead players.
+	Thrusting    bool `json:"thrusting"`
+	TurningLeft  bool `json:"turningLeft"`
+	TurningRight bool `json:"turningRight"`
+	Shooting     bool `json:"shooting"`
+	// Only for clients with message.CapabilityWrapGhosts: where to draw the
+	// ship a second time while it sticks out over an edge
+	Ghosts []component.Vector2D `json:"ghosts,omitempty"`
 }
 
 type AsteroidState struct {
 	ID           string             `json:"id"`
 	Pos          component.Vector2D `json:"pos"`
 	Dir          component.Vector2D `json:"dir"`
+	Vel          component.Vector2D `json:"vel"` // Units per second
 	VariantIndex int                `json:"variantIndex"`
 	Typ          AsteroidType       `json:"type"`
+	// The client can show the damage, with the default config
+	// every asteroid has 1 and breaks with the first hit
+	Health    float64 `json:"health"`
+	MaxHealth float64 `json:"maxHealth"`
+	// Only for clients with message.CapabilityWrapGhosts: the positions of
+	// the copies on the other side of the world while it overlaps an edge
+	Ghosts []component.Vector2D `json:"ghosts,omitempty"`
 }
 
 type ProjectileState struct {
+	ID      string             `json:"id"`
+	Pos     component.Vector2D `json:"pos"`
+	Vel     component.Vector2D `json:"vel"`     // Units per second
+	Hostile bool               `json:"hostile"` // Fired by a UFO
+}
+
+type PowerupState struct {
+	ID   string             `json:"id"`
+	Pos  component.Vector2D `json:"pos"`
+	Type PowerupType        `json:"type"`
+}
+
+type UFOState struct {
 	ID  string             `json:"id"`
 	Pos component.Vector2D `json:"pos"`
+	Vel component.Vector2D `json:"vel"` // Units per second
+}
+
+// Sent when the game starts and to spectators that join later,
+// the client scales its canvas to the world
+type AsteroidsConfigPayload struct {
+	WorldWidth  float64 `json:"worldWidth"`
+	WorldHeight float64 `json:"worldHeight"`
+	// Lives every ship starts with, so the client knows how many hearts to draw
+	PlayerHealth float64 `json:"playerHealth"`
+	// Random per match. Clients derive cosmetic details like the rotation or
+	// texture of an asteroid from it and the entity ID, so everyone sees the
+	// same. It is cosmetic only, the server never uses it for gameplay.
+	Seed uint32 `json:"seed"`
 }
 
 type AsteroidsStatePayload struct {
 	Players     map[string]PlayerState `json:"players"`
 	Asteroids   []AsteroidState        `json:"asteroids"`
 	Projectiles []ProjectileState      `json:"projectiles"`
+	Powerups    []PowerupState         `json:"powerups"`
+	UFOs        []UFOState             `json:"ufos"`
+	SuddenDeath bool                   `json:"suddenDeath"` // The time ran out on a tie, the next point or death decides
+
+	// Too few players are left, the game stands still and waits this long for the others to come back
+	Paused          bool  `json:"paused"`
+	ReconnectLeftMs int64 `json:"reconnectLeftMs,omitempty"`
+}
+
+// Sent whenever a score changed, so the scoreboard does not have to
+// be diffed from every state frame
+type AsteroidsScoreUpdatePayload struct {
+	Scores map[string]int `json:"scores"` // PlayerID to score
+}
+
+// Sent to all players when someone collects a powerup
+type PowerupPickupPayload struct {
+	PlayerID string      `json:"playerId"`
+	Type     PowerupType `json:"type"`
+}
+
+// Sent to all players and spectators when a player lost their last life.
+// The eliminated player keeps getting the state and watches the rest.
+type AsteroidsEliminatedPayload struct {
+	PlayerID string `json:"playerId"`
+	Name     string `json:"name"`
+	Score    int    `json:"score"` // Final score of the eliminated player
 }
 
 type AsteroidsGameOverPayload struct {
-	Winner string `json:"winner"`
+	Winner    string                      `json:"winner"`
+	Standings []game.PlayerStanding       `json:"standings"`        // Survivors first, then by score
+	Result    string                      `json:"result,omitempty"` // Only for players: game.RESULT_WIN, RESULT_LOSS or RESULT_DRAW
+	Stats     map[string]game.PlayerStats `json:"stats"`            // Key: PlayerID, Destroyed is keyed by asteroid size or "ufo"
 }
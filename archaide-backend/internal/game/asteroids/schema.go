@@ -0,0 +1,38 @@
+package asteroids
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// InputSchema is the JSON schema of the asteroids_input payload. It is served to
+// the frontend and validateInput accepts exactly what it describes.
+var InputSchema = []byte(`{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "asteroids_input",
+  "type": "object",
+  "properties": {
+    "left": { "type": "boolean" },
+    "right": { "type": "boolean" },
+    "up": { "type": "boolean" },
+    "shoot": { "type": "boolean" }
+  },
+  "additionalProperties": false
+}`)
+
+func (g *AsteroidsGame) InputSchema() []byte {
+	return InputSchema
+}
+
+// Decodes an asteroids_input payload and checks it against the InputSchema.
+// Missing buttons count as not pressed.
+func validateInput(raw json.RawMessage) (AsteroidsInputPayload, error) {
+	var payload AsteroidsInputPayload
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return payload, fmt.Errorf("invalid asteroids_input payload: %v", err)
+	}
+	return payload, nil
+}
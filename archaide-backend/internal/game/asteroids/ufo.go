@@ -0,0 +1,195 @@
+package asteroids
+
+import (
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/component"
+	"github.com/google/uuid"
+)
+
+// Every now and then a UFO flies across the screen and shoots at the
+// nearest player. Shooting it down is worth config.PointsUFO.
+
+type UFO struct {
+	ID           string
+	Pos          component.Vector2D
+	Dir          component.Vector2D
+	Speed        float64
+	Radius       float64 // Drawn size, collisions use ufoHitbox
+	LastShotTime time.Time
+}
+
+// Spawns, moves and fires the UFOs. The spawn timer runs faster and the
+// UFOs shoot more often the higher the difficulty multiplier is.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) updateUFOs(dt float64, now time.Time) {
+	if g.config.UFOSpawnInterval <= 0 {
+		return
+	}
+	difficulty := g.difficultyMultiplier()
+
+	// Only one UFO at a time, the timer starts once the last one is gone
+	if len(g.ufos) == 0 && len(g.players) > 0 {
+		g.ufoTimer += dt * difficulty
+		if g.ufoTimer >= g.config.UFOSpawnInterval.Seconds() {
+			g.ufoTimer = 0
+			g.spawnUFO(now)
+		}
+	}
+
+	cooldown := time.Duration(float64(g.config.UFOShootCooldown) / difficulty)
+	for id, ufo := range g.ufos {
+		ufo.Pos = ufo.Pos.Add(ufo.Dir.Mul(ufo.Speed * dt))
+		// UFOs do not wrap, they fly across once and are gone
+		if ufo.Pos.X < -2*ufo.Radius || ufo.Pos.X > g.config.WorldWidth+2*ufo.Radius {
+			delete(g.ufos, id)
+			continue
+		}
+
+		if now.Sub(ufo.LastShotTime) >= cooldown {
+			if target := g.nearestPlayer(ufo.Pos); target != nil {
+				g.spawnUFOProjectile(ufo, target, now)
+				ufo.LastShotTime = now
+			}
+		}
+	}
+}
+
+// Spawns a UFO at the left or right edge flying to the other side
+func (g *AsteroidsGame) spawnUFO(now time.Time) *UFO {
+	pos := component.NewVector2D(-UFO_RADIUS, g.config.WorldHeight*(0.1+rand.Float64()*0.8))
+	dir := component.NewVector2D(1, 0)
+	if rand.IntN(2) == 0 {
+		pos.X = g.config.WorldWidth + UFO_RADIUS
+		dir.X = -1
+	}
+
+	ufo := &UFO{
+		ID:     uuid.NewString(),
+		Pos:    pos,
+		Dir:    dir,
+		Speed:  UFO_SPEED,
+		Radius: UFO_RADIUS,
+		// Give the players a moment to see it before the first shot
+		LastShotTime: now,
+	}
+	g.ufos[ufo.ID] = ufo
+	log.Printf("[Game %s] UFO %s appeared.", g.gameID, ufo.ID)
+	return ufo
+}
+
+// Returns the closest player that is alive, or nil
+func (g *AsteroidsGame) nearestPlayer(pos component.Vector2D) *Player {
+	var nearest *Player
+	nearestDistSq := 0.0
+	for _, p := range g.players {
+		if p.Health.IsDead() {
+			continue
+		}
+		distSq := p.Pos.Sub(pos).LengthSq()
+		// The ID breaks ties, so the target does not depend on the map order
+		if nearest == nil || distSq < nearestDistSq || (distSq == nearestDistSq && p.PlayerID < nearest.PlayerID) {
+			nearest = p
+			nearestDistSq = distSq
+		}
+	}
+	return nearest
+}
+
+func (g *AsteroidsGame) spawnUFOProjectile(ufo *UFO, target *Player, now time.Time) {
+	dir := target.Pos.Sub(ufo.Pos).Normalize()
+	if dir.LengthSq() == 0 {
+		dir = component.NewVector2D(0, 1)
+	}
+
+	projectile := &Projectile{
+		ID:        uuid.NewString(),
+		OwnerID:   ufo.ID,
+		Hostile:   true,
+		Pos:       ufo.Pos.Add(dir.Mul(ufo.Radius + PROJECTILE_RADIUS + 1)),
+		Dir:       dir,
+		Speed:     UFO_PROJECTILE_SPEED,
+		SpawnTime: now,
+		Radius:    PROJECTILE_RADIUS,
+	}
+	g.projectiles[projectile.ID] = projectile
+}
+
+// Checks the collisions between UFOs, their projectiles and the players.
+// Returns clearProjectiles with the projectiles used up here appended, so
+// they can not hit an asteroid in the same tick.
+// This method requires the playerMux to be locked by the caller.
+func (g *AsteroidsGame) checkUFOCollisions(clearProjectiles []string) []string {
+	// UFO projectile vs Player
+	for _, proj := range g.projectiles {
+		if !proj.Hostile {
+			continue
+		}
+		for _, p := range g.players {
+			if p.IsInvincible || p.Health.IsDead() {
+				continue
+			}
+			if g.checkCollision(proj.Pos, p.Pos, g.projectileHitbox(proj), g.playerHitbox(p)) {
+				log.Printf("[Game %s] Player %s got shot by UFO %s!", g.gameID, p.PlayerID, proj.OwnerID)
+				g.hitPlayer(p)
+				clearProjectiles = append(clearProjectiles, proj.ID)
+				break
+			}
+		}
+	}
+
+	for ufoID, ufo := range g.ufos {
+		// Player vs UFO, ramming it costs a life but takes the UFO down too.
+		// There are no points for that though.
+		rammed := false
+		for _, p := range g.players {
+			if p.IsInvincible || p.Health.IsDead() {
+				continue
+			}
+			if g.checkCollision(p.Pos, ufo.Pos, g.playerHitbox(p), g.ufoHitbox(ufo)) {
+				g.hitPlayer(p)
+				rammed = true
+				break
+			}
+		}
+		if rammed {
+			delete(g.ufos, ufoID)
+			continue
+		}
+
+		// Projectile vs UFO, like with asteroids the closest projectile gets the kill
+		var hit *Projectile
+		hitDistSq := 0.0
+		for _, proj := range g.projectiles {
+			if proj.Hostile {
+				continue
+			}
+			if _, marked := findString(clearProjectiles, proj.ID); marked {
+				continue
+			}
+			if !g.checkCollision(proj.Pos, ufo.Pos, g.projectileHitbox(proj), g.ufoHitbox(ufo)) {
+				continue
+			}
+			distSq := g.wrappedDistanceSq(proj.Pos, ufo.Pos)
+			if hit == nil || distSq < hitDistSq || (distSq == hitDistSq && proj.ID < hit.ID) {
+				hit = proj
+				hitDistSq = distSq
+			}
+		}
+		if hit == nil {
+			continue
+		}
+
+		log.Printf("[Game %s] Projectile %s shot down UFO %s!", g.gameID, hit.ID, ufoID)
+		clearProjectiles = append(clearProjectiles, hit.ID)
+		delete(g.ufos, ufoID)
+		if owner, ok := g.players[hit.OwnerID]; ok {
+			owner.Score += g.config.PointsUFO
+			owner.countHit("ufo")
+			log.Printf("[Game %s] Player %s score: %d (+%d)", g.gameID, owner.PlayerID, owner.Score, g.config.PointsUFO)
+		}
+	}
+	return clearProjectiles
+}
@@ -0,0 +1,35 @@
+package game
+
+import "time"
+
+// Clock is where a game gets its time from. Games never call time.Now
+// or time.NewTicker themselves, so tests can step them with a fake clock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of a time.Ticker the game loops need
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the system time, used for every real game
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
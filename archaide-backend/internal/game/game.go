@@ -1,29 +1,166 @@
 package game
 
-import "github.com/Driemtax/Archaide/internal/message"
+import (
+	"sync/atomic"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
 
 // The player struct defines the functions that a game
 // awaits from a connected player
 type Player interface {
-	GetID() string
+	GetID() string   // Used to address the player
+	GetName() string // Used to display the player
+	GetAvatarURL() string
 	SendMessage(msgType message.MessageType, payload any) error
 }
 
+// Bots are computer controlled players. They play like everyone else
+// but are left out of the scores a game reports to the hub.
+type Bot interface {
+	Player
+	IsBot() bool
+}
+
+// IsBot reports whether the player is computer controlled
+func IsBot(player Player) bool {
+	bot, ok := player.(Bot)
+	return ok && bot.IsBot()
+}
+
+// Clients can ask for optional protocol features when they connect,
+// e.g. message.CapabilityWrapGhosts
+type CapablePlayer interface {
+	Player
+	HasCapability(capability string) bool
+}
+
+// HasCapability reports whether the player asked for the feature.
+// Bots and other players without capabilities never do.
+func HasCapability(player Player, capability string) bool {
+	capable, ok := player.(CapablePlayer)
+	return ok && capable.HasCapability(capability)
+}
+
+// PlayerStanding is one row of the results table shown after a game
+type PlayerStanding struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl"`
+	Score     int    `json:"score"`
+	Survived  bool   `json:"survived"` // Still alive when the game ended
+}
+
+// The outcome of a finished game from the view of a single player,
+// sent to them with the game over message
+const (
+	RESULT_WIN  = "win"
+	RESULT_LOSS = "loss"
+	RESULT_DRAW = "draw"
+)
+
 // After a game is finished a game result should be returned
 // To help us update all the scores
 type GameResult struct {
-	Scores map[string]int // Map from PlayerID to game scores
+	Scores map[string]int         // Map from PlayerID to game scores
+	Stats  map[string]PlayerStats // Map from PlayerID to match stats, nil if the game does not track any
+}
+
+// PlayerStats are the counters a game keeps per player for a stats screen
+type PlayerStats struct {
+	ShotsFired int            `json:"shotsFired"`
+	Hits       int            `json:"hits"`                // Shots that destroyed something
+	Destroyed  map[string]int `json:"destroyed,omitempty"` // Key: what got destroyed, e.g. an asteroid size
+}
+
+// Share of the fired shots that hit, 0 without any shots
+func (s PlayerStats) Accuracy() float64 {
+	if s.ShotsFired == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.ShotsFired)
+}
+
+// Games that implement it let a player who leaves early keep the points
+// they scored so far. Games where leaving means giving up, like Pong, do not.
+type ScoreKeeper interface {
+	PlayerScore(playerID string) (score int, ok bool)
+}
+
+// Games that wait for players who dropped implement it, so a player who
+// leaves on purpose is removed right away and nobody waits for them.
+type Leaver interface {
+	LeavePlayer(player Player)
+}
+
+// Games that keep the slot of a player who dropped implement it. The hub
+// hands the player back when they reconnect with their session token.
+type Rejoiner interface {
+	RejoinPlayer(player Player) bool // False if the game does not wait for the player (anymore)
 }
 
 type GameFinisher interface {
 	GameFinished(gameID string, result GameResult)
 }
 
+// A GameObserver gets told what happens inside a running game, e.g. for
+// metrics. The games call it from their game loop, some calls with the game
+// locked, so an observer has to be quick and must not call back into the game.
+type GameObserver interface {
+	GameStarted(gameID, gameName string)      // The game loop is running
+	PlayerEliminated(gameID, playerID string) // The player is out, but still watches the game
+}
+
+// NopObserver ignores everything, the games use it until they get a real one
+type NopObserver struct{}
+
+func (NopObserver) GameStarted(gameID, gameName string)      {}
+func (NopObserver) PlayerEliminated(gameID, playerID string) {}
+
+// A recorder keeps the messages a game sends to its players, e.g. to
+// replay a match later
+type Recorder interface {
+	RecordFrame(msgType message.MessageType, payload any)
+}
+
+// DebugSink holds an optional recorder that gets every state a game sends,
+// to debug a single running game. Unlike the replay recorder it can be
+// switched on and off while the game runs, so it is swapped atomically.
+// The zero value is off.
+type DebugSink struct {
+	recorder atomic.Pointer[Recorder]
+}
+
+// Set starts sending the states to the recorder, nil stops it
+func (d *DebugSink) Set(recorder Recorder) {
+	if recorder == nil {
+		d.recorder.Store(nil)
+		return
+	}
+	d.recorder.Store(&recorder)
+}
+
+// Get returns the current recorder or nil. The games check for nil before
+// they build the frame, so a switched off sink costs nothing.
+func (d *DebugSink) Get() Recorder {
+	if recorder := d.recorder.Load(); recorder != nil {
+		return *recorder
+	}
+	return nil
+}
+
 type Game interface {
 	Start()                                           // Starts the game
 	AddPlayer(player Player) error                    // Adds a new player to the game
 	RemovePlayer(player Player)                       // Removes a playser from the game
+	AddSpectator(spectator Player)                    // Adds someone who only receives the game state
+	RemoveSpectator(spectator Player)                 // Removes a spectator from the game
 	HandleMessage(player Player, msg message.Message) // Handles incoming user input
 	Stop()                                            // Stops the game
 	GetID() string                                    // Returns the game id
+	Name() string                                     // Returns the display name of the game, e.g. "Pong"
+	InputSchema() []byte                              // Returns the JSON schema of the input payload the game accepts
+	SetRecorder(recorder Recorder)                    // Records every sent frame, has to be called before Start
+	SetObserver(observer GameObserver)                // Reports the events of the game, has to be called before Start
+	SetDebugSink(recorder Recorder)                   // Also gets every sent state, nil turns it off. Can be called at any time
 }
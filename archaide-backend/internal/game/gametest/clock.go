@@ -0,0 +1,126 @@
+package gametest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+)
+
+// FakeClock implements game.Clock. Its time only moves when Advance is
+// called, so a test decides when a game ticks and how long each tick is.
+type FakeClock struct {
+	mu          sync.Mutex
+	tickerAdded *sync.Cond
+	now         time.Time
+	tickers     []*fakeTicker
+}
+
+// NewFakeClock creates a fake clock standing at a fixed point in time.
+func NewFakeClock() *FakeClock {
+	c := &FakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c.tickerAdded = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) game.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{
+		c:        make(chan time.Time),
+		stopped:  make(chan struct{}),
+		interval: d,
+		next:     c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	c.tickerAdded.Broadcast()
+	return t
+}
+
+// BlockUntilTickers waits until n tickers were created. Games create their
+// ticker in Start, so a test calls this before advancing a started game.
+func (c *FakeClock) BlockUntilTickers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.tickers) < n {
+		c.tickerAdded.Wait()
+	}
+}
+
+// Advance moves the time forward by d and fires every tick that is due on
+// the way, one after another. Ticks are unbuffered, so Advance only returns
+// once the game loop received all of them. The loop is done with a tick as
+// soon as it received the next one.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		due := c.nextDueInternal(target)
+		if due == nil {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		tickTime := due.next
+		c.now = tickTime
+		due.next = due.next.Add(due.interval)
+		c.mu.Unlock()
+
+		// Not holding the lock, the game reads Now() while handling the tick
+		select {
+		case due.c <- tickTime:
+		case <-due.stopped:
+		}
+	}
+}
+
+// Returns the ticker that fires first until target, or nil.
+// Needs the mutex to be locked.
+func (c *FakeClock) nextDueInternal(target time.Time) *fakeTicker {
+	var due *fakeTicker
+	for _, t := range c.tickers {
+		if t.isStopped() || t.next.After(target) {
+			continue
+		}
+		if due == nil || t.next.Before(due.next) {
+			due = t
+		}
+	}
+	return due
+}
+
+type fakeTicker struct {
+	c        chan time.Time
+	stopped  chan struct{}
+	once     sync.Once
+	interval time.Duration
+	next     time.Time // Protected by the mutex of the clock
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.once.Do(func() { close(t.stopped) })
+}
+
+func (t *fakeTicker) isStopped() bool {
+	select {
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+var _ game.Clock = (*FakeClock)(nil)
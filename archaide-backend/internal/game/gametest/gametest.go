@@ -0,0 +1,193 @@
+// Package gametest provides in-memory fakes of the interfaces a game
+// depends on, so game logic can be unit tested without a hub or websockets.
+package gametest
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// SentMessage is a single message a game sent to a FakePlayer.
+// The payload is kept as JSON, exactly like a real client would receive it.
+type SentMessage struct {
+	Type    message.MessageType
+	Payload json.RawMessage
+}
+
+// FakePlayer implements game.Player and records every message sent to it.
+type FakePlayer struct {
+	ID        string
+	Name      string
+	AvatarURL string
+
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+// NewFakePlayer creates a fake player with the given id, its name is "Player <id>".
+func NewFakePlayer(id string) *FakePlayer {
+	return &FakePlayer{ID: id, Name: "Player " + id}
+}
+
+func (p *FakePlayer) GetID() string {
+	return p.ID
+}
+
+func (p *FakePlayer) GetName() string {
+	return p.Name
+}
+
+func (p *FakePlayer) GetAvatarURL() string {
+	return p.AvatarURL
+}
+
+// SendMessage marshals the payload the same way the real client does
+// and records it.
+func (p *FakePlayer) SendMessage(msgType message.MessageType, payload any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.messages = append(p.messages, SentMessage{Type: msgType, Payload: payloadBytes})
+	p.mu.Unlock()
+	return nil
+}
+
+// Messages returns a copy of all messages sent to the player so far.
+func (p *FakePlayer) Messages() []SentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]SentMessage(nil), p.messages...)
+}
+
+// MessagesOfType returns all recorded messages of the given type.
+func (p *FakePlayer) MessagesOfType(msgType message.MessageType) []SentMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := []SentMessage{}
+	for _, msg := range p.messages {
+		if msg.Type == msgType {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// Last decodes the payload of the most recent message of the given type into v.
+// It returns false if no message of that type was sent.
+func (p *FakePlayer) Last(msgType message.MessageType, v any) bool {
+	msgs := p.MessagesOfType(msgType)
+	if len(msgs) == 0 {
+		return false
+	}
+	return json.Unmarshal(msgs[len(msgs)-1].Payload, v) == nil
+}
+
+// Reset forgets all recorded messages.
+func (p *FakePlayer) Reset() {
+	p.mu.Lock()
+	p.messages = nil
+	p.mu.Unlock()
+}
+
+// PanickingPlayer is a FakePlayer that panics on every message sent to it,
+// to test that a game survives a crash while sending its state.
+type PanickingPlayer struct {
+	*FakePlayer
+}
+
+// NewPanickingPlayer creates a panicking player with the given id.
+func NewPanickingPlayer(id string) PanickingPlayer {
+	return PanickingPlayer{NewFakePlayer(id)}
+}
+
+func (p PanickingPlayer) SendMessage(msgType message.MessageType, payload any) error {
+	panic("injected panic")
+}
+
+// FinishCall is a single recorded call to GameFinished.
+type FinishCall struct {
+	GameID string
+	Result game.GameResult
+}
+
+// FakeFinisher implements game.GameFinisher. It records every call and
+// closes Done() the first time GameFinished fires.
+type FakeFinisher struct {
+	mu    sync.Mutex
+	calls []FinishCall
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewFakeFinisher creates a ready to use fake finisher.
+func NewFakeFinisher() *FakeFinisher {
+	return &FakeFinisher{done: make(chan struct{})}
+}
+
+func (f *FakeFinisher) GameFinished(gameID string, result game.GameResult) {
+	f.mu.Lock()
+	f.calls = append(f.calls, FinishCall{GameID: gameID, Result: result})
+	f.mu.Unlock()
+	f.once.Do(func() { close(f.done) })
+}
+
+// Done is closed after the first call to GameFinished.
+func (f *FakeFinisher) Done() <-chan struct{} {
+	return f.done
+}
+
+// Calls returns a copy of all recorded GameFinished calls.
+func (f *FakeFinisher) Calls() []FinishCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FinishCall(nil), f.calls...)
+}
+
+// Result returns the result of the first GameFinished call, if any.
+func (f *FakeFinisher) Result() (game.GameResult, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.calls) == 0 {
+		return game.GameResult{}, false
+	}
+	return f.calls[0].Result, true
+}
+
+// FakeObserver implements game.GameObserver. It records every event as
+// "started <game name>" or "eliminated <player id>".
+type FakeObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *FakeObserver) GameStarted(gameID, gameName string) {
+	o.record("started " + gameName)
+}
+
+func (o *FakeObserver) PlayerEliminated(gameID, playerID string) {
+	o.record("eliminated " + playerID)
+}
+
+func (o *FakeObserver) record(event string) {
+	o.mu.Lock()
+	o.events = append(o.events, event)
+	o.mu.Unlock()
+}
+
+// Events returns a copy of all recorded events in the order they happened.
+func (o *FakeObserver) Events() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+// Compile time checks for the fakes
+var _ game.Player = (*FakePlayer)(nil)
+var _ game.GameFinisher = (*FakeFinisher)(nil)
+var _ game.GameObserver = (*FakeObserver)(nil)
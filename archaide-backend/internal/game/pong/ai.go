@@ -0,0 +1,201 @@
+package pong
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/google/uuid"
+)
+
+// If the AI does not get any state for this long, the game is gone and the AI quits
+const AI_IDLE_TIMEOUT = 5 * time.Second
+
+// PongAIConfig controls how good the computer opponent is.
+type PongAIConfig struct {
+	ReactionDelay time.Duration // The AI acts on the state it saw this long ago
+	SpeedFactor   float64       // Share of ticks (0-1] in which the AI moves its paddle, limits its max paddle speed
+	DeadZone      float64       // The AI stops moving once the ball is this close to the paddle center
+}
+
+// DefaultPongAIConfig returns a beatable but not too dumb opponent
+func DefaultPongAIConfig() PongAIConfig {
+	return PongAIConfig{
+		ReactionDelay: 120 * time.Millisecond,
+		SpeedFactor:   0.6,
+		DeadZone:      PADDLE_HEIGHT / 4,
+	}
+}
+
+// PongAIPlayer is a computer controlled paddle. It implements game.Player,
+// so the game treats it like any other player: it gets the game state through
+// SendMessage and answers with PongInput messages fed directly into the game.
+type PongAIPlayer struct {
+	id     string
+	game   *PongGame
+	config PongAIConfig
+	states chan PongStatePayload // Only ever holds the newest state
+	done   chan struct{}
+}
+
+// NewPongAIPlayer creates an AI for the given game and starts its decision loop.
+// The AI still has to be added to the game with AddPlayer.
+func NewPongAIPlayer(pongGame *PongGame, config PongAIConfig) *PongAIPlayer {
+	ai := &PongAIPlayer{
+		id:     "ai-" + uuid.NewString(),
+		game:   pongGame,
+		config: config,
+		states: make(chan PongStatePayload, 1),
+		done:   make(chan struct{}),
+	}
+	go ai.run()
+	return ai
+}
+
+/// --- Implementing the game.Player Interface
+
+func (ai *PongAIPlayer) GetID() string {
+	return ai.id
+}
+
+func (ai *PongAIPlayer) GetName() string {
+	return "Computer"
+}
+
+// The computer has no avatar, the client shows its default one
+func (ai *PongAIPlayer) GetAvatarURL() string {
+	return ""
+}
+
+// SendMessage is called from inside the game loop, so it must never block.
+func (ai *PongAIPlayer) SendMessage(msgType message.MessageType, payload any) error {
+	switch msgType {
+	case message.PongState:
+		state, ok := payload.(PongStatePayload)
+		if !ok {
+			return nil
+		}
+		// Replace an old state the AI did not look at yet
+		select {
+		case <-ai.states:
+		default:
+		}
+		select {
+		case ai.states <- state:
+		default:
+		}
+	case message.PongGameOver:
+		select {
+		case <-ai.done:
+		default:
+			close(ai.done)
+		}
+	}
+	return nil
+}
+
+/// --- End of implementing the game.Player interface
+
+func (ai *PongAIPlayer) IsBot() bool {
+	return true
+}
+
+var _ game.Bot = (*PongAIPlayer)(nil)
+
+// The decision loop of the AI, runs in its own goroutine
+func (ai *PongAIPlayer) run() {
+	seen := seenStates{delay: ai.config.ReactionDelay}
+	moveBudget := 0.0
+	for {
+		// The AI only reacts to what it has seen a moment ago, but it keeps
+		// looking in the meantime. Only SpeedFactor limits how often it moves.
+		var reactionDue <-chan time.Time
+		if wait, ok := seen.wait(time.Now()); ok {
+			reactionDue = time.After(wait)
+		}
+
+		select {
+		case state := <-ai.states:
+			seen.add(state, time.Now())
+
+		case <-reactionDue:
+			state, ok := seen.take(time.Now())
+			if !ok {
+				continue
+			}
+
+			moveBudget += ai.config.SpeedFactor
+			if moveBudget < 1 {
+				continue
+			}
+			moveBudget--
+
+			direction := ai.decide(state)
+			if direction == "" {
+				continue
+			}
+			payload, _ := json.Marshal(PongInputPayload{Direction: direction})
+			ai.game.HandleMessage(ai, message.Message{Type: message.PongInput, Payload: payload})
+
+		case <-ai.done:
+			log.Printf("[Game %s] AI player %s stopped.", ai.game.GetID(), ai.id)
+			return
+
+		case <-time.After(AI_IDLE_TIMEOUT):
+			log.Printf("[Game %s] AI player %s got no state for %s, stopping.", ai.game.GetID(), ai.id, AI_IDLE_TIMEOUT)
+			return
+		}
+	}
+}
+
+// A state and when the AI saw it
+type seenState struct {
+	state PongStatePayload
+	at    time.Time
+}
+
+// The states the AI has seen but not reacted to yet, oldest first
+type seenStates struct {
+	delay  time.Duration
+	states []seenState
+}
+
+func (s *seenStates) add(state PongStatePayload, now time.Time) {
+	s.states = append(s.states, seenState{state: state, at: now})
+}
+
+// Returns how long until the AI reacts to the oldest state, false if there is none
+func (s *seenStates) wait(now time.Time) (time.Duration, bool) {
+	if len(s.states) == 0 {
+		return 0, false
+	}
+	return max(s.states[0].at.Add(s.delay).Sub(now), 0), true
+}
+
+// Takes out the oldest state once the reaction delay for it is over
+func (s *seenStates) take(now time.Time) (PongStatePayload, bool) {
+	if wait, ok := s.wait(now); !ok || wait > 0 {
+		return PongStatePayload{}, false
+	}
+	state := s.states[0].state
+	s.states = s.states[1:]
+	return state, true
+}
+
+// Returns the direction the paddle should move to follow the ball
+func (ai *PongAIPlayer) decide(state PongStatePayload) string {
+	paddleY := state.Paddle1Y
+	if state.Player2 == ai.id {
+		paddleY = state.Paddle2Y
+	}
+
+	if state.BallY < paddleY-ai.config.DeadZone {
+		return "up"
+	}
+	if state.BallY > paddleY+ai.config.DeadZone {
+		return "down"
+	}
+	return ""
+}
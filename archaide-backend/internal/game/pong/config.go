@@ -0,0 +1,45 @@
+package pong
+
+import "time"
+
+// PongConfig holds the tunables of a single Pong match.
+// Use DefaultPongConfig and override what you need.
+type PongConfig struct {
+	// Scales the ball and paddle speeds including the speed caps,
+	// values below 1 make the game slower and easier to follow
+	SpeedMultiplier float64
+	PaddleHeight    float64
+	TargetScore     int           // Score needed to win a set
+	Sets            int           // Best of this many sets, 1 is a single race to TargetScore
+	TickRate        time.Duration // Time between two game loop ticks
+	ServeDelay      time.Duration // The ball stays in the center this long after every point
+	MaxPause        time.Duration // A pause ends on its own after this, so nobody can stall the match
+	PausesPerPlayer int
+	MaxDuration     time.Duration // Playing time before the leader wins or it goes to sudden death, 0 for no limit
+
+	// The paddles speed up while a direction is held and coast to a stop
+	// once it is released, instead of moving at full speed right away.
+	// Both rates are in pixels per second² and scale with SpeedMultiplier.
+	PaddleMomentum     bool
+	PaddleAcceleration float64
+	PaddleDeceleration float64
+}
+
+// DefaultPongConfig returns the classic Pong settings
+func DefaultPongConfig() PongConfig {
+	return PongConfig{
+		SpeedMultiplier: 1.0,
+		PaddleHeight:    PADDLE_HEIGHT,
+		TargetScore:     TARGET_SCORE,
+		Sets:            SETS,
+		TickRate:        TICK_RATE,
+		ServeDelay:      SERVE_DELAY,
+		MaxPause:        MAX_PAUSE,
+		PausesPerPlayer: PAUSES_PER_PLAYER,
+		MaxDuration:     MAX_DURATION,
+
+		PaddleMomentum:     false, // The classic paddles stop dead
+		PaddleAcceleration: PADDLE_ACCELERATION,
+		PaddleDeceleration: PADDLE_DECELERATION,
+	}
+}
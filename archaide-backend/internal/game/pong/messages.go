@@ -1,24 +1,94 @@
 package pong
 
+import (
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+func init() {
+	game.MustRegisterMessages(GAME_NAME, MessagePayloads)
+}
+
+// The payload of every pong message, nil if it has none. Used to describe the protocol.
+var MessagePayloads = map[message.MessageType]any{
+	message.PongInput:         PongInputPayload{},
+	message.PongState:         PongStatePayload{},
+	message.PongGameOver:      PongGameOverPayload{},
+	message.PongPointScored:   PongPointScoredPayload{},
+	message.PongSetOver:       PongSetOverPayload{},
+	message.PongPauseRequest:  nil,
+	message.PongResumeRequest: nil,
+}
+
 type PongInputPayload struct {
 	Direction string `json:"direction"`
 }
 
 // PongStatePayload defines the data sent to clients each tick.
+// All positions are centers: the ball is drawn around (BallX, BallY) and a
+// paddle reaches PaddleHeight/2 above and below its PaddleY.
 type PongStatePayload struct {
 	Player1  string  `json:"player_1"` // Player 1 ID
 	Player2  string  `json:"player_2"` // Player 2 ID
 	BallX    float64 `json:"ball_x"`
 	BallY    float64 `json:"ball_y"`
-	Paddle1Y float64 `json:"paddle_1_y"` // Position of player assigned role 1
-	Paddle2Y float64 `json:"paddle_2_y"` // Position of player assigned role 2
+	BallVX   float64 `json:"ball_vx"`    // Units per second, 0 while the ball waits for the serve or the game is paused
+	BallVY   float64 `json:"ball_vy"`    // Units per second, the client can interpolate between two states with it
+	Paddle1Y float64 `json:"paddle_1_y"` // Center of the paddle of player assigned role 1
+	Paddle2Y float64 `json:"paddle_2_y"` // Center of the paddle of player assigned role 2
 	Score1   int     `json:"score_1"`    // Score of player assigned role 1
 	Score2   int     `json:"score_2"`    // Score of player assigned role 2
+
+	PaddleHeight float64 `json:"paddle_height"` // Can differ between matches, e.g. with big paddles
+	BallSpeed    float64 `json:"ball_speed"`    // Length of the velocity, it grows with every paddle hit
+
+	// The client shows a pause overlay, either player can resume
+	Paused      bool   `json:"paused"`
+	PausedBy    string `json:"paused_by,omitempty"`
+	PauseLeftMs int64  `json:"pause_left_ms"` // The pause ends on its own afterwards
+
+	SuddenDeath bool `json:"sudden_death"` // The time ran out on a tie, the next point wins
+
+	// Best-of matches, a match of a single set is always set 1 of 1
+	Set      int `json:"set"`        // The set that is played, starting at 1
+	Sets     int `json:"sets"`       // Best of this many sets
+	SetsWon1 int `json:"sets_won_1"` // Sets won by the player assigned role 1
+	SetsWon2 int `json:"sets_won_2"` // Sets won by the player assigned role 2
+
+	Player1Name string `json:"player_1_name"`
+	Player2Name string `json:"player_2_name"`
+}
+
+// Sent to everyone when a player scores, so the client can play a sound
+// and celebrate during the serve delay
+type PongPointScoredPayload struct {
+	ScorerID   string `json:"scorer_id"`
+	ScorerName string `json:"scorer_name"`
+	Score1     int    `json:"score_1"` // The new score of player assigned role 1
+	Score2     int    `json:"score_2"` // The new score of player assigned role 2
+}
+
+// Sent to everyone when a set of a best-of match is over and the match
+// goes on. The players swap sides, so the roles change with the next state.
+type PongSetOverPayload struct {
+	Set        int            `json:"set"` // The set that just ended, starting at 1
+	WinnerID   string         `json:"winner_id"`
+	WinnerName string         `json:"winner_name"`
+	Score1     int            `json:"score_1"`  // Points of the player that had role 1 in this set
+	Score2     int            `json:"score_2"`  // Points of the player that had role 2 in this set
+	SetsWon    map[string]int `json:"sets_won"` // PlayerID to the sets they won so far
 }
 
 // PongGameOverPayload defines the message sent when the game ends.
 type PongGameOverPayload struct {
-	Winner string `json:"winner"`  // PlayerID of the winner, or specific indicator for draw/error
-	Score1 int    `json:"score_1"` // Final score for player 1
-	Score2 int    `json:"score_2"` // Final score for player 2
+	Winner string `json:"winner"`           // PlayerID of the winner, or specific indicator for draw/error
+	Score1 int    `json:"score_1"`          // Final score for player 1
+	Score2 int    `json:"score_2"`          // Final score for player 2
+	Result string `json:"result,omitempty"` // Only for players: game.RESULT_WIN, RESULT_LOSS or RESULT_DRAW
+
+	SetsWon1 int `json:"sets_won_1"`
+	SetsWon2 int `json:"sets_won_2"`
+
+	Player1Name string `json:"player_1_name"`
+	Player2Name string `json:"player_2_name"`
 }
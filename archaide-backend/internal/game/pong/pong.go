@@ -1,11 +1,11 @@
 package pong
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"math/rand"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -16,11 +16,12 @@ import (
 const (
 	// Game dimensions and elements sizes.
 	// Assuming y=0 is at the bottom for these calculations. Client might need inversion.
-	GAME_WIDTH    = 800.0
-	GAME_HEIGHT   = 600.0
-	PADDLE_WIDTH  = 10.0
-	PADDLE_HEIGHT = 60.0
-	BALL_SIZE     = 10.0
+	GAME_WIDTH        = 800.0
+	GAME_HEIGHT       = 600.0
+	PADDLE_WIDTH      = 10.0
+	PADDLE_HEIGHT     = 60.0
+	BIG_PADDLE_HEIGHT = 120.0 // Accessibility option for players that find the game too hard
+	BALL_SIZE         = 10.0
 
 	// Game rules and physics.
 	PADDLE_SPEED     = 900.0 // Pixels per second
@@ -29,11 +30,31 @@ const (
 	MAX_BALL_SPEED_X = 675.0 // Prevent ball from becoming too fast horizontally
 	MAX_BALL_SPEED_Y = 540.0 // Prevent ball from becoming too fast vertically
 	SPEED_INCREASE   = 1.05  // Factor to increase ball speed on paddle hit
-	TARGET_SCORE     = 5     // Score needed to win the game
+	TARGET_SCORE     = 5     // Score needed to win a set
+	MAX_TARGET_SCORE = 21    // Highest score a set may be played to, longer sets drag on
+	SETS             = 1     // Best of this many sets
 	MIN_PLAYERS      = 2     // Required number of players
 	MAX_PLAYERS      = 2     // Maximum number of players
 
-	TICK_RATE = 32 * time.Millisecond // ~30 FPS
+	GAME_NAME = "Pong"
+
+	TICK_RATE   = 32 * time.Millisecond // ~30 FPS
+	SERVE_DELAY = 1 * time.Second       // Freeze before each serve so players can reposition
+	SET_BREAK   = 3 * time.Second       // Longer freeze between two sets, the players swap sides
+
+	// A ball that did not cross the midline for this long is stuck bouncing
+	// up and down and gets served again. Scaled by the speed multiplier.
+	STUCK_BALL_TIMEOUT = 10 * time.Second
+
+	MAX_PAUSE         = 30 * time.Second
+	PAUSES_PER_PLAYER = 2
+
+	MAX_DURATION = 10 * time.Minute // Afterwards the leader wins, on a tie the next point
+
+	// Only with paddle momentum: a held paddle reaches PADDLE_SPEED after
+	// 0.2s and a released one coasts for 0.3s before it stands still
+	PADDLE_ACCELERATION = 4500.0 // Pixels per second²
+	PADDLE_DECELERATION = 3000.0 // Pixels per second²
 )
 
 // PongPlayerState holds the game-specific state for a player in Pong.
@@ -41,36 +62,58 @@ type PongPlayerState struct {
 	PlayerID          string  // ID linking back to the game.Player
 	PaddleY           float64 // Vertical position of the center of the paddle
 	MovementDirection int     // Direction of paddle movement (up/down)
-	Score             int
-	Role              int // 1 for Player 1 (left), 2 for Player 2 (right)
+	PaddleVY          float64 // Pixels per second, only used with paddle momentum
+	Score             int     // Points in the current set
+	SetsWon           int
+	Role              int // 1 for Player 1 (left), 2 for Player 2 (right), the players swap sides after every set
+	PausesLeft        int // How often the player may still pause the match
 }
 
 // PongGame implements the game.Game interface for a 2-player Pong match.
 type PongGame struct {
 	gameFinisher game.GameFinisher // Interface to notify the hub when the game ends
 	gameID       string
+	config       PongConfig
 
-	players   map[string]*PongPlayerState // Map PlayerID to their state
-	playerMap map[string]game.Player      // Map PlayerID back to the Player interface for sending messages
-	playerMux sync.RWMutex                // Protects access to player maps
+	players    map[string]*PongPlayerState // Map PlayerID to their state
+	playerMap  map[string]game.Player      // Map PlayerID back to the Player interface for sending messages
+	spectators map[string]game.Player      // Map SpectatorID to the watching Player, they only receive messages
+	recorder   game.Recorder               // Optional, records the sent frames for replays
+	debugSink  game.DebugSink              // Off unless someone debugs this game, gets every state
+	observer   game.GameObserver           // Gets told when the game started, a no-op if the hub did not set one
+	playerMux  sync.RWMutex                // Protects access to player maps
 
 	// Game state
-	ballX, ballY   float64 // Position of the center of the ball
-	ballVX, ballVY float64 // Ball velocity
-
-	ticker       *time.Ticker
+	ballX, ballY   float64       // Position of the center of the ball
+	ballVX, ballVY float64       // Ball velocity
+	serveDelayLeft time.Duration // The ball does not move until the serve delay is over
+	sinceMidline   time.Duration // Time since the ball last crossed the midline, see STUCK_BALL_TIMEOUT
+	pausedBy       string        // ID of the player that paused the match, empty while playing
+	pauseLeft      time.Duration // The pause ends on its own when this runs out
+	matchTime      float64       // Seconds played, pauses do not count
+	suddenDeath    bool          // The time ran out on a tie, the next point wins
+
+	clock        game.Clock // Source of the time, a fake one in tests
+	ticker       game.Ticker
+	tickMonitor  *game.TickMonitor
 	stopChan     chan bool // Channel to signal the game loop to stop
 	isRunning    bool      // Indicates if the game loop is active
+	stopped      bool      // Stopped for good, the hub was told and Start does nothing anymore
 	lastTickTime time.Time // For delta time
 }
 
 // NewPongGame creates a new instance of the Pong game.
-func NewPongGame(finisher game.GameFinisher, id string) *PongGame {
+func NewPongGame(finisher game.GameFinisher, id string, config PongConfig, clock game.Clock) *PongGame {
 	return &PongGame{
 		gameFinisher: finisher,
 		gameID:       id,
+		config:       config,
+		clock:        clock,
 		players:      make(map[string]*PongPlayerState),
 		playerMap:    make(map[string]game.Player),
+		spectators:   make(map[string]game.Player),
+		tickMonitor:  game.NewTickMonitor(id, config.TickRate),
+		observer:     game.NopObserver{},
 		stopChan:     make(chan bool),
 		isRunning:    false,
 		// Ball position and velocity are set during Reset() in Start()
@@ -84,6 +127,11 @@ func (g *PongGame) GetID() string {
 	return g.gameID
 }
 
+// Name returns the display name of the game.
+func (g *PongGame) Name() string {
+	return GAME_NAME
+}
+
 // AddPlayer adds a player to the game, assigning them a role (Player 1 or Player 2).
 func (g *PongGame) AddPlayer(player game.Player) error {
 	g.playerMux.Lock()
@@ -108,10 +156,11 @@ func (g *PongGame) AddPlayer(player game.Player) error {
 
 	// Create the internal player state
 	newPlayerState := &PongPlayerState{
-		PlayerID: playerID,
-		PaddleY:  (GAME_HEIGHT / 2) - (PADDLE_HEIGHT / 2),
-		Score:    0,
-		Role:     role,
+		PlayerID:   playerID,
+		PaddleY:    GAME_HEIGHT / 2, // The center, like everywhere else
+		Score:      0,
+		Role:       role,
+		PausesLeft: g.config.PausesPerPlayer,
 	}
 	g.players[playerID] = newPlayerState
 	g.playerMap[playerID] = player // Store the interface for sending messages
@@ -150,9 +199,63 @@ func (g *PongGame) RemovePlayer(player game.Player) {
 	}
 }
 
+// AddSpectator adds someone who watches the game. Spectators get the same
+// state and game over messages as the players but can not control anything.
+func (g *PongGame) AddSpectator(spectator game.Player) {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+	g.spectators[spectator.GetID()] = spectator
+	log.Printf("[Game %s] Spectator %s added.", g.gameID, spectator.GetID())
+}
+
+// RemoveSpectator stops sending the game to a spectator.
+func (g *PongGame) RemoveSpectator(spectator game.Player) {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+	delete(g.spectators, spectator.GetID())
+	log.Printf("[Game %s] Spectator %s removed.", g.gameID, spectator.GetID())
+}
+
+// SetRecorder makes the game record every state it sends.
+// It has to be called before the game is started.
+func (g *PongGame) SetRecorder(recorder game.Recorder) {
+	g.recorder = recorder
+}
+
+// SetObserver makes the game report its events, e.g. when it started.
+// It has to be called before the game is started.
+func (g *PongGame) SetObserver(observer game.GameObserver) {
+	g.observer = observer
+}
+
+// SetDebugSink sends every following state to the recorder as well, nil
+// stops it. Unlike SetRecorder it can be called while the game runs.
+func (g *PongGame) SetDebugSink(recorder game.Recorder) {
+	g.debugSink.Set(recorder)
+}
+
+// recipientsInternal returns everyone that should receive game messages.
+// This method requires the playerMux to be (read) locked by the caller.
+func (g *PongGame) recipientsInternal() []game.Player {
+	recipients := make([]game.Player, 0, len(g.playerMap)+len(g.spectators))
+	for _, p := range g.playerMap {
+		recipients = append(recipients, p)
+	}
+	for _, s := range g.spectators {
+		recipients = append(recipients, s)
+	}
+	return recipients
+}
+
 // Start begins the game loop if the correct number of players are present.
 func (g *PongGame) Start() {
 	g.playerMux.Lock()
+	// E.g. both players left before the game loop got going
+	if g.stopped {
+		g.playerMux.Unlock()
+		log.Printf("[Game %s] Already stopped, not starting.", g.gameID)
+		return
+	}
 	if len(g.players) != MIN_PLAYERS {
 		g.playerMux.Unlock()
 		log.Printf("[Game %s] Cannot start, requires %d players, but has %d.", g.gameID, MIN_PLAYERS, len(g.players))
@@ -169,12 +272,16 @@ func (g *PongGame) Start() {
 	}
 
 	g.isRunning = true
-	g.lastTickTime = time.Now()
-	g.Reset() // Set initial ball and paddle positions/velocities
-	g.ticker = time.NewTicker(TICK_RATE)
+	g.lastTickTime = g.clock.Now()
+	g.Reset(0) // Set initial ball and paddle positions/velocities
+	g.ticker = g.clock.NewTicker(g.config.TickRate)
 	g.playerMux.Unlock()
 
 	log.Printf("[Game %s] Starting game loop.", g.gameID)
+	g.observer.GameStarted(g.gameID, GAME_NAME)
+
+	// A bug in the game logic should only end this game and not the whole server
+	defer g.recoverFromPanic()
 
 	// Defer cleanup actions for when the loop exits
 	defer func() {
@@ -188,23 +295,18 @@ func (g *PongGame) Start() {
 	// Main game loop
 	for {
 		select {
-		case <-g.ticker.C:
+		case now := <-g.ticker.C():
 			// If the game should no longer be running, exit the loop.
 			if !g.isRunning {
 				return
 			}
 
-			// Calculate Delta Time
-			now := time.Now()
+			// Calculate Delta Time, from the time of the tick and not when
+			// we got to handle it, so a fake clock can step the game exactly
 			dt := now.Sub(g.lastTickTime).Seconds()
 			g.lastTickTime = now
 
-			g.playerMux.Lock() // Lock for update/send/checkOver
-			g.update(dt)       // Update game state (ball, collisions)
-			g.sendGameState()  // Send current state to players
-
-			gameOver, winnerID, score1, score2 := g.checkGameOver() // Check win condition
-			g.playerMux.Unlock()                                    // Unlock after checks
+			gameOver, winnerID, score1, score2 := g.tick(dt)
 
 			if gameOver {
 				log.Printf("[Game %s] Game over condition met. Winner: %s, Score: %d-%d", g.gameID, winnerID, score1, score2)
@@ -222,10 +324,68 @@ func (g *PongGame) Start() {
 	}
 }
 
-// Stop gracefully shuts down the game loop and notifies the hub.
+// tick updates the game state (ball, collisions), sends it to the players
+// and checks the win condition. The lock is released with defer, so a
+// panic inside the game logic does not leave the game locked.
+func (g *PongGame) tick(dt float64) (bool, string, int, int) {
+	g.playerMux.Lock()
+	defer g.playerMux.Unlock()
+
+	// A tick can still come in after Stop, the stopChan ends the loop right after
+	if g.stopped {
+		return false, "", 0, 0
+	}
+
+	started := g.clock.Now()
+	g.update(dt)
+	// A game that can not keep up skips every other state, see game.TickMonitor
+	if g.tickMonitor.ShouldSend() {
+		g.sendGameState()
+	}
+	g.tickMonitor.Record(g.clock.Now().Sub(started))
+	return g.checkGameOver()
+}
+
+// recoverFromPanic has to be deferred by the game loop. If the loop panics
+// the game is marked as stopped and the hub is notified with an empty result,
+// so the players are sent back to the lobby.
+func (g *PongGame) recoverFromPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("[Game %s] Game loop panicked: %v\n%s", g.gameID, r, debug.Stack())
+
+	g.playerMux.Lock()
+	alreadyStopped := g.stopped
+	g.isRunning = false
+	g.stopped = true
+	g.tickMonitor.Close()
+	select {
+	case <-g.stopChan: // Already closed
+	default:
+		close(g.stopChan)
+	}
+	finisher := g.gameFinisher
+	g.playerMux.Unlock()
+
+	// Otherwise the hub was told when the game stopped
+	if finisher != nil && !alreadyStopped {
+		finisher.GameFinished(g.gameID, game.GameResult{Scores: make(map[string]int)})
+	}
+}
+
+// Stop gracefully shuts down the game loop and notifies the hub. Only the
+// first call does anything, also if it comes before Start.
 func (g *PongGame) Stop() {
 	g.playerMux.Lock()
-	// Prevent multiple stops or stopping a non-running game.
+	if g.stopped {
+		g.playerMux.Unlock()
+		return
+	}
+	g.stopped = true
+	g.tickMonitor.Close()
+	// Stopping a game that never ran
 	if !g.isRunning {
 		// Ensure stopChan is closed even if Start() failed early
 		select {
@@ -256,7 +416,10 @@ func (g *PongGame) Stop() {
 	// Get final player states before calculating results
 	finalScores := make(map[string]int)
 	for pid, pstate := range g.players {
-		finalScores[pid] = pstate.Score
+		if game.IsBot(g.playerMap[pid]) {
+			continue
+		}
+		finalScores[pid] = g.matchScoreInternal(pstate)
 	}
 	finisher := g.gameFinisher // Copy finisher to call outside lock
 
@@ -290,9 +453,10 @@ func (g *PongGame) HandleMessage(player game.Player, msg message.Message) {
 
 	switch msg.Type {
 	case message.PongInput:
-		var payload PongInputPayload
-		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
-			log.Printf("[Game %s] Error unmarshalling PongInput from %s: %v", g.gameID, playerID, err)
+		payload, err := validateInput(msg.Payload)
+		if err != nil {
+			log.Printf("[Game %s] Invalid PongInput from %s: %v", g.gameID, playerID, err)
+			player.SendMessage(message.Error, message.ErrorMessage{Message: err.Error()})
 			return
 		}
 
@@ -309,20 +473,101 @@ func (g *PongGame) HandleMessage(player game.Player, msg message.Message) {
 		}
 		g.playerMux.Unlock()
 
+	case message.PongPauseRequest:
+		g.playerMux.Lock()
+		errMsg := g.pauseInternal(playerID)
+		g.playerMux.Unlock()
+		if errMsg != "" {
+			player.SendMessage(message.Error, message.ErrorMessage{Message: errMsg})
+		}
+
+	case message.PongResumeRequest:
+		g.playerMux.Lock()
+		if g.pausedBy != "" {
+			log.Printf("[Game %s] Player %s resumed the game.", g.gameID, playerID)
+			g.resumeInternal()
+		}
+		g.playerMux.Unlock()
+
 	default:
 		log.Printf("[Game %s] Received unhandled message type '%s' from player %s", g.gameID, msg.Type, playerID)
 	}
 }
 
+// Pauses the match for the given player. Every player only has a few pauses
+// and each ends on its own after MaxPause, so pausing can not stall the game.
+// Returns an error message for the player if the game could not be paused.
+// This method requires the playerMux to be locked by the caller.
+func (g *PongGame) pauseInternal(playerID string) string {
+	pState, ok := g.players[playerID]
+	if !ok {
+		return "Only players can pause the game"
+	}
+	if g.pausedBy != "" {
+		return "The game is already paused"
+	}
+	if pState.PausesLeft <= 0 {
+		return "You have no pauses left"
+	}
+	pState.PausesLeft--
+	g.pausedBy = playerID
+	g.pauseLeft = g.config.MaxPause
+	log.Printf("[Game %s] Player %s paused the game (%d pauses left).", g.gameID, playerID, pState.PausesLeft)
+	return ""
+}
+
+// Either player can end the pause, the one who paused or their opponent.
+// This method requires the playerMux to be locked by the caller.
+func (g *PongGame) resumeInternal() {
+	g.pausedBy = ""
+	g.pauseLeft = 0
+	// Nobody moves on into the resumed game just because they held a key
+	for _, pState := range g.players {
+		pState.MovementDirection = 0
+		pState.PaddleVY = 0
+	}
+}
+
 // --- Core Game Logic Methods ---
 
 // update advances the game state by one tick, handling ball movement and collisions.
 // This method requires the playerMux to be locked by the caller.
 func (g *PongGame) update(dt float64) {
+	// A paused game stands still, the loop keeps ticking to end the pause in time
+	if g.pausedBy != "" {
+		g.pauseLeft -= time.Duration(dt * float64(time.Second))
+		if g.pauseLeft <= 0 {
+			log.Printf("[Game %s] Pause of player %s ran out, resuming.", g.gameID, g.pausedBy)
+			g.resumeInternal()
+		}
+		return
+	}
+	g.matchTime += dt
+
+	// 0. The ball waits before the serve, but players can already reposition
+	if g.serveDelayLeft > 0 {
+		g.serveDelayLeft -= time.Duration(dt * float64(time.Second))
+		g.movePaddles(dt)
+		return
+	}
+
 	// 1. Move the ball
+	prevX := g.ballX
 	g.ballX += g.ballVX * dt
 	g.ballY += g.ballVY * dt
 
+	// Watchdog: nobody can score with a ball that only bounces up and down
+	if (prevX-GAME_WIDTH/2)*(g.ballX-GAME_WIDTH/2) <= 0 && prevX != g.ballX {
+		g.sinceMidline = 0
+	} else {
+		g.sinceMidline += time.Duration(dt * float64(time.Second))
+	}
+	if g.sinceMidline > time.Duration(float64(STUCK_BALL_TIMEOUT)/g.config.SpeedMultiplier) {
+		log.Printf("[Game %s] Ball is stuck at (%.2f, %.2f) with velocity (%.2f, %.2f), serving again.", g.gameID, g.ballX, g.ballY, g.ballVX, g.ballVY)
+		g.Reset(0)
+		return
+	}
+
 	halfBall := BALL_SIZE / 2
 
 	// 2. Check for collisions with top/bottom walls
@@ -335,17 +580,7 @@ func (g *PongGame) update(dt float64) {
 	}
 
 	// 3. Move paddles
-	for _, pState := range g.players {
-		newY := pState.PaddleY +
-			float64(pState.MovementDirection)*PADDLE_SPEED*dt
-		// Clamp paddle position within game boundaries (using center Y)
-		halfPaddle := PADDLE_HEIGHT / 2
-		pState.PaddleY = math.Max(halfPaddle, math.Min(GAME_HEIGHT-halfPaddle, newY))
-		// log.Printf("[Game %s] Player %s paddle moved to %.2f", g.gameID, playerID, pState.PaddleY)
-
-		// Reset movement direction after processing
-		pState.MovementDirection = 0
-	}
+	g.movePaddles(dt)
 
 	// 4. Check for collisions with paddles
 	var player1State, player2State *PongPlayerState
@@ -363,7 +598,7 @@ func (g *PongGame) update(dt float64) {
 		return // Cannot proceed without both players
 	}
 
-	halfPaddleH := PADDLE_HEIGHT / 2
+	halfPaddleH := g.config.PaddleHeight / 2
 
 	// Collision with Player 1's paddle (left)
 	paddle1LeftEdge := PADDLE_WIDTH
@@ -403,26 +638,70 @@ func (g *PongGame) update(dt float64) {
 	if g.ballX-halfBall <= 0 { // Ball hit left wall
 		player2State.Score++ // Player 2 scores
 		log.Printf("[Game %s] Player 2 scored! Score: %d-%d", g.gameID, player1State.Score, player2State.Score)
-		g.Reset() // Reset ball and paddles for the next round
+		g.sendPointScored(player2State, player1State.Score, player2State.Score)
+		g.Reset(1) // Reset ball and paddles, serve to player 1 who conceded
 	} else if g.ballX+halfBall >= GAME_WIDTH { // Ball hit right wall
 		player1State.Score++ // Player 1 scores
 		log.Printf("[Game %s] Player 1 scored! Score: %d-%d", g.gameID, player1State.Score, player2State.Score)
-		g.Reset() // Reset ball and paddles for the next round
+		g.sendPointScored(player1State, player1State.Score, player2State.Score)
+		g.Reset(2) // Reset ball and paddles, serve to player 2 who conceded
 	}
 }
 
+// movePaddles moves every paddle in the direction of the latest input.
+// With paddle momentum the input only sets the speed the paddle speeds up
+// to, without input it slows down until it stands still.
+// This method requires the playerMux to be locked by the caller.
+func (g *PongGame) movePaddles(dt float64) {
+	speed := PADDLE_SPEED * g.config.SpeedMultiplier
+	for _, pState := range g.players {
+		targetVY := float64(pState.MovementDirection) * speed
+		if g.config.PaddleMomentum {
+			rate := g.config.PaddleDeceleration
+			if pState.MovementDirection != 0 {
+				rate = g.config.PaddleAcceleration
+			}
+			pState.PaddleVY = approach(pState.PaddleVY, targetVY, rate*g.config.SpeedMultiplier*dt)
+		} else {
+			pState.PaddleVY = targetVY
+		}
+		newY := pState.PaddleY + pState.PaddleVY*dt
+		// Clamp paddle position within game boundaries (using center Y)
+		halfPaddle := g.config.PaddleHeight / 2
+		pState.PaddleY = math.Max(halfPaddle, math.Min(GAME_HEIGHT-halfPaddle, newY))
+		if pState.PaddleY != newY {
+			pState.PaddleVY = 0 // The paddle hit the edge and stops dead
+		}
+		// log.Printf("[Game %s] Player %s paddle moved to %.2f", g.gameID, playerID, pState.PaddleY)
+
+		// Reset movement direction after processing
+		pState.MovementDirection = 0
+	}
+}
+
+// Moves value towards target by at most step
+func approach(value, target, step float64) float64 {
+	if value < target {
+		return math.Min(value+step, target)
+	}
+	return math.Max(value-step, target)
+}
+
 // increaseBallSpeed slightly increases the ball's speed, capping at max values.
 // This method requires the playerMux to be locked by the caller.
 func (g *PongGame) increaseBallSpeed() {
 	newVX := g.ballVX * SPEED_INCREASE
 	newVY := g.ballVY * SPEED_INCREASE
 
-	// Apply caps, preserving sign
-	if math.Abs(newVX) > MAX_BALL_SPEED_X {
-		newVX = math.Copysign(MAX_BALL_SPEED_X, newVX)
+	// Apply caps, preserving sign. The caps scale with the speed multiplier
+	// so a slowed down game still ramps up the same relative amount.
+	maxVX := MAX_BALL_SPEED_X * g.config.SpeedMultiplier
+	maxVY := MAX_BALL_SPEED_Y * g.config.SpeedMultiplier
+	if math.Abs(newVX) > maxVX {
+		newVX = math.Copysign(maxVX, newVX)
 	}
-	if math.Abs(newVY) > MAX_BALL_SPEED_Y {
-		newVY = math.Copysign(MAX_BALL_SPEED_Y, newVY)
+	if math.Abs(newVY) > maxVY {
+		newVY = math.Copysign(maxVY, newVY)
 	}
 
 	g.ballVX = newVX
@@ -450,16 +729,112 @@ func (g *PongGame) checkGameOver() (gameOver bool, winnerID string, score1 int,
 	score1 = p1State.Score
 	score2 = p2State.Score
 
-	if score1 >= TARGET_SCORE {
-		return true, p1State.PlayerID, score1, score2
+	var setWinner *PongPlayerState
+	if score1 >= g.config.TargetScore {
+		setWinner = p1State
+	} else if score2 >= g.config.TargetScore {
+		setWinner = p2State
 	}
-	if score2 >= TARGET_SCORE {
-		return true, p2State.PlayerID, score1, score2
+	if setWinner != nil {
+		setWinner.SetsWon++
+		if setWinner.SetsWon >= g.setsToWin() {
+			return true, setWinner.PlayerID, score1, score2
+		}
+		g.startNextSetInternal(setWinner, p1State, p2State)
+		return false, "", p1State.Score, p2State.Score
+	}
+
+	// Out of time, the leader wins. That is who won more sets and then who has
+	// more points in the current set. On a tie it is sudden death and this
+	// check ends the game with the next point.
+	if g.config.MaxDuration > 0 && g.matchTime >= g.config.MaxDuration.Seconds() {
+		if p1State.SetsWon > p2State.SetsWon || (p1State.SetsWon == p2State.SetsWon && score1 > score2) {
+			return true, p1State.PlayerID, score1, score2
+		}
+		if p2State.SetsWon > p1State.SetsWon || (p1State.SetsWon == p2State.SetsWon && score2 > score1) {
+			return true, p2State.PlayerID, score1, score2
+		}
+		if !g.suddenDeath {
+			g.suddenDeath = true
+			log.Printf("[Game %s] Time is up at %d-%d, sudden death!", g.gameID, score1, score2)
+			for _, player := range g.recipientsInternal() {
+				player.SendMessage(message.SuddenDeath, nil)
+			}
+		}
 	}
 
 	return false, "", score1, score2
 }
 
+// Sets needed to win the match, the majority of Sets
+func (g *PongGame) setsToWin() int {
+	return max(g.config.Sets, 1)/2 + 1
+}
+
+// What the hub adds to the score of a player: the points with a single set,
+// the sets won in a best-of match, so the match winner always gets more.
+// This method requires the playerMux to be (read) locked by the caller.
+func (g *PongGame) matchScoreInternal(pState *PongPlayerState) int {
+	if g.setsToWin() > 1 {
+		return pState.SetsWon
+	}
+	return pState.Score
+}
+
+// Tells everyone who won the set, then the players swap sides and the next
+// set starts after a break.
+// This method requires the playerMux to be locked by the caller.
+func (g *PongGame) startNextSetInternal(winner, p1State, p2State *PongPlayerState) {
+	payload := PongSetOverPayload{
+		Set:      p1State.SetsWon + p2State.SetsWon,
+		WinnerID: winner.PlayerID,
+		Score1:   p1State.Score,
+		Score2:   p2State.Score,
+		SetsWon:  map[string]int{p1State.PlayerID: p1State.SetsWon, p2State.PlayerID: p2State.SetsWon},
+	}
+	if player, ok := g.playerMap[winner.PlayerID]; ok {
+		payload.WinnerName = player.GetName()
+	}
+	log.Printf("[Game %s] Player %s won set %d %d-%d. Sets: %d-%d", g.gameID, winner.PlayerID, payload.Set, p1State.Score, p2State.Score, p1State.SetsWon, p2State.SetsWon)
+	if g.recorder != nil {
+		g.recorder.RecordFrame(message.PongSetOver, payload)
+	}
+	for _, player := range g.recipientsInternal() {
+		if err := player.SendMessage(message.PongSetOver, payload); err != nil {
+			log.Printf("[Game %s] Error sending set over to player %s: %v", g.gameID, player.GetID(), err)
+		}
+	}
+
+	p1State.Score = 0
+	p2State.Score = 0
+	p1State.Role, p2State.Role = 2, 1
+	// The loser of the set gets the serve, p1State is the one who played left
+	loser := p1State
+	if winner == p1State {
+		loser = p2State
+	}
+	g.Reset(loser.Role)
+	g.serveDelayLeft = max(g.config.ServeDelay, SET_BREAK)
+}
+
+// sendPointScored tells everyone who scored and the new score.
+// This method requires the playerMux to be (read) locked by the caller.
+func (g *PongGame) sendPointScored(scorer *PongPlayerState, score1, score2 int) {
+	payload := PongPointScoredPayload{
+		ScorerID: scorer.PlayerID,
+		Score1:   score1,
+		Score2:   score2,
+	}
+	if player, ok := g.playerMap[scorer.PlayerID]; ok {
+		payload.ScorerName = player.GetName()
+	}
+	for _, player := range g.recipientsInternal() {
+		if err := player.SendMessage(message.PongPointScored, payload); err != nil {
+			log.Printf("[Game %s] Error sending point scored to player %s: %v", g.gameID, player.GetID(), err)
+		}
+	}
+}
+
 // sendGameState broadcasts the current game state to all connected players.
 // This method requires the playerMux to be locked by the caller.
 func (g *PongGame) sendGameState() {
@@ -477,24 +852,57 @@ func (g *PongGame) sendGameState() {
 		return
 	}
 
+	// The velocity the ball actually moves with, it stands still during the serve delay and a pause
+	ballVX, ballVY := g.ballVX, g.ballVY
+	if g.serveDelayLeft > 0 || g.pausedBy != "" {
+		ballVX, ballVY = 0, 0
+	}
+
 	// Create the state payload using data from the assigned roles.
 	statePayload := PongStatePayload{
-		Player1:  p1State.PlayerID,
-		Player2:  p2State.PlayerID,
+		Player1: p1State.PlayerID,
+		Player2: p2State.PlayerID,
+
+		Player1Name: g.playerMap[p1State.PlayerID].GetName(),
+		Player2Name: g.playerMap[p2State.PlayerID].GetName(),
+
 		BallX:    g.ballX,
 		BallY:    g.ballY,
+		BallVX:   ballVX,
+		BallVY:   ballVY,
 		Paddle1Y: p1State.PaddleY,
 		Paddle2Y: p2State.PaddleY,
 		Score1:   p1State.Score,
 		Score2:   p2State.Score,
+
+		PaddleHeight: g.config.PaddleHeight,
+		BallSpeed:    math.Hypot(ballVX, ballVY),
+
+		Paused:      g.pausedBy != "",
+		PausedBy:    g.pausedBy,
+		PauseLeftMs: g.pauseLeft.Milliseconds(),
+
+		SuddenDeath: g.suddenDeath,
+
+		Set:      p1State.SetsWon + p2State.SetsWon + 1,
+		Sets:     max(g.config.Sets, 1),
+		SetsWon1: p1State.SetsWon,
+		SetsWon2: p2State.SetsWon,
 	}
 
-	// Send the state to all players currently in the game map.
-	for playerID, player := range g.playerMap {
+	if g.recorder != nil {
+		g.recorder.RecordFrame(message.PongState, statePayload)
+	}
+	if sink := g.debugSink.Get(); sink != nil {
+		sink.RecordFrame(message.PongState, statePayload)
+	}
+
+	// Send the state to all players and spectators currently in the game.
+	for _, player := range g.recipientsInternal() {
 		err := player.SendMessage(message.PongState, statePayload)
 		if err != nil {
 			// Log error, hub's unregister mechanism should handle disconnects.
-			log.Printf("[Game %s] Error sending state to player %s: %v", g.gameID, playerID, err)
+			log.Printf("[Game %s] Error sending state to player %s: %v", g.gameID, player.GetID(), err)
 		}
 	}
 }
@@ -509,45 +917,85 @@ func (g *PongGame) sendGameOver(winnerID string, score1, score2 int) {
 	}
 
 	g.playerMux.RLock() // Use RLock as we are only reading playerMap
-	playersToSend := make([]game.Player, 0, len(g.playerMap))
-	for _, p := range g.playerMap {
-		playersToSend = append(playersToSend, p)
+	playersToSend := g.recipientsInternal()
+	isPlayer := make(map[string]bool, len(g.players)) // Spectators did not win or lose
+	for playerID, pState := range g.players {
+		isPlayer[playerID] = true
+		name := g.playerMap[playerID].GetName()
+		if pState.Role == 1 {
+			gameOverPayload.Player1Name = name
+			gameOverPayload.SetsWon1 = pState.SetsWon
+		} else if pState.Role == 2 {
+			gameOverPayload.Player2Name = name
+			gameOverPayload.SetsWon2 = pState.SetsWon
+		}
 	}
 	g.playerMux.RUnlock() // Release lock before sending
 
+	if g.recorder != nil {
+		g.recorder.RecordFrame(message.PongGameOver, gameOverPayload)
+	}
+
 	log.Printf("[Game %s] Sending game over message. Winner: %s, Score: %d-%d", g.gameID, winnerID, score1, score2)
 	for _, player := range playersToSend {
-		err := player.SendMessage(message.PongGameOver, gameOverPayload)
+		// Everyone gets their own copy, so the players can see if they won
+		payload := gameOverPayload
+		if isPlayer[player.GetID()] {
+			payload.Result = playerResult(player.GetID(), winnerID)
+		}
+		err := player.SendMessage(message.PongGameOver, payload)
 		if err != nil {
 			log.Printf("[Game %s] Error sending game over to player %s: %v", g.gameID, player.GetID(), err)
 		}
 	}
 }
 
-// Reset sets the ball and paddles to their starting positions and assigns
-// a random initial velocity to the ball.
+// A match without a winner, e.g. stopped early, counts as a draw
+func playerResult(playerID, winnerID string) string {
+	switch winnerID {
+	case "":
+		return game.RESULT_DRAW
+	case playerID:
+		return game.RESULT_WIN
+	default:
+		return game.RESULT_LOSS
+	}
+}
+
+// Reset sets the ball and paddles to their starting positions and serves
+// the ball toward the player with the given role (the one who just conceded),
+// 0 serves in a random direction. The ball only starts moving after the serve delay.
 // This method requires the playerMux to be locked by the caller.
-func (g *PongGame) Reset() {
+func (g *PongGame) Reset(serveToRole int) {
 	// Center the ball
 	g.ballX = GAME_WIDTH / 2
 	g.ballY = GAME_HEIGHT / 2
 
-	// Assign random initial horizontal direction
-	vx := INITIAL_BALL_VX
-	if rand.Intn(2) == 0 {
+	// Player 1 is on the left, so serving to them means moving left
+	vx := INITIAL_BALL_VX * g.config.SpeedMultiplier
+	switch serveToRole {
+	case 1:
 		vx = -vx
+	case 2:
+	default:
+		if rand.Intn(2) == 0 {
+			vx = -vx
+		}
 	}
 	// Assign random initial vertical direction
-	vy := INITIAL_BALL_VY
+	vy := INITIAL_BALL_VY * g.config.SpeedMultiplier
 	if rand.Intn(2) == 0 {
 		vy = -vy
 	}
 	g.ballVX = vx
 	g.ballVY = vy
+	g.serveDelayLeft = g.config.ServeDelay
+	g.sinceMidline = 0
 
 	// Reset paddle positions
 	for _, pState := range g.players {
 		pState.PaddleY = GAME_HEIGHT / 2
+		pState.PaddleVY = 0
 	}
 	log.Printf("[Game %s] Round reset. Ball velocity: (%.2f, %.2f)", g.gameID, g.ballVX, g.ballVY)
 }
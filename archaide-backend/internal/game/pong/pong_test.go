@@ -0,0 +1,468 @@
+package pong
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/game/gametest"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+func newTestGame(t *testing.T) (*PongGame, *gametest.FakeFinisher, *gametest.FakePlayer, *gametest.FakePlayer) {
+	t.Helper()
+	finisher := gametest.NewFakeFinisher()
+	g := NewPongGame(finisher, "test-game", DefaultPongConfig(), gametest.NewFakeClock())
+	p1 := gametest.NewFakePlayer("p1")
+	p2 := gametest.NewFakePlayer("p2")
+	if err := g.AddPlayer(p1); err != nil {
+		t.Fatalf("adding p1: %v", err)
+	}
+	if err := g.AddPlayer(p2); err != nil {
+		t.Fatalf("adding p2: %v", err)
+	}
+	return g, finisher, p1, p2
+}
+
+func TestPaddlesAreCenteredAndStayInTheField(t *testing.T) {
+	g, _, _, _ := newTestGame(t)
+	p1 := g.players["p1"]
+	if p1.PaddleY != GAME_HEIGHT/2 {
+		t.Errorf("paddle starts at %.1f, want the center %.1f", p1.PaddleY, GAME_HEIGHT/2)
+	}
+
+	// Moving up for long enough stops with the top of the paddle at the edge
+	for range 100 {
+		p1.MovementDirection = -1
+		g.movePaddles(0.1)
+	}
+	if want := g.config.PaddleHeight / 2; p1.PaddleY != want {
+		t.Errorf("paddle stopped at %.1f, want %.1f", p1.PaddleY, want)
+	}
+}
+
+func TestPaddleMomentumRampsUpAndCoastsToAStop(t *testing.T) {
+	g, _, _, _ := newTestGame(t)
+	g.config.PaddleMomentum = true
+	p1 := g.players["p1"]
+	p1.PaddleY = g.config.PaddleHeight / 2 // At the top, so it has room to coast down
+	const dt = 0.01
+
+	// The first tick of input only gets the paddle going
+	p1.MovementDirection = 1
+	g.movePaddles(dt)
+	if p1.PaddleVY >= PADDLE_SPEED {
+		t.Fatalf("paddle is at %.1f px/s after one tick, want it to speed up first", p1.PaddleVY)
+	}
+
+	// Holding the direction reaches the full speed
+	for range 30 {
+		p1.MovementDirection = 1
+		g.movePaddles(dt)
+	}
+	if p1.PaddleVY != PADDLE_SPEED {
+		t.Fatalf("paddle is at %.1f px/s while held, want %.1f", p1.PaddleVY, float64(PADDLE_SPEED))
+	}
+
+	// Released it keeps moving for a bit and then stands still
+	released := p1.PaddleY
+	g.movePaddles(dt)
+	if p1.PaddleY <= released || p1.PaddleVY <= 0 {
+		t.Errorf("released paddle stopped dead at %.1f", p1.PaddleY)
+	}
+	for range 100 {
+		g.movePaddles(dt)
+	}
+	if p1.PaddleVY != 0 {
+		t.Errorf("paddle still moves at %.1f px/s long after the release", p1.PaddleVY)
+	}
+	if maxY := GAME_HEIGHT - g.config.PaddleHeight/2; p1.PaddleY > maxY {
+		t.Errorf("paddle coasted to %.1f, out of the field", p1.PaddleY)
+	}
+}
+
+func TestBallHittingLeftWallScoresForPlayer2(t *testing.T) {
+	g, _, p1, _ := newTestGame(t)
+	g.Reset(0)
+	g.serveDelayLeft = 0
+
+	// Put the ball right in front of the left wall, far away from the paddle
+	g.ballX = BALL_SIZE
+	g.ballY = BALL_SIZE
+	g.ballVX = -INITIAL_BALL_VX
+	g.ballVY = 0
+	g.update(0.1)
+
+	if got := g.players["p2"].Score; got != 1 {
+		t.Errorf("player 2 score = %d, want 1", got)
+	}
+	if got := g.players["p1"].Score; got != 0 {
+		t.Errorf("player 1 score = %d, want 0", got)
+	}
+	if g.ballX != GAME_WIDTH/2 || g.ballY != GAME_HEIGHT/2 {
+		t.Errorf("ball was not reset to the center, got (%.2f, %.2f)", g.ballX, g.ballY)
+	}
+
+	var scored PongPointScoredPayload
+	if !p1.Last(message.PongPointScored, &scored) {
+		t.Fatal("player 1 was not told about the point")
+	}
+	if scored.ScorerID != "p2" || scored.ScorerName != "Player p2" || scored.Score1 != 0 || scored.Score2 != 1 {
+		t.Errorf("got %+v, want player 2 scoring to 0-1", scored)
+	}
+}
+
+func TestServeGoesToPlayerWhoConceded(t *testing.T) {
+	g, _, _, _ := newTestGame(t)
+
+	g.Reset(1)
+	if g.ballVX >= 0 {
+		t.Errorf("serve to player 1 has VX %.2f, want it moving left", g.ballVX)
+	}
+	g.Reset(2)
+	if g.ballVX <= 0 {
+		t.Errorf("serve to player 2 has VX %.2f, want it moving right", g.ballVX)
+	}
+
+	// The ball waits in the center until the serve delay is over
+	g.update(0.5)
+	if g.ballX != GAME_WIDTH/2 || g.ballY != GAME_HEIGHT/2 {
+		t.Errorf("ball moved during the serve delay to (%.2f, %.2f)", g.ballX, g.ballY)
+	}
+	g.update(0.6)
+	g.update(0.1)
+	if g.ballX == GAME_WIDTH/2 {
+		t.Error("ball did not move after the serve delay")
+	}
+}
+
+func TestStateCarriesTheBallVelocity(t *testing.T) {
+	g, _, p1, _ := newTestGame(t)
+	g.Reset(2)
+
+	// Waiting for the serve the ball stands still
+	g.sendGameState()
+	var state PongStatePayload
+	p1.Last(message.PongState, &state)
+	if state.BallVX != 0 || state.BallVY != 0 || state.BallSpeed != 0 {
+		t.Errorf("got velocity (%.1f, %.1f) during the serve delay, want 0", state.BallVX, state.BallVY)
+	}
+
+	g.serveDelayLeft = 0
+	g.sendGameState()
+	p1.Last(message.PongState, &state)
+	if state.BallVX != g.ballVX || state.BallVY != g.ballVY {
+		t.Errorf("got velocity (%.1f, %.1f), want (%.1f, %.1f)", state.BallVX, state.BallVY, g.ballVX, g.ballVY)
+	}
+	if want := math.Hypot(g.ballVX, g.ballVY); state.BallSpeed != want {
+		t.Errorf("got speed %.1f, want %.1f", state.BallSpeed, want)
+	}
+}
+
+func TestGameOverReportsScoresToFinisher(t *testing.T) {
+	g, finisher, p1, p2 := newTestGame(t)
+	g.isRunning = true
+	g.players["p1"].Score = g.config.TargetScore
+	g.players["p2"].Score = 2
+
+	gameOver, winnerID, score1, score2 := g.checkGameOver()
+	if !gameOver || winnerID != "p1" {
+		t.Fatalf("checkGameOver() = %v, %q, want true, \"p1\"", gameOver, winnerID)
+	}
+	g.sendGameOver(winnerID, score1, score2)
+	g.Stop()
+
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("GameFinished was not called")
+	}
+	result, _ := finisher.Result()
+	if result.Scores["p1"] != g.config.TargetScore || result.Scores["p2"] != 2 {
+		t.Errorf("unexpected final scores: %v", result.Scores)
+	}
+
+	for _, p := range []*gametest.FakePlayer{p1, p2} {
+		var payload PongGameOverPayload
+		if !p.Last(message.PongGameOver, &payload) {
+			t.Fatalf("player %s did not receive a game over message", p.ID)
+		}
+		if payload.Winner != "p1" {
+			t.Errorf("player %s got winner %q, want \"p1\"", p.ID, payload.Winner)
+		}
+	}
+	for _, want := range []struct {
+		player *gametest.FakePlayer
+		result string
+	}{{p1, game.RESULT_WIN}, {p2, game.RESULT_LOSS}} {
+		var payload PongGameOverPayload
+		want.player.Last(message.PongGameOver, &payload)
+		if payload.Result != want.result {
+			t.Errorf("player %s got result %q, want %q", want.player.ID, payload.Result, want.result)
+		}
+	}
+}
+
+// The AI reacts to every state it saw once its reaction delay is over,
+// the delay shifts its decisions but does not slow them down
+func TestAIReactsToEveryStateAfterItsDelay(t *testing.T) {
+	seen := seenStates{delay: 100 * time.Millisecond}
+	start := time.Unix(0, 0)
+	seen.add(PongStatePayload{BallY: 1}, start)
+	seen.add(PongStatePayload{BallY: 2}, start.Add(10*time.Millisecond))
+
+	if wait, ok := seen.wait(start); !ok || wait != 100*time.Millisecond {
+		t.Errorf("wait() = %s, %v, want 100ms", wait, ok)
+	}
+	if _, ok := seen.take(start.Add(50 * time.Millisecond)); ok {
+		t.Fatal("AI reacted before its reaction delay was over")
+	}
+
+	tests := []struct {
+		at        time.Duration
+		wantBallY float64
+	}{
+		{100 * time.Millisecond, 1},
+		{110 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		state, ok := seen.take(start.Add(tt.at))
+		if !ok || state.BallY != tt.wantBallY {
+			t.Errorf("take() at %s = ball at %.0f, %v, want ball at %.0f", tt.at, state.BallY, ok, tt.wantBallY)
+		}
+	}
+	if _, ok := seen.wait(start.Add(time.Second)); ok {
+		t.Error("AI still waits to react after it reacted to everything")
+	}
+}
+
+// Blows up as soon as the game sends it anything
+func TestPanicInGameLoopFinishesGame(t *testing.T) {
+	finisher := gametest.NewFakeFinisher()
+	// Runs the real game loop, so it needs real ticks
+	g := NewPongGame(finisher, "test-game", DefaultPongConfig(), game.RealClock{})
+	g.AddPlayer(gametest.NewFakePlayer("p1"))
+	g.AddPlayer(gametest.NewPanickingPlayer("p2"))
+
+	go g.Start()
+
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("GameFinished was not called after the game loop panicked")
+	}
+	if result, _ := finisher.Result(); len(result.Scores) != 0 {
+		t.Errorf("got scores %v, want an empty result", result.Scores)
+	}
+	// The lock has to be released again, otherwise this blocks forever
+	g.playerMux.Lock()
+	running := g.isRunning
+	g.playerMux.Unlock()
+	if running {
+		t.Error("game is still marked as running")
+	}
+}
+
+func TestStartAfterStopDoesNothing(t *testing.T) {
+	g, finisher, _, _ := newTestGame(t)
+
+	g.Stop()
+	g.Stop()
+	// Would block in the game loop if it started
+	g.Start()
+
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("GameFinished was not called")
+	}
+	// Give a second notification the chance to arrive
+	time.Sleep(time.Millisecond)
+	if calls := len(finisher.Calls()); calls != 1 {
+		t.Fatalf("GameFinished was called %d times, want 1", calls)
+	}
+	if g.isRunning {
+		t.Error("stopped game started running")
+	}
+}
+
+func TestTickAfterStopLeavesNoMetric(t *testing.T) {
+	g, _, _, _ := newTestGame(t)
+	g.tick(0.01) // Registers the game with the metrics
+	g.Stop()
+
+	// The loop can still get one more tick in after the stop
+	g.tick(0.01)
+	if metric := expvar.Get("game_tick_micros").(*expvar.Map).Get(g.gameID); metric != nil {
+		t.Errorf("stopped game is still in the tick metrics: %v", metric)
+	}
+}
+
+func TestGameLoopStepsFrameByFrame(t *testing.T) {
+	clock := gametest.NewFakeClock()
+	config := DefaultPongConfig()
+	config.ServeDelay = 0
+	g := NewPongGame(gametest.NewFakeFinisher(), "test-game", config, clock)
+	p1 := gametest.NewFakePlayer("p1")
+	g.AddPlayer(p1)
+	g.AddPlayer(gametest.NewFakePlayer("p2"))
+
+	go g.Start()
+	defer g.Stop()
+	clock.BlockUntilTickers(1)
+
+	const frames = 5
+	// The loop is only done with a frame once it received the next one
+	for i := 0; i <= frames; i++ {
+		clock.Advance(config.TickRate)
+	}
+
+	states := p1.MessagesOfType(message.PongState)
+	if len(states) < frames {
+		t.Fatalf("got %d state frames, want at least %d", len(states), frames)
+	}
+	for i := 0; i < frames; i++ {
+		var state PongStatePayload
+		if err := json.Unmarshal(states[i].Payload, &state); err != nil {
+			t.Fatalf("decoding frame %d: %v", i, err)
+		}
+		want := float64(i+1) * INITIAL_BALL_VX * config.TickRate.Seconds()
+		if moved := math.Abs(state.BallX - GAME_WIDTH/2); math.Abs(moved-want) > 1e-9 {
+			t.Errorf("frame %d: ball moved %.6f, want %.6f", i, moved, want)
+		}
+	}
+}
+
+func TestPauseFreezesBallUntilItRunsOut(t *testing.T) {
+	g, _, p1, _ := newTestGame(t)
+	g.isRunning = true
+	g.Reset(0)
+	g.serveDelayLeft = 0
+	g.config.MaxPause = time.Second
+	g.config.PausesPerPlayer = 1
+	g.players["p1"].PausesLeft = 1
+
+	g.HandleMessage(p1, message.Message{Type: message.PongPauseRequest})
+	ballX := g.ballX
+	g.update(0.5)
+	if g.ballX != ballX || g.pausedBy != "p1" {
+		t.Fatalf("ball moved to %.1f during the pause (paused by %q)", g.ballX, g.pausedBy)
+	}
+
+	// The pause runs out on its own
+	g.update(0.6)
+	if g.pausedBy != "" {
+		t.Fatal("pause did not end after MaxPause")
+	}
+
+	// And p1 used up their only pause
+	g.HandleMessage(p1, message.Message{Type: message.PongPauseRequest})
+	if g.pausedBy != "" {
+		t.Error("p1 paused again without pauses left")
+	}
+	if len(p1.MessagesOfType(message.Error)) != 1 {
+		t.Error("p1 was not told that they have no pauses left")
+	}
+}
+
+func TestBestOfThreeGoesToTheFirstWithTwoSets(t *testing.T) {
+	finisher := gametest.NewFakeFinisher()
+	config := DefaultPongConfig()
+	config.Sets = 3
+	g := NewPongGame(finisher, "test-game", config, gametest.NewFakeClock())
+	p1 := gametest.NewFakePlayer("p1")
+	g.AddPlayer(p1)
+	g.AddPlayer(gametest.NewFakePlayer("p2"))
+	g.isRunning = true
+
+	// p1 takes the first set
+	g.players["p1"].Score = config.TargetScore
+	g.players["p2"].Score = 3
+	if gameOver, _, _, _ := g.checkGameOver(); gameOver {
+		t.Fatal("match ended after the first set")
+	}
+	var setOver PongSetOverPayload
+	if !p1.Last(message.PongSetOver, &setOver) {
+		t.Fatal("players were not told that the set is over")
+	}
+	if setOver.Set != 1 || setOver.WinnerID != "p1" || setOver.Score1 != config.TargetScore || setOver.Score2 != 3 {
+		t.Errorf("got %+v, want set 1 to p1 with %d-3", setOver, config.TargetScore)
+	}
+	// Back to 0 points, on the other side and with a longer break
+	if g.players["p1"].Score != 0 || g.players["p1"].Role != 2 || g.players["p2"].Role != 1 {
+		t.Errorf("p1 starts the next set with %d points as player %d, want 0 as player 2", g.players["p1"].Score, g.players["p1"].Role)
+	}
+	if g.serveDelayLeft != SET_BREAK {
+		t.Errorf("break between the sets is %s, want %s", g.serveDelayLeft, SET_BREAK)
+	}
+
+	// And the second one, which decides the match
+	g.players["p1"].Score = config.TargetScore
+	gameOver, winnerID, _, _ := g.checkGameOver()
+	if !gameOver || winnerID != "p1" {
+		t.Fatalf("checkGameOver() = %v, %q, want true, \"p1\"", gameOver, winnerID)
+	}
+	g.Stop()
+	select {
+	case <-finisher.Done():
+	case <-time.After(time.Second):
+		t.Fatal("GameFinished was not called")
+	}
+	// The result has the sets, so the match winner gets more
+	if result, _ := finisher.Result(); result.Scores["p1"] != 2 || result.Scores["p2"] != 0 {
+		t.Errorf("got scores %v, want the sets won", result.Scores)
+	}
+}
+
+func TestTiedGameGoesToSuddenDeathWhenTimeIsUp(t *testing.T) {
+	g, _, p1, _ := newTestGame(t)
+	g.players["p1"].Score = 2
+	g.players["p2"].Score = 2
+	g.matchTime = g.config.MaxDuration.Seconds()
+
+	if gameOver, _, _, _ := g.checkGameOver(); gameOver {
+		t.Fatal("tied game ended when the time ran out")
+	}
+	if !g.suddenDeath || len(p1.MessagesOfType(message.SuddenDeath)) != 1 {
+		t.Fatal("players were not told about the sudden death")
+	}
+
+	// The next point decides
+	g.players["p2"].Score++
+	if gameOver, winnerID, _, _ := g.checkGameOver(); !gameOver || winnerID != "p2" {
+		t.Errorf("checkGameOver() = %v, %q, want true, \"p2\"", gameOver, winnerID)
+	}
+}
+
+func TestStuckBallIsServedAgain(t *testing.T) {
+	g, _, _, _ := newTestGame(t)
+	g.Reset(0)
+	g.serveDelayLeft = 0
+
+	// Almost vertical, it would take ages to reach the midline
+	g.ballX = GAME_WIDTH / 4
+	g.ballVX = 0.001
+	g.ballVY = INITIAL_BALL_VY
+
+	const dt = 0.1
+	served := false
+	for elapsed := 0.0; elapsed <= STUCK_BALL_TIMEOUT.Seconds()+dt; elapsed += dt {
+		g.update(dt)
+		if g.ballX == GAME_WIDTH/2 {
+			served = true
+			break
+		}
+	}
+	if !served {
+		t.Fatalf("ball is still at x=%.2f after %s", g.ballX, STUCK_BALL_TIMEOUT)
+	}
+	if wantVX := INITIAL_BALL_VX * g.config.SpeedMultiplier; math.Abs(g.ballVX) != wantVX {
+		t.Errorf("ball was served with VX %.2f, want %.2f", math.Abs(g.ballVX), wantVX)
+	}
+	if g.players["p1"].Score != 0 || g.players["p2"].Score != 0 {
+		t.Error("serving a stuck ball again must not score")
+	}
+}
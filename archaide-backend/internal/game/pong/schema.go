@@ -0,0 +1,38 @@
+package pong
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// InputSchema is the JSON schema of the pong_input payload. It is served to
+// the frontend and validateInput accepts exactly what it describes.
+var InputSchema = []byte(`{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "pong_input",
+  "type": "object",
+  "properties": {
+    "direction": { "type": "string", "enum": ["up", "down"] }
+  },
+  "required": ["direction"],
+  "additionalProperties": false
+}`)
+
+func (g *PongGame) InputSchema() []byte {
+	return InputSchema
+}
+
+// Decodes a pong_input payload and checks it against the InputSchema
+func validateInput(raw json.RawMessage) (PongInputPayload, error) {
+	var payload PongInputPayload
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return payload, fmt.Errorf("invalid pong_input payload: %v", err)
+	}
+	if payload.Direction != "up" && payload.Direction != "down" {
+		return payload, fmt.Errorf("invalid pong_input payload: direction has to be \"up\" or \"down\", got %q", payload.Direction)
+	}
+	return payload, nil
+}
@@ -0,0 +1,105 @@
+package game
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// Games declare the message types they own here, so a game can bring its own
+// types without touching the message package. The hub routes a registered
+// type only to the game that owns it and /protocol.json describes it.
+// The lobby types in message.Payloads can not be registered.
+
+// A MessageHandler takes care of one registered message type. It gets the
+// running game the message was sent to, so one handler serves every instance.
+type MessageHandler func(activeGame Game, player Player, msg message.Message)
+
+var (
+	registryMux     sync.RWMutex
+	messageOwners   = map[message.MessageType]string{}         // Key: message type, Value: name of the game
+	messagePayloads = map[string]map[message.MessageType]any{} // Key: name of the game
+	messageHandlers = map[message.MessageType]MessageHandler{}
+)
+
+// RegisterMessages declares the message types of a game, with an example of
+// their payload like in message.Payloads. Games call it from an init function.
+func RegisterMessages(gameName string, payloads map[message.MessageType]any) error {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+
+	for msgType := range payloads {
+		if _, isCore := message.Payloads[msgType]; isCore {
+			return fmt.Errorf("message type %s belongs to the lobby and can not be registered by %s", msgType, gameName)
+		}
+		if owner, taken := messageOwners[msgType]; taken && owner != gameName {
+			return fmt.Errorf("message type %s of %s is already registered by %s", msgType, gameName, owner)
+		}
+	}
+
+	if messagePayloads[gameName] == nil {
+		messagePayloads[gameName] = map[message.MessageType]any{}
+	}
+	for msgType, payload := range payloads {
+		messageOwners[msgType] = gameName
+		messagePayloads[gameName][msgType] = payload
+	}
+	return nil
+}
+
+// MustRegisterMessages is like RegisterMessages but panics on a conflict,
+// which is a programming error that should stop the server from starting
+func MustRegisterMessages(gameName string, payloads map[message.MessageType]any) {
+	if err := RegisterMessages(gameName, payloads); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterHandler makes the hub hand the message type to the handler instead
+// of the HandleMessage of the game. The game has to register the type first.
+func RegisterHandler(gameName string, msgType message.MessageType, handler MessageHandler) error {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+
+	owner, owned := messageOwners[msgType]
+	if !owned {
+		return fmt.Errorf("message type %s of %s is not registered", msgType, gameName)
+	}
+	if owner != gameName {
+		return fmt.Errorf("message type %s is registered by %s, not by %s", msgType, owner, gameName)
+	}
+	messageHandlers[msgType] = handler
+	return nil
+}
+
+// MustRegisterHandler is like RegisterHandler but panics if it fails
+func MustRegisterHandler(gameName string, msgType message.MessageType, handler MessageHandler) {
+	if err := RegisterHandler(gameName, msgType, handler); err != nil {
+		panic(err)
+	}
+}
+
+// MessageHandlerFor returns the handler registered for the message type
+func MessageHandlerFor(msgType message.MessageType) (MessageHandler, bool) {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	handler, ok := messageHandlers[msgType]
+	return handler, ok
+}
+
+// MessageOwner returns the name of the game that registered the message type
+func MessageOwner(msgType message.MessageType) (string, bool) {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	owner, ok := messageOwners[msgType]
+	return owner, ok
+}
+
+// MessagePayloads returns a copy of the message types the game registered
+func MessagePayloads(gameName string) map[message.MessageType]any {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	return maps.Clone(messagePayloads[gameName])
+}
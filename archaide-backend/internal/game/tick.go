@@ -0,0 +1,95 @@
+package game
+
+import (
+	"expvar"
+	"log"
+	"time"
+)
+
+// The average time the work of a tick takes per running game in
+// microseconds, served with the other expvars on /debug/vars
+var tickDurations = expvar.NewMap("game_tick_micros")
+
+const (
+	// Ticks in a row over the budget before a game degrades, about a second at 30 FPS
+	SLOW_TICKS_TO_DEGRADE = 30
+	// Ticks in a row within the budget before it sends every state again
+	FAST_TICKS_TO_RECOVER = 30
+)
+
+// TickMonitor measures how long the work of each tick of a game loop takes.
+// If a game is over the tick interval for too long the ticks pile up and the
+// game slows down for everyone. Then it degrades: the physics keep their pace,
+// but the state is only sent every other tick until it is fast again.
+// It is not safe for concurrent use, the games call it with their lock held.
+type TickMonitor struct {
+	gameID     string
+	budget     time.Duration
+	average    time.Duration
+	metric     *expvar.Int // Registered with the first tick, so games that never run do not show up
+	ticks      int
+	sending    bool // The current tick sends the state
+	slowStreak int
+	fastStreak int
+	degraded   bool
+	closed     bool // After Close a late tick must not register the game again
+}
+
+// NewTickMonitor creates a monitor for a game that ticks every interval
+func NewTickMonitor(gameID string, interval time.Duration) *TickMonitor {
+	return &TickMonitor{gameID: gameID, budget: interval}
+}
+
+// ShouldSend has to be called once per tick and tells if the tick sends
+// the state. That is every tick unless the game is degraded.
+func (m *TickMonitor) ShouldSend() bool {
+	m.ticks++
+	m.sending = !m.degraded || m.ticks%2 == 0
+	return m.sending
+}
+
+// Record takes the time the work of the current tick took
+func (m *TickMonitor) Record(took time.Duration) {
+	if m.closed {
+		return
+	}
+	if m.metric == nil {
+		m.metric = new(expvar.Int)
+		tickDurations.Set(m.gameID, m.metric)
+		m.average = took
+	}
+	m.average = (m.average*9 + took) / 10
+	m.metric.Set(m.average.Microseconds())
+
+	if took > m.budget {
+		m.slowStreak++
+		m.fastStreak = 0
+	} else if m.sending {
+		// Ticks that skip the state are always fast, they say nothing
+		// about whether the game could send every state again
+		m.fastStreak++
+		m.slowStreak = 0
+	}
+
+	if !m.degraded && m.slowStreak >= SLOW_TICKS_TO_DEGRADE {
+		m.degraded = true
+		log.Printf("[Game %s] Ticks take %s on average, more than the tick interval of %s. Only sending every other state.", m.gameID, m.average, m.budget)
+	} else if m.degraded && m.fastStreak >= FAST_TICKS_TO_RECOVER {
+		m.degraded = false
+		log.Printf("[Game %s] Ticks are back within the tick interval of %s, sending every state again.", m.gameID, m.budget)
+	}
+}
+
+// Degraded tells if the game only sends every other state
+func (m *TickMonitor) Degraded() bool {
+	return m.degraded
+}
+
+// Close removes the game from the metrics, has to be called when the game stops
+func (m *TickMonitor) Close() {
+	m.closed = true
+	if m.metric != nil {
+		tickDurations.Delete(m.gameID)
+		m.metric = nil
+	}
+}
@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/replay"
+)
+
+// ErrGameNotFound is returned for a game ID that is not running (anymore)
+var ErrGameNotFound = errors.New("game not found")
+
+// StartCapture writes every state the game sends from now on to a file in
+// Config.CaptureDir and returns the path of it. Calling it again for a game
+// that is already captured just returns the same path. The capture ends
+// with StopCapture or when the game finishes.
+func (h *Hub) StartCapture(gameID string) (string, error) {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	activeGame, exists := h.activeGames[gameID]
+	if !exists {
+		return "", ErrGameNotFound
+	}
+	if capture, capturing := h.captures[gameID]; capturing {
+		return capture.Path(), nil
+	}
+
+	dir := h.config.CaptureDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	fileName := fmt.Sprintf("capture-%s-%s.jsonl", gameID, time.Now().Format("20060102-150405"))
+	capture, err := replay.NewCapture(gameID, filepath.Join(dir, fileName))
+	if err != nil {
+		return "", fmt.Errorf("creating the capture file: %w", err)
+	}
+	activeGame.SetDebugSink(capture)
+	h.captures[gameID] = capture
+	log.Printf("[Game %s] Capturing every state to %s", gameID, capture.Path())
+	return capture.Path(), nil
+}
+
+// StopCapture ends the capture of a game, reports false if there was none
+func (h *Hub) StopCapture(gameID string) bool {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+	return h.stopCaptureInternal(gameID)
+}
+
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) stopCaptureInternal(gameID string) bool {
+	capture, capturing := h.captures[gameID]
+	if !capturing {
+		return false
+	}
+	delete(h.captures, gameID)
+	if activeGame, exists := h.activeGames[gameID]; exists {
+		activeGame.SetDebugSink(nil)
+	}
+	if err := capture.Close(); err != nil {
+		log.Printf("[Game %s] Error closing the capture file: %v", gameID, err)
+	}
+	log.Printf("[Game %s] Capture stopped, states are in %s", gameID, capture.Path())
+	return true
+}
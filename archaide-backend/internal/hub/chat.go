@@ -0,0 +1,63 @@
+package hub
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// A client can send at most one chat message per cooldown
+const chatCooldown = 500 * time.Millisecond
+
+// Forwards a chat message of a spectator to everyone watching the same game.
+// The players of the game do not get it, so they are not distracted.
+func (h *Hub) handleSpectatorChat(client *Client, gameID string, msg message.Message) {
+	var payload message.SpectatorChatPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		log.Printf("Error unmarshalling spectator_chat payload from %s: %v", client.Id, err)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Invalid spectator_chat payload"})
+		return
+	}
+	text, errMsg := validateChat(client, payload.Text)
+	if errMsg != "" {
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: errMsg})
+		return
+	}
+
+	chat := message.SpectatorChatPayload{
+		Text:     text,
+		SenderID: client.Id,
+		Sender:   client.GetName(),
+	}
+	h.gameMutex.RLock()
+	recipients := []*Client{}
+	for spectator, watchedGameID := range h.spectators {
+		if watchedGameID == gameID {
+			recipients = append(recipients, spectator)
+		}
+	}
+	h.gameMutex.RUnlock()
+
+	for _, spectator := range recipients {
+		spectator.SendMessage(message.SpectatorChat, chat)
+	}
+}
+
+// Applies the length and rate limit to a chat message, the length limit
+// is the same everywhere, see message.ValidateChat.
+// Returns the cleaned up text or an error message for the client.
+// Must only be called from the Run loop, it updates the rate limit of the client.
+func validateChat(client *Client, text string) (string, string) {
+	text, err := message.ValidateChat(text)
+	if err != nil {
+		return "", "Invalid chat message: " + err.Error()
+	}
+	now := time.Now()
+	if now.Sub(client.lastChat) < chatCooldown {
+		return "", "You are sending chat messages too fast"
+	}
+	client.lastChat = now
+	return text, ""
+}
@@ -3,6 +3,9 @@ package hub
 import (
 	"encoding/json"
 	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Driemtax/Archaide/internal/character"
@@ -18,15 +21,58 @@ const (
 	maxMessageSize = 512
 )
 
+// CompressionConfig decides which messages are sent with permessage-deflate.
+// Compressing costs CPU on every frame, so small control messages are
+// sent as they are.
+type CompressionConfig struct {
+	Enabled        bool
+	MinBytes       int                         // Messages smaller than this are not compressed
+	MinBytesByType map[message.MessageType]int // Overrides MinBytes for single message types
+}
+
+func (c CompressionConfig) shouldCompress(msgType message.MessageType, size int) bool {
+	if !c.Enabled {
+		return false
+	}
+	minBytes, ok := c.MinBytesByType[msgType]
+	if !ok {
+		minBytes = c.MinBytes
+	}
+	return size >= minBytes
+}
+
+// A message that waits in the send buffer of a client
+type OutgoingMessage struct {
+	Data     []byte
+	Compress bool
+}
+
 type Client struct {
 	Hub          *Hub
 	Conn         *websocket.Conn
-	Send         chan []byte
+	Send         chan OutgoingMessage
+	Compression  CompressionConfig // Only used if compression was negotiated for the connection
 	Id           string
 	Score        int
 	SelectedGame string
+	WithBots     bool // The client wants to fill missing players with bots for its selected game
+	Solo         bool // The client wants to practice alone, only possible in Asteroids
 	Character    *character.Character
-	gameID       string // The id of the game the user is inside
+	Spectate     string                    // ID of the game the client wants to watch, set when connecting with ?spectate=GAMEID
+	session      string                    // Token to resume the game after a drop, sent with the welcome
+	rejoinGameID string                    // Game the client goes back to when it registers, see ResumeSession
+	connectedAt  time.Time                 // Set when the hub registers the client, used to pick the next host
+	lastChat     time.Time                 // Only touched by the Run loop of the hub, used for the chat rate limit
+	capabilities atomic.Pointer[[]string]  // From the hello, read by the games
+	game         atomic.Pointer[game.Game] // The game the client plays, set by the hub, its input goes there directly
+
+	droppedMessages atomic.Int32 // Messages dropped in a row because the send buffer was full
+	dropping        atomic.Bool  // Set once the client is being disconnected for being stuck
+	unregisterOnce  sync.Once
+	// Send is written by the hub, the games and the ReadPump. Sending on it
+	// after the hub closed it would panic, so both take sendMu.
+	sendMu     sync.Mutex
+	sendClosed bool
 }
 
 /// --- Implementing the game.Player Interface
@@ -35,9 +81,26 @@ func (c *Client) GetID() string {
 	return c.Id
 }
 
+func (c *Client) GetName() string {
+	return c.Character.Name
+}
+
+func (c *Client) GetAvatarURL() string {
+	return c.Character.ImageUrl
+}
+
 // sendMessage formats and sends a structured message to the client
 // Uses non-blocking send to prevent deadlocks if buffer is full
 func (c *Client) SendMessage(msgType message.MessageType, payload any) error {
+	return c.send(msgType, payload, "")
+}
+
+// Reply sends the response to a request of the client, it carries the ID of the request
+func (c *Client) Reply(request message.Message, msgType message.MessageType, payload any) error {
+	return c.send(msgType, payload, request.ID)
+}
+
+func (c *Client) send(msgType message.MessageType, payload any, requestID string) error {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		log.Printf("Error marshalling payload for client %s: %v", c.Id, err)
@@ -46,6 +109,7 @@ func (c *Client) SendMessage(msgType message.MessageType, payload any) error {
 	message := message.Message{
 		Type:    msgType,
 		Payload: json.RawMessage(payloadBytes),
+		ID:      requestID,
 	}
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
@@ -53,33 +117,65 @@ func (c *Client) SendMessage(msgType message.MessageType, payload any) error {
 		return err
 	}
 
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		// The client is being removed, nobody would read the message anyway
+		return nil
+	}
 	select {
-	case c.Send <- messageBytes:
+	case c.Send <- OutgoingMessage{Data: messageBytes, Compress: c.Compression.shouldCompress(msgType, len(messageBytes))}:
+		c.droppedMessages.Store(0)
 	default:
 		log.Printf("Client %s send buffer full. Dropping message.", c.Id)
+		c.messageDropped()
 	}
 	return nil
 }
 
+// Disconnects the client once too many messages in a row were dropped,
+// a client that never reads would otherwise stay in the lobby forever
+func (c *Client) messageDropped() {
+	dropped := c.droppedMessages.Add(1)
+	if int(dropped) < c.Hub.config.MaxConsecutiveDrops || !c.dropping.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("Client %s dropped %d messages in a row. Disconnecting.", c.Id, dropped)
+	// SendMessage is also called by the hub itself, so this must not block
+	go c.unregister()
+}
+
+// HasCapability reports whether the client asked for an optional feature in its hello
+func (c *Client) HasCapability(capability string) bool {
+	capabilities := c.capabilities.Load()
+	return capabilities != nil && slices.Contains(*capabilities, capability)
+}
+
 /// --- End of implementing the game.Player interface
 
 // Compile Time Check -> Checking that Client
 // implements the game.Player interface correctly
-var _ game.Player = (*Client)(nil)
+var _ game.CapablePlayer = (*Client)(nil)
 
 // ReadPump transfers messages from the WebSocket to the Hub.
 // Runs in a separate goroutine for each connection, ensuring only one
 // read operation occurs per connection at a time.
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.unregister <- c
+		// Closing the connection ends the WritePump as well
 		c.Conn.Close()
+		c.unregister()
 		log.Printf("Client %s disconnected (readPump closed)", c.Id)
 	}()
 	c.Conn.SetReadLimit(maxMessageSize)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
+	parseFailures := 0 // In a row, any valid message resets it
+	kicked := false
+	// Messages received in the current second, for the rate limit
+	var windowStart time.Time
+	windowCount := 0
 	for {
 		_, messageBytes, err := c.Conn.ReadMessage()
 		if err != nil {
@@ -88,18 +184,113 @@ func (c *Client) ReadPump() {
 			}
 			break
 		}
+		if kicked {
+			// Waiting for the WritePump to close the connection
+			continue
+		}
 
 		var msg message.Message
 		if err := json.Unmarshal(messageBytes, &msg); err != nil {
+			parseFailures++
 			log.Printf("error unmarshalling message from client %s: %v", c.Id, err)
+			c.SendMessage(message.Error, message.ErrorMessage{Message: "Invalid message, expected JSON with a type and a payload"})
+			// A client that only sends garbage is broken, it would keep doing that forever
+			if c.Hub.config.MaxParseFailures > 0 && parseFailures >= c.Hub.config.MaxParseFailures {
+				log.Printf("Client %s sent %d invalid messages in a row. Disconnecting.", c.Id, parseFailures)
+				// Unregistering closes Send, so the WritePump still delivers the
+				// errors before it closes the connection, which ends this loop
+				kicked = true
+				c.unregister()
+			}
 			continue
 		}
+		parseFailures = 0
 
-		hubMsg := hubMessage{
-			client:  c,
-			message: msg,
+		if limit := c.Hub.config.MaxMessagesPerSecond; limit > 0 {
+			if now := time.Now(); now.Sub(windowStart) >= time.Second {
+				windowStart = now
+				windowCount = 0
+			}
+			windowCount++
+			if windowCount > limit {
+				// Input is resent all the time anyway, so losing some does not hurt
+				if windowCount == limit+1 {
+					log.Printf("Client %s sends more than %d messages per second, dropping the rest.", c.Id, limit)
+				}
+				continue
+			}
 		}
-		c.Hub.incoming <- hubMsg
+		// Counts what the game and the Run loop process alike, the rate limit
+		// above already dropped the rest
+		c.Hub.stats.messages.Add(1)
+		// Input goes straight to the game instead of queueing up behind
+		// every other message in the Run loop, the games lock on their own
+		if activeGame := c.currentGame(); activeGame != nil && !hubOnlyMessages[msg.Type] {
+			c.handleGameMessage(activeGame, msg)
+			continue
+		}
+		c.deliver(msg)
+	}
+}
+
+// Messages the hub answers even while the client is in a game
+var hubOnlyMessages = map[message.MessageType]bool{
+	message.Hello:         true,
+	message.WhoAmIRequest: true,
+	message.LeaveGame:     true,
+}
+
+// Returns the game the client is playing, nil in the lobby or as a spectator
+func (c *Client) currentGame() game.Game {
+	if activeGame := c.game.Load(); activeGame != nil {
+		return *activeGame
+	}
+	return nil
+}
+
+// A panic in the game only disconnects this client, like in the Run loop
+func (c *Client) handleGameMessage(activeGame game.Game, msg message.Message) {
+	defer c.Hub.recoverEvent("message "+string(msg.Type), c)
+	dispatchToGame(activeGame, c, msg)
+}
+
+// Message types a game registered only go to that game, e.g. a pong_input
+// sent during Asteroids is dropped. A type with a registered handler goes to
+// the handler, the rest is left to the game to handle or ignore.
+func dispatchToGame(activeGame game.Game, player game.Player, msg message.Message) {
+	owner, owned := game.MessageOwner(msg.Type)
+	if owned && owner != activeGame.Name() {
+		log.Printf("Dropping message '%s' of %s sent to a game of %s", msg.Type, owner, activeGame.Name())
+		return
+	}
+	if handler, ok := game.MessageHandlerFor(msg.Type); ok {
+		handler(activeGame, player, msg)
+		return
+	}
+	activeGame.HandleMessage(player, msg)
+}
+
+// Input is resent many times a second, losing some while the hub is busy
+// does not hurt and an error for each would only add load
+var resentMessages = map[message.MessageType]bool{
+	message.PongInput:      true,
+	message.AsteroidsInput: true,
+}
+
+// Hands a message to the Run loop without blocking. If the hub can not keep
+// up the message is dropped, blocking here would also stop the pongs from
+// being read and the client would time out. Everything but input is an
+// action of the player, they get an error so they can try again.
+func (c *Client) deliver(msg message.Message) bool {
+	select {
+	case c.Hub.incoming <- hubMessage{client: c, message: msg}:
+		return true
+	default:
+		log.Printf("Hub is busy, dropping message '%s' from client %s", msg.Type, c.Id)
+		if !resentMessages[msg.Type] {
+			c.Reply(msg, message.Error, message.ErrorMessage{Message: "The server is busy, please try again"})
+		}
+		return false
 	}
 }
 
@@ -110,19 +301,24 @@ func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
+		// Closing the connection ends the ReadPump, which would otherwise
+		// wait for its read deadline with the client still in the hub
 		c.Conn.Close()
+		c.unregister()
 		log.Printf("Client %s writePump closed", c.Id)
 	}()
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case outgoing, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				log.Printf("Client %s send channel closed by hub", c.Id)
 				return
 			}
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			// Does nothing if the client did not negotiate compression
+			c.Conn.EnableWriteCompression(outgoing.Compress)
+			if err := c.Conn.WriteMessage(websocket.TextMessage, outgoing.Data); err != nil {
 				log.Printf("error writing message to client %s: %v", c.Id, err)
 				return
 			}
@@ -135,3 +331,21 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// Tells the hub that the client is gone. Both pumps, the drop detection and
+// the limit for invalid messages end up here, the hub only hears it once.
+func (c *Client) unregister() {
+	c.unregisterOnce.Do(func() { c.Hub.unregister <- c })
+}
+
+// Closes Send, which makes the WritePump close the connection. Safe to
+// call more than once, later messages for the client are dropped.
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return
+	}
+	c.sendClosed = true
+	close(c.Send)
+}
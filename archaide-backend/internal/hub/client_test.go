@@ -0,0 +1,172 @@
+package hub
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/character"
+	"github.com/Driemtax/Archaide/internal/component"
+	"github.com/Driemtax/Archaide/internal/game/asteroids"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+func TestStuckClientIsDisconnected(t *testing.T) {
+	h := NewHub(Config{MaxConsecutiveDrops: 5})
+	go h.Run()
+
+	// Nobody ever reads from an unbuffered channel, so every message is dropped
+	client := &Client{
+		Hub:       h,
+		Send:      make(chan OutgoingMessage),
+		Id:        "stuck",
+		Character: &character.Character{Name: "Stuck"},
+	}
+	h.Register <- client
+
+	for i := 0; i < h.config.MaxConsecutiveDrops; i++ {
+		client.SendMessage(message.UpdateLobby, nil)
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		h.gameMutex.RLock()
+		_, registered := h.clients[client]
+		h.gameMutex.RUnlock()
+		if !registered {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("stuck client was never disconnected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if _, open := <-client.Send; open {
+		t.Error("send channel of the disconnected client is still open")
+	}
+}
+
+// Builds the state message of a busy Asteroids tick: a full lobby,
+// lots of asteroids and everyone shooting
+func busyAsteroidsFrame(b *testing.B) []byte {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	vec := func() component.Vector2D {
+		return component.NewVector2D(rng.Float64()*800, rng.Float64()*600)
+	}
+
+	state := asteroids.AsteroidsStatePayload{
+		Players:     make(map[string]asteroids.PlayerState),
+		Asteroids:   []asteroids.AsteroidState{},
+		Projectiles: []asteroids.ProjectileState{},
+		Powerups:    []asteroids.PowerupState{},
+	}
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("player-%d", i)
+		state.Players[id] = asteroids.PlayerState{ID: id, Pos: vec(), Dir: vec().Normalize(), Vel: vec(), Health: 100, Effects: []asteroids.PowerupType{}}
+	}
+	for i := 0; i < 40; i++ {
+		state.Asteroids = append(state.Asteroids, asteroids.AsteroidState{ID: fmt.Sprintf("asteroid-%d", i), Pos: vec(), Dir: vec().Normalize(), Vel: vec(), Typ: asteroids.LARGE})
+	}
+	for i := 0; i < 60; i++ {
+		state.Projectiles = append(state.Projectiles, asteroids.ProjectileState{ID: fmt.Sprintf("projectile-%d", i), Pos: vec(), Vel: vec()})
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		b.Fatal(err)
+	}
+	frame, err := json.Marshal(message.Message{Type: message.AsteroidsState, Payload: payload})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return frame
+}
+
+// Compresses the frame like gorilla/websocket does with its default level
+// and reports how many bytes actually go over the wire
+func BenchmarkAsteroidsStateDeflate(b *testing.B) {
+	frame := busyAsteroidsFrame(b)
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(frame)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		writer.Reset(&buf)
+		writer.Write(frame)
+		writer.Flush()
+	}
+	b.ReportMetric(float64(len(frame)), "raw-bytes/frame")
+	b.ReportMetric(float64(buf.Len()), "deflate-bytes/frame")
+}
+
+// Four Asteroids players hammer the hub with input as fast as they can.
+// Reports the share of messages the Run loop could not keep up with.
+func BenchmarkIncomingSaturated(b *testing.B) {
+	// Every input ends up as an unhandled lobby message, which gets logged
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	h := NewHub(DefaultConfig())
+	go h.Run()
+	clients := make([]*Client, 4)
+	for i := range clients {
+		clients[i] = newTestClient(h, fmt.Sprintf("c%d", i))
+		h.Register <- clients[i]
+	}
+
+	payload, _ := json.Marshal(asteroids.AsteroidsInputPayload{Up: true, Shoot: true})
+	msg := message.Message{Type: message.AsteroidsInput, Payload: payload}
+	var next, dropped atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		client := clients[next.Add(1)%int64(len(clients))]
+		for pb.Next() {
+			if !client.deliver(msg) {
+				dropped.Add(1)
+			}
+		}
+	})
+	b.ReportMetric(float64(dropped.Load())/float64(b.N), "dropped/op")
+}
+
+func TestBusyHubRejectsLobbyActionsWithAnError(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.IncomingBuffer = 1
+	h := NewHub(cfg) // Not running, nothing empties the buffer
+	client := newTestClient(h, "c1")
+
+	client.deliver(message.Message{Type: message.WhoAmIRequest})
+	if client.deliver(message.Message{Type: message.AsteroidsInput}) {
+		t.Fatal("input got into the full buffer")
+	}
+	if types := drainMessageTypes(t, client); len(types) != 0 {
+		t.Errorf("dropped input was answered with %v", types)
+	}
+
+	if client.deliver(message.Message{Type: message.SelectGame, ID: "vote"}) {
+		t.Fatal("select_game got into the full buffer")
+	}
+	var msg message.Message
+	if err := json.Unmarshal((<-client.Send).Data, &msg); err != nil {
+		t.Fatalf("invalid message in send buffer: %v", err)
+	}
+	if msg.Type != message.Error || msg.ID != "vote" {
+		t.Errorf("got %s with id %q, want an error for the dropped select_game", msg.Type, msg.ID)
+	}
+}
@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/config"
+)
+
+// Config holds the settings of the hub
+type Config struct {
+	// A client whose send buffer stays full for this many messages in a
+	// row is disconnected. At 30 state frames per second the default gives
+	// a stalled client about three seconds once its buffer is full.
+	MaxConsecutiveDrops int
+
+	// A client that sends this many messages in a row that are no valid
+	// JSON is disconnected. It gets an error for each of them before.
+	MaxParseFailures int
+
+	// Messages from all clients wait in this buffer for the Run loop. If it
+	// is full new messages are dropped instead of stalling the ReadPump,
+	// which also has to answer the pings. 0 uses defaultIncomingBuffer.
+	IncomingBuffer int
+
+	// A client that sends more messages than this in a second gets the
+	// rest dropped, so it can not keep the hub busy on its own. The
+	// frontend sends the Asteroids input 60 times a second. 0 means no limit.
+	MaxMessagesPerSecond int
+
+	// Every game runs its own goroutine and ticker. Once this many games
+	// are running, new ones wait in the lobby until one finishes. 0 means no limit.
+	MaxActiveGames int
+
+	// Matchmaking by score: every ScoreTierSize points of the cumulative
+	// Score are one tier and only voters of the same tier who voted for the
+	// same game play together. The scores only last as long as the
+	// connection, there is no store for them yet. 0 puts all voters into one game.
+	ScoreTierSize int
+
+	// Every client gets the full lobby again this often. The updates on
+	// events can be dropped when a send buffer is full, this way a stale
+	// lobby fixes itself. 0 only sends updates on events.
+	LobbySnapshotInterval time.Duration
+
+	// Directory for the state captures of single games, see
+	// Hub.StartCapture. Empty uses the temp directory of the system.
+	CaptureDir string
+
+	// Names of the games players can choose from, e.g. "Pong". Empty
+	// offers every game the hub implements.
+	AvailableGames []string
+
+	// The base settings of every game, the room settings are applied on top
+	Games config.Games
+}
+
+const defaultIncomingBuffer = 256
+
+// DefaultConfig returns the settings the hub runs with if nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		MaxConsecutiveDrops:   100,
+		MaxParseFailures:      10,
+		IncomingBuffer:        defaultIncomingBuffer,
+		MaxMessagesPerSecond:  120,
+		MaxActiveGames:        50,
+		LobbySnapshotInterval: 5 * time.Second,
+		Games:                 config.Defaults(),
+	}
+}
+
+// Validate checks that only implemented games are made available
+// and that the score tiers and the snapshot interval make sense
+func (c Config) Validate() error {
+	if c.LobbySnapshotInterval < 0 {
+		return fmt.Errorf("lobby snapshot interval %s is negative", c.LobbySnapshotInterval)
+	}
+	if c.ScoreTierSize < 0 {
+		return fmt.Errorf("score tier size %d is negative", c.ScoreTierSize)
+	}
+	for _, name := range c.AvailableGames {
+		if _, ok := gameInfoByName(name); !ok {
+			return fmt.Errorf("unknown game %q", name)
+		}
+	}
+	return nil
+}
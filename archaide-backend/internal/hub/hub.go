@@ -2,15 +2,22 @@ package hub
 
 import (
 	"encoding/json"
+	"expvar"
 	"log"
+	"maps"
 	"math/rand"
+	"runtime/debug"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Driemtax/Archaide/internal/game"
 	"github.com/Driemtax/Archaide/internal/game/asteroids"
 	"github.com/Driemtax/Archaide/internal/game/pong"
 	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/Driemtax/Archaide/internal/replay"
+	"github.com/Driemtax/Archaide/internal/schema"
 	"github.com/google/uuid"
 )
 
@@ -19,105 +26,379 @@ type hubMessage struct {
 	message message.Message
 }
 
-type GameDefinition struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-}
-
 type Hub struct {
 	clients               map[*Client]bool
+	clientsByID           map[string]*Client // Key: Client-ID, kept in sync with clients
 	incoming              chan hubMessage
 	Register              chan *Client
 	unregister            chan *Client
 	availableGames        []message.GameInfo
 	currentGameSelections map[*Client]string
 	activeGames           map[string]game.Game
-	clientToGame          map[*Client]string // Key: Client, Value: Game-ID
+	clientToGame          map[*Client]string          // Key: Client, Value: Game-ID. The only place that knows if a client is in a game
+	spectators            map[*Client]string          // Key: Client, Value: Game-ID the client is watching
+	recorders             map[string]*replay.Recorder // Key: Game-ID, only for games that are recorded
+	captures              map[string]*replay.Capture  // Key: Game-ID, only for games someone debugs, see StartCapture
+	sessions              map[string]droppedSession   // Key: session token of a client that dropped out of a game
+	replays               replay.Store
+	host                  *Client // Controls the room settings, reassigned when they leave
+	settings              message.RoomSettingsInfo
 	// Always lock before writing to on of the global states!!!
 	// Bad unspeakable things happened before I added this :cry:
 	gameMutex sync.RWMutex
+	config    Config
+	heartbeat atomic.Int64 // Unix nanos of the last finished Run loop iteration
+	stats     hubStats
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		incoming:   make(chan hubMessage, 256),
-		Register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		availableGames: []message.GameInfo{
-			{Name: "Asteroids", Description: "Avoid asteroids or shoot them!"},
-			{Name: "Pong", Description: "Do not let the ball hit your wall!"},
-		},
+// Only the latest replays are kept in memory
+const maxStoredReplays = 20
+
+// Players needed to start a game without bots
+const minPlayers = 2
+
+// The Run loop beats at least this often, even if nothing happens
+const heartbeatInterval = time.Second
+
+// Number of running games, served with the other expvars on /debug/vars.
+// Expvars are global, so this assumes one hub per process like the server
+// runs it. Tests with several hubs share the gauge, which is fine for them.
+var activeGamesGauge = expvar.NewInt("active_games")
+
+func NewHub(config Config) *Hub {
+	if config.IncomingBuffer <= 0 {
+		config.IncomingBuffer = defaultIncomingBuffer
+	}
+	h := &Hub{
+		config:                config,
+		incoming:              make(chan hubMessage, config.IncomingBuffer),
+		Register:              make(chan *Client),
+		unregister:            make(chan *Client),
+		clients:               make(map[*Client]bool),
+		clientsByID:           make(map[string]*Client),
+		availableGames:        availableGames(config.AvailableGames),
 		currentGameSelections: make(map[*Client]string),
 		activeGames:           make(map[string]game.Game),
 		clientToGame:          make(map[*Client]string),
+		spectators:            make(map[*Client]string),
+		recorders:             make(map[string]*replay.Recorder),
+		captures:              make(map[string]*replay.Capture),
+		sessions:              make(map[string]droppedSession),
+		replays:               replay.NewMemoryStore(maxStoredReplays),
+		stats:                 hubStats{startedAt: time.Now(), gamesPlayed: make(map[string]int64)},
+	}
+	h.settings = defaultRoomSettings(h.availableGames, config.Games.Pong)
+	return h
+}
+
+// Every game the hub can start, startSelectedGame needs a case for each of them
+var implementedGames = []message.GameInfo{
+	{Name: asteroids.GAME_NAME, Description: "Avoid asteroids or shoot them!"},
+	{Name: pong.GAME_NAME, Description: "Do not let the ball hit your wall!"},
+}
+
+func gameInfoByName(name string) (message.GameInfo, bool) {
+	for _, gameInfo := range implementedGames {
+		if gameInfo.Name == name {
+			return gameInfo, true
+		}
+	}
+	return message.GameInfo{}, false
+}
+
+// Returns the implemented games with the given names, all of them if names is empty.
+// Unknown names are skipped, Config.Validate reports them.
+func availableGames(names []string) []message.GameInfo {
+	if len(names) == 0 {
+		return slices.Clone(implementedGames)
+	}
+	games := []message.GameInfo{}
+	for _, name := range names {
+		if gameInfo, ok := gameInfoByName(name); ok {
+			games = append(games, gameInfo)
+		} else {
+			log.Printf("Game %s is not implemented, it will not be available.", name)
+		}
+	}
+	return games
+}
+
+// ProtocolSchema returns the JSON schema of all messages the lobby and the available games use
+func (h *Hub) ProtocolSchema() ([]byte, error) {
+	payloads := maps.Clone(message.Payloads)
+	for _, gameInfo := range h.availableGames {
+		maps.Copy(payloads, game.MessagePayloads(gameInfo.Name))
+	}
+	return schema.Protocol(payloads)
+}
+
+// Replay returns the recording of a finished game
+func (h *Hub) Replay(gameID string) (replay.Replay, bool) {
+	return h.replays.Load(gameID)
+}
+
+// InputSchema returns the JSON schema of the input payload of an available game
+func (h *Hub) InputSchema(gameName string) ([]byte, bool) {
+	for _, gameInfo := range h.availableGames {
+		if gameInfo.Name == gameName {
+			idle, ok := h.newIdleGame(gameName)
+			if !ok {
+				return nil, false
+			}
+			return idle.InputSchema(), true
+		}
+	}
+	return nil, false
+}
+
+// Creates an instance of the game with the default config that is never
+// started, to ask the game about itself, e.g. for its input schema
+func (h *Hub) newIdleGame(gameName string) (game.Game, bool) {
+	switch gameName {
+	case asteroids.GAME_NAME:
+		return asteroids.NewAsteroidsGame(h, "", asteroids.DefaultAsteroidsConfig(), game.RealClock{}), true
+	case pong.GAME_NAME:
+		return pong.NewPongGame(h, "", pong.DefaultPongConfig(), game.RealClock{}), true
+	default:
+		return nil, false
 	}
 }
 
 func (h *Hub) Run() {
 	log.Println("Hub is running...")
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	// Stays nil without an interval, then it never fires
+	var snapshots <-chan time.Time
+	if h.config.LobbySnapshotInterval > 0 {
+		snapshotTicker := time.NewTicker(h.config.LobbySnapshotInterval)
+		defer snapshotTicker.Stop()
+		snapshots = snapshotTicker.C
+	}
+	h.beat()
 	for {
 		select {
 		case client := <-h.Register:
-			h.gameMutex.Lock()
-			h.clients[client] = true
-			h.gameMutex.Unlock()
-			log.Printf("Client %s registered. Total clients: %d", client.Id, len(h.clients))
-
-			welcomePayload := message.WelcomeMessage{
-				ClientID:     client.Id,
-				CurrentGames: h.availableGames,
-			}
-			client.SendMessage(message.Welcome, welcomePayload)
+			h.handleRegister(client)
+		case client := <-h.unregister:
+			h.handleUnregister(client)
+		case hubMsg := <-h.incoming:
+			h.handleIncoming(hubMsg)
+		case <-snapshots:
 			h.broadcastLobbyUpdate()
+		case <-ticker.C:
+		}
+		// If a handler hangs (hello deadlocks) the heartbeat stops and /healthz fails
+		h.beat()
+	}
+}
 
-		case client := <-h.unregister:
+func (h *Hub) beat() {
+	h.heartbeat.Store(time.Now().UnixNano())
+}
+
+// LastHeartbeat returns when the Run loop last finished an iteration, it beats
+// at least every second. The zero time means Run was not started yet.
+func (h *Hub) LastHeartbeat() time.Time {
+	nanos := h.heartbeat.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Has to be deferred by every event handler of the Run loop. A panic while
+// handling one event is logged and the client that caused it gets
+// disconnected, instead of killing the hub for everyone.
+func (h *Hub) recoverEvent(event string, client *Client) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("Recovered from panic while handling %s of client %s: %v\n%s", event, client.Id, r, debug.Stack())
+	// Closing the connection ends the ReadPump, which unregisters the client.
+	// A panic in unregister itself needs no more cleanup, the pumps are gone already.
+	if event != "unregister" && client.Conn != nil {
+		client.Conn.Close()
+	}
+}
+
+func (h *Hub) handleRegister(client *Client) {
+	defer h.recoverEvent("register", client)
+	h.stats.connections.Add(1)
+
+	welcomePayload, spectateErr := h.addClient(client)
+
+	client.SendMessage(message.Welcome, welcomePayload)
+	if spectateErr != "" {
+		client.SendMessage(message.Error, message.ErrorMessage{Message: spectateErr})
+	}
+	// Only after the welcome, the game starts sending right away
+	if client.rejoinGameID != "" {
+		h.rejoinGame(client)
+	}
+	h.broadcastLobbyUpdate()
+}
+
+// Adds the client to the room and builds its welcome message
+func (h *Hub) addClient(client *Client) (message.WelcomeMessage, string) {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	client.connectedAt = time.Now()
+	h.clients[client] = true
+	h.clientsByID[client.Id] = client
+	h.ensureHostInternal()
+	h.ensureSessionInternal(client)
+	spectateErr := h.startSpectatingInternal(client)
+	welcomePayload := message.WelcomeMessage{
+		ClientID:     client.Id,
+		SessionToken: client.session,
+		CurrentGames: h.availableGames,
+		HostID:       h.hostIDInternal(),
+		Settings:     h.settingsSnapshotInternal(),
+
+		MinProtocolVersion: message.MinProtocolVersion,
+		MaxProtocolVersion: message.ProtocolVersion,
+	}
+	log.Printf("Client %s registered. Total clients: %d", client.Id, len(h.clients))
+	return welcomePayload, spectateErr
+}
+
+func (h *Hub) handleUnregister(client *Client) {
+	defer h.recoverEvent("unregister", client)
+
+	h.removeClient(client)
+	h.broadcastLobbyUpdate()
+	// Check and only start the game if all players have selected a game
+	h.checkAndPotentiallyStartGame()
+}
+
+// Removes the client from the room and every game it plays or watches
+func (h *Hub) removeClient(client *Client) {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		// It never made it into the room, e.g. because its registration
+		// panicked. Its WritePump still has to stop.
+		client.closeSend()
+		return
+	}
+	gameID, inGame := h.clientToGame[client]
+	if inGame {
+		if activeGame, gameExists := h.activeGames[gameID]; gameExists {
+			h.keepSessionInternal(client, gameID, activeGame)
+			activeGame.RemovePlayer(client)
+			log.Printf("Removed client %s from game %s", client.GetID(), activeGame.GetID())
+			// TODO check if the game has to be stopped and terminated
+			// We should move all player back to the lobby
+		}
+		h.leaveGameInternal(client)
+	}
+	if gameID, spectating := h.spectators[client]; spectating {
+		if activeGame, gameExists := h.activeGames[gameID]; gameExists {
+			activeGame.RemoveSpectator(client)
+		}
+		delete(h.spectators, client)
+	}
+	delete(h.clients, client)
+	delete(h.clientsByID, client.Id)
+	delete(h.currentGameSelections, client)
+	if h.host == client {
+		h.host = nil
+		h.ensureHostInternal()
+	}
+	client.closeSend()
+	log.Printf("Client %s unregistered. Total clients: %d", client.Id, len(h.clients))
+}
+
+func (h *Hub) handleIncoming(hubMsg hubMessage) {
+	defer h.recoverEvent("message "+string(hubMsg.message.Type), hubMsg.client)
+
+	h.gameMutex.RLock()
+	gameID, inGame := h.clientToGame[hubMsg.client]
+	watchedGameID, spectating := h.spectators[hubMsg.client]
+	currentGame, gameExists := h.activeGames[gameID]
+	h.gameMutex.RUnlock()
+
+	if hubMsg.message.Type == message.Hello {
+		h.handleHello(hubMsg.client, hubMsg.message)
+	} else if hubMsg.message.Type == message.WhoAmIRequest {
+		h.handleWhoAmI(hubMsg.client, hubMsg.message)
+	} else if hubMsg.message.Type == message.LeaveGame {
+		h.handleLeaveGame(hubMsg.client, hubMsg.message)
+	} else if spectating && hubMsg.message.Type == message.SpectatorChat {
+		h.handleSpectatorChat(hubMsg.client, watchedGameID, hubMsg.message)
+	} else if spectating {
+		// Spectators can only watch, their input goes nowhere
+		log.Printf("Ignoring message type '%s' from spectator %s", hubMsg.message.Type, hubMsg.client.Id)
+	} else if inGame {
+		if gameExists {
+			// Redirect the incoming message to the currently running game
+			dispatchToGame(currentGame, hubMsg.client, hubMsg.message)
+		} else {
+			log.Printf("Client %s mapped to game %s, but game does not exist.", hubMsg.client.GetID(), gameID)
 			h.gameMutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				gameID, inGame := h.clientToGame[client]
-				if inGame {
-					if activeGame, gameExists := h.activeGames[gameID]; gameExists {
-						activeGame.RemovePlayer(client)
-						log.Printf("Removed client %s from game %s", client.GetID(), activeGame.GetID())
-						// TODO check if the game has to be stopped and terminated
-						// We should move all player back to the lobby
-					}
-					delete(h.clientToGame, client)
-				}
-				delete(h.clients, client)
-				delete(h.currentGameSelections, client)
-				close(client.Send)
-				log.Printf("Client %s unregistered. Total clients: %d", client.Id, len(h.clients))
-			}
+			h.leaveGameInternal(hubMsg.client)
 			h.gameMutex.Unlock()
-			h.broadcastLobbyUpdate()
-			// Check and only start the game if all players have selected a game
-			h.checkAndPotentiallyStartGame()
+		}
+	} else {
+		h.handleLobbyMessage(hubMsg.client, hubMsg.message)
+	}
+}
 
-		case hubMsg := <-h.incoming:
-			h.gameMutex.RLock()
-			gameID, inGame := h.clientToGame[hubMsg.client]
-			h.gameMutex.RUnlock()
-
-			if inGame {
-				h.gameMutex.RLock()
-				currentGame, gameExists := h.activeGames[gameID]
-				h.gameMutex.RUnlock()
-
-				if gameExists {
-					// Redirect the incoming message to the currently running game
-					currentGame.HandleMessage(hubMsg.client, hubMsg.message)
-				} else {
-					log.Printf("Client %s mapped to game %s, but game does not exist.", hubMsg.client.GetID(), gameID)
-					h.gameMutex.Lock()
-					delete(h.clientToGame, hubMsg.client)
-					h.gameMutex.Unlock()
+// Takes a player or spectator out of its game and back to the lobby,
+// without closing the connection. For the game it is the same as if the
+// player disconnected, e.g. Pong ends once one player is left.
+func (h *Hub) handleLeaveGame(client *Client, msg message.Message) {
+	if !h.leaveCurrentGame(client) {
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "You are not in a game"})
+		return
+	}
+
+	client.SendMessage(message.BackToLobby, nil)
+	h.broadcastLobbyUpdate()
+}
+
+// Does the actual work of handleLeaveGame while holding the gameMutex.
+// The unlock is deferred, the game code called here may panic and
+// recoverEvent must not find the hub still locked.
+// Returns false if the client neither plays nor watches a game.
+func (h *Hub) leaveCurrentGame(client *Client) bool {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	gameID, inGame := h.clientToGame[client]
+	watchedGameID, spectating := h.spectators[client]
+	if !inGame && !spectating {
+		return false
+	}
+
+	if inGame {
+		if activeGame, gameExists := h.activeGames[gameID]; gameExists {
+			// The game does not report players that left with its result
+			if scorer, ok := activeGame.(game.ScoreKeeper); ok {
+				if score, ok := scorer.PlayerScore(client.Id); ok && score != 0 {
+					h.updateScoresInternal(map[string]int{client.Id: score})
 				}
+			}
+			if leaver, ok := activeGame.(game.Leaver); ok {
+				leaver.LeavePlayer(client)
 			} else {
-				h.handleLobbyMessage(hubMsg.client, hubMsg.message)
+				activeGame.RemovePlayer(client)
 			}
 		}
+		h.leaveGameInternal(client)
+		log.Printf("Client %s left game %s", client.Id, gameID)
+	} else {
+		if activeGame, gameExists := h.activeGames[watchedGameID]; gameExists {
+			activeGame.RemoveSpectator(client)
+		}
+		delete(h.spectators, client)
+		log.Printf("Client %s stopped watching game %s", client.Id, watchedGameID)
 	}
+	return true
 }
 
 // Handles all messages from clients that are not inside a game
@@ -127,33 +408,31 @@ func (h *Hub) handleLobbyMessage(client *Client, msg message.Message) {
 		var payload message.SelectGamePayload
 		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
 			log.Printf("Error unmarshalling select_game payload from %s: %v", client.Id, err)
-			client.SendMessage(message.Error, message.ErrorMessage{Message: "Invalid select_game payload"})
+			client.Reply(msg, message.Error, message.ErrorMessage{Message: "Invalid select_game payload"})
 			return
 		}
 
-		isValidGame := false
-		for _, gameInfo := range h.availableGames {
-			if gameInfo.Name == payload.Game {
-				isValidGame = true
-			}
-		}
+		h.gameMutex.RLock()
+		isValidGame := slices.Contains(h.settings.EnabledGames, payload.Game)
+		h.gameMutex.RUnlock()
 		if !isValidGame {
 			log.Printf("Client %s selected invalid game: %s", client.Id, payload.Game)
-			client.SendMessage(message.Error, message.ErrorMessage{Message: "Invalid game selected"})
+			client.Reply(msg, message.Error, message.ErrorMessage{Message: "Invalid game selected"})
 			return
 		}
 
-		h.gameMutex.Lock()
-		h.currentGameSelections[client] = payload.Game
-		client.SelectedGame = payload.Game
-		log.Printf("Client %s selected game: %s", client.Id, payload.Game)
-		h.gameMutex.Unlock()
+		if !h.selectGame(client, payload) {
+			log.Printf("Client %s selected %s while in a game, ignoring it", client.Id, payload.Game)
+			client.Reply(msg, message.Error, message.ErrorMessage{Message: "You are already in a game"})
+			return
+		}
 
 		h.gameMutex.RLock()
 		allSelected := h.checkAllPlayersSelectedGameInternal()
+		hostStarts := h.settings.HostStarts
 		h.gameMutex.RUnlock()
 
-		if allSelected {
+		if allSelected && !hostStarts {
 			log.Printf("All %d players have selected a game. Determining winner...", len(h.clients))
 			h.selectAndStartGame()
 		} else {
@@ -164,7 +443,18 @@ func (h *Hub) handleLobbyMessage(client *Client, msg message.Message) {
 			log.Printf("%d out of %d players have selected a game.", len(h.currentGameSelections), len(h.clients))
 		}
 
+	case message.RoomSettings:
+		h.handleRoomSettings(client, msg)
+
+	case message.StartRound:
+		h.handleStartRound(client, msg)
+
 	default:
+		if owner, owned := game.MessageOwner(msg.Type); owned {
+			// Late input of a game that just ended, nothing to answer
+			log.Printf("Dropping message '%s' of %s from client %s in the lobby", msg.Type, owner, client.Id)
+			return
+		}
 		log.Printf("Received unhandled lobby message type '%s' from client %s", msg.Type, client.Id)
 	}
 }
@@ -179,7 +469,7 @@ func (h *Hub) checkAllPlayersSelectedGameInternal() bool {
 	lobbyClients := 0
 	selectedCount := 0
 	for client := range h.clients {
-		if _, inGame := h.clientToGame[client]; !inGame {
+		if h.inLobbyInternal(client) {
 			lobbyClients++
 			if _, selected := h.currentGameSelections[client]; selected {
 				selectedCount++
@@ -190,14 +480,59 @@ func (h *Hub) checkAllPlayersSelectedGameInternal() bool {
 	return lobbyClients > 0 && selectedCount == lobbyClients
 }
 
+// Stores the vote of a lobby client, reports false if it is in a game.
+func (h *Hub) selectGame(client *Client, payload message.SelectGamePayload) bool {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	// Only lobby messages of lobby clients end up here, but the client may
+	// have joined a game in the meantime. Its vote would pull it into a second one.
+	if !h.inLobbyInternal(client) {
+		return false
+	}
+	h.currentGameSelections[client] = payload.Game
+	client.SelectedGame = payload.Game
+	client.WithBots = payload.WithBots
+	client.Solo = payload.Solo
+	log.Printf("Client %s selected game: %s", client.Id, payload.Game)
+	return true
+}
+
 // Selects a game from the player selections, creates a new instance
 // of the game and starts it
 func (h *Hub) selectAndStartGame() {
+	// The vote flags of the clients are only read under the lock
+	h.gameMutex.RLock()
+	voters := h.lobbyVotersInternal()
+	enough := enoughPlayers(voters)
+	h.gameMutex.RUnlock()
+	if !enough {
+		log.Printf("Only %d lobby players voted, waiting for more players.", len(voters))
+		for _, client := range voters {
+			client.SendMessage(message.Error, message.ErrorMessage{Message: "Waiting for more players"})
+		}
+		h.broadcastLobbyUpdate()
+		return
+	}
+
+	for client, reason := range h.startSelectedGame() {
+		client.SendMessage(message.Error, message.ErrorMessage{Message: reason})
+	}
+	// Only broadcast after startSelectedGame unlocked, since broadcastLobbyUpdate also tries to Lock.
+	// It was a very painful sunday morning :cry:
+	h.broadcastLobbyUpdate()
+}
+
+// Does the actual work of selectAndStartGame while holding the gameMutex.
+// The unlock is deferred, so no early return can leave the hub wedged.
+// Returns the clients whose game could not be started and why.
+func (h *Hub) startSelectedGame() map[*Client]string {
 	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
 
 	if len(h.currentGameSelections) == 0 {
 		log.Println("No selections made, cannot select a game.")
-		return
+		return nil
 	}
 
 	selections := []string{}
@@ -205,20 +540,36 @@ func (h *Hub) selectAndStartGame() {
 	for client, gameName := range h.currentGameSelections {
 		// Important late night note:
 		// Only add players to a game that are not inside a game yet *in anger of my own stupidity*
-		if _, inGame := h.clientToGame[client]; !inGame {
+		if h.inLobbyInternal(client) {
 			selections = append(selections, gameName)
 			participatingClients = append(participatingClients, client)
 		}
 	}
 
+	if len(participatingClients) > 0 && !enoughPlayers(participatingClients) {
+		// Someone left between the check in selectAndStartGame and now
+		log.Printf("Only %d players left to start a game, waiting for more players.", len(participatingClients))
+		return nil
+	}
+
 	if len(participatingClients) == 0 {
 		log.Println("All selecting clients are already in games? Cannot start.")
 		// Reset selections for safety
 		h.currentGameSelections = make(map[*Client]string)
 		for client := range h.clients {
 			client.SelectedGame = ""
+			client.WithBots = false
+			client.Solo = false
 		}
-		return
+		return nil
+	}
+
+	if h.config.ScoreTierSize > 0 {
+		return h.startTieredGamesInternal(participatingClients)
+	}
+
+	if h.serverBusyInternal(len(participatingClients)) {
+		return failedWith(participatingClients, serverBusyReason)
 	}
 
 	// Selects a game and also takes the amount of votes into account
@@ -227,39 +578,120 @@ func (h *Hub) selectAndStartGame() {
 	selectedGameName := selections[randomIndex]
 
 	log.Printf("Selected game: %s for %d players", selectedGameName, len(participatingClients))
+	return h.startGameInternal(selectedGameName, participatingClients)
+}
+
+// Groups the voters by their score tier and the game they voted for and
+// starts a game for every group that has enough players. The others keep
+// their votes and wait until more players of their tier vote for the same game.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) startTieredGamesInternal(voters []*Client) map[*Client]string {
+	type tierVote struct {
+		tier     int
+		gameName string
+	}
+	groups := make(map[tierVote][]*Client)
+	for _, client := range voters {
+		vote := tierVote{scoreTier(client.Score, h.config.ScoreTierSize), h.currentGameSelections[client]}
+		groups[vote] = append(groups[vote], client)
+	}
+
+	failed := make(map[*Client]string)
+	for vote, clients := range groups {
+		switch {
+		case !enoughPlayers(clients):
+			log.Printf("Only %d players of tier %d voted for %s, waiting for more players.", len(clients), vote.tier, vote.gameName)
+			maps.Copy(failed, failedWith(clients, "Waiting for more players of your score tier"))
+		case h.serverBusyInternal(len(clients)):
+			maps.Copy(failed, failedWith(clients, serverBusyReason))
+		default:
+			log.Printf("Starting %s for %d players of tier %d", vote.gameName, len(clients), vote.tier)
+			maps.Copy(failed, h.startGameInternal(vote.gameName, clients))
+		}
+	}
+	return failed
+}
 
+const serverBusyReason = "Server busy, try again shortly"
+
+// Tells if MaxActiveGames is reached, then the players have to wait.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) serverBusyInternal(waiting int) bool {
+	if h.config.MaxActiveGames > 0 && len(h.activeGames) >= h.config.MaxActiveGames {
+		// The votes stay, so the game starts as soon as another one finished
+		log.Printf("Already %d active games, %d players have to wait.", len(h.activeGames), waiting)
+		return true
+	}
+	return false
+}
+
+// Creates the game, adds the clients to it and starts it.
+// Returns the clients whose game could not be started and why.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) startGameInternal(selectedGameName string, participatingClients []*Client) map[*Client]string {
 	/// --- Creating the new game instance ---
 	var newGame game.Game
 	gameID := uuid.New().String()
 
 	switch selectedGameName {
-	case "Asteroids":
-		asteroidsGame := asteroids.NewAsteroidsGame(h, gameID)
+	case asteroids.GAME_NAME:
+		config := h.asteroidsConfigInternal()
+		if wantsSolo(participatingClients) {
+			config.MinPlayers = 1
+		}
+		asteroidsGame := asteroids.NewAsteroidsGame(h, gameID, config, game.RealClock{})
 		newGame = asteroidsGame
 		log.Printf("Instantiated Asteroids game with ID %s", gameID)
 
-	case "Pong":
-		pongGame := pong.NewPongGame(h, gameID)
+		// Fill the missing slots with bots if the players asked for it
+		if wantsBots(participatingClients) {
+			for missing := asteroidsGame.MinPlayers() - len(participatingClients); missing > 0; missing-- {
+				if err := asteroidsGame.AddPlayer(asteroids.NewAsteroidsBot(asteroidsGame)); err != nil {
+					log.Printf("Error adding bot to game %s: %v", gameID, err)
+				}
+			}
+		}
+
+	case pong.GAME_NAME:
+		pongGame := pong.NewPongGame(h, gameID, h.pongConfigInternal(), game.RealClock{})
 		newGame = pongGame
 		log.Printf("Instantiated Pong game with ID %s", gameID)
 
+		// A lone player who asked for it plays against the computer
+		if len(participatingClients) == 1 && wantsBots(participatingClients) {
+			ai := pong.NewPongAIPlayer(pongGame, pong.DefaultPongAIConfig())
+			if err := pongGame.AddPlayer(ai); err != nil {
+				log.Printf("Error adding AI player to game %s: %v", gameID, err)
+			}
+		}
+
 	default:
+		// Should never happen because only enabled games can be selected,
+		// but if it does the players must not wait for a game forever
 		log.Printf("Unknown game selected: %s", selectedGameName)
-		return
+		h.resetSelections(participatingClients)
+		return failedWith(participatingClients, "Could not start the game "+selectedGameName)
+	}
+
+	newGame.SetObserver(h)
+	if h.settings.RecordReplays {
+		recorder := replay.NewRecorder(gameID, selectedGameName, replay.DEFAULT_MAX_BYTES)
+		newGame.SetRecorder(recorder)
+		h.recorders[gameID] = recorder
 	}
 
 	// Register game and clients
 	h.activeGames[gameID] = newGame
+	activeGamesGauge.Set(int64(len(h.activeGames)))
 	for _, client := range participatingClients {
-		h.clientToGame[client] = gameID
 		err := newGame.AddPlayer(client)
 		if err != nil {
 			log.Printf("Error adding player %s to game %s: %v", client.Id, gameID, err)
 			// TODO error handling
 			// Should we stop the game or smth else? Im not sure yet
 			// Currently the player just wont get added to the game
-			delete(h.clientToGame, client)
 		} else {
+			h.joinGameInternal(client, gameID, newGame)
 			// Inform the client that a game will start
 			startPayload := message.GameSelectedMessage{SelectedGame: selectedGameName, GameID: gameID}
 			client.SendMessage(message.GameSelected, startPayload)
@@ -272,36 +704,65 @@ func (h *Hub) selectAndStartGame() {
 	log.Printf("Started game %s (%s) in a new goroutine", gameID, selectedGameName)
 
 	// Lets clear all previous game selections
-	for _, client := range participatingClients {
-		delete(h.currentGameSelections, client)
-		client.SelectedGame = ""
-	}
+	h.resetSelections(participatingClients)
 
 	log.Printf("Cleared all previous game selection!\n")
+	return nil
+}
 
-	// Please unlock mutex here, scince broadcastLobbyUpdate also tries to Lock.
-	// It was a very painful sunday morning :cry:
-	h.gameMutex.Unlock()
-	// Broadcast to all players the new Lobby state
-	h.broadcastLobbyUpdate()
+// The client plays the game from now on, its input goes there.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) joinGameInternal(client *Client, gameID string, activeGame game.Game) {
+	h.clientToGame[client] = gameID
+	client.game.Store(&activeGame)
+}
+
+// The client is back in the lobby, its messages go through the Run loop again.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) leaveGameInternal(client *Client) {
+	delete(h.clientToGame, client)
+	client.game.Store(nil)
 }
 
 // Has to be called from a game after it is finished
 func (h *Hub) GameFinished(gameID string, result game.GameResult) {
-	h.gameMutex.Lock()
-
 	log.Printf("Game %s finished. Processing results.", gameID)
 
-	// Remove the game from the current active games!
-	if _, exists := h.activeGames[gameID]; exists {
-		delete(h.activeGames, gameID)
-	} else {
+	if !h.finishGame(gameID, result) {
 		// If the game has already been finished for some reason...
 		// We just quit the function here :)
 		log.Printf("GameFinished called for non-existent or already finished game %s", gameID)
 		return
 	}
 
+	// Notify all players for the lobby update
+	h.broadcastLobbyUpdate()
+
+	// At this point it will again be checked if a new game can be started...
+	// Using time.AfterFunc for a small delay, gives clients time to process
+	// Im not completly sure that this here is the best way to do it, but it
+	// works fine for now so i will come back to it if it creates some problems
+	time.AfterFunc(500*time.Millisecond, h.checkAndPotentiallyStartGame)
+}
+
+// Does the actual work of GameFinished while holding the gameMutex, the
+// lobby update can only be broadcasted after it unlocked.
+// Returns false if the game was not active (anymore).
+func (h *Hub) finishGame(gameID string, result game.GameResult) bool {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	// Remove the game from the current active games!
+	finishedGame, exists := h.activeGames[gameID]
+	if !exists {
+		return false
+	}
+	// Before the delete, stopping the capture looks the game up to detach it
+	h.stopCaptureInternal(gameID)
+	delete(h.activeGames, gameID)
+	activeGamesGauge.Set(int64(len(h.activeGames)))
+	h.stats.gamesPlayed[finishedGame.Name()]++
+
 	// Remove clients from the client to game mapping
 	clientsToRemove := []*Client{}
 	for client, gid := range h.clientToGame {
@@ -310,62 +771,110 @@ func (h *Hub) GameFinished(gameID string, result game.GameResult) {
 		}
 	}
 	for _, client := range clientsToRemove {
-		delete(h.clientToGame, client)
-		client.gameID = ""                           // the client is back in the lobby
+		h.leaveGameInternal(client)                  // the client is back in the lobby
 		client.SendMessage(message.BackToLobby, nil) // notify the client that hes back in the lobby!
 		log.Printf("Client %s removed from finished game %s, returned to lobby.", client.GetID(), gameID)
 	}
+	// Spectators of the game go back to the lobby as well
+	for client, gid := range h.spectators {
+		if gid == gameID {
+			delete(h.spectators, client)
+			client.SendMessage(message.BackToLobby, nil)
+		}
+	}
+
+	// Keep the recording around so it can be watched again
+	if recorder, recorded := h.recorders[gameID]; recorded {
+		delete(h.recorders, gameID)
+		if err := h.replays.Save(recorder.Replay()); err != nil {
+			log.Printf("Error saving replay of game %s: %v", gameID, err)
+		}
+	}
+
+	h.dropSessionsInternal(gameID)
 
 	// Update all scores if scores have been given
 	if result.Scores != nil && len(result.Scores) > 0 {
 		h.updateScoresInternal(result.Scores)
 	}
 
-	// Again unlock before broadcasting a lobby update!!!
-	// By now im sick of myself haha
-	h.gameMutex.Unlock()
-
-	// Notify all players for the lobby update
-	h.broadcastLobbyUpdate()
-
-	// At this point it will again be checked if a new game can be started...
-	// Using time.AfterFunc for a small delay, gives clients time to process
-	// Im not completly sure that this here is the best way to do it, but it
-	// works fine for now so i will come back to it if it creates some problems
-	time.AfterFunc(500*time.Millisecond, h.checkAndPotentiallyStartGame)
+	return true
 }
 
+// Builds the lobby update and picks its recipients under one RLock, so every
+// client gets the same consistent snapshot and no client field is read
+// after the lock is released.
 func (h *Hub) broadcastLobbyUpdate() {
-	playerInfos := make(map[string]message.PlayerInfo)
 	h.gameMutex.RLock()
+	payload := h.lobbyUpdateInternal()
+	recipients := h.clientListInternal()
+	h.gameMutex.RUnlock()
+
+	sendToAll(recipients, message.UpdateLobby, payload)
+}
+
+// Copies everything the lobby update needs out of the clients.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) lobbyUpdateInternal() message.LobbyUpdateMessage {
+	playerInfos := make(map[string]message.PlayerInfo, len(h.clients))
 	for client := range h.clients {
-		// Check if the client is currently inside a game
-		_, inGame := h.clientToGame[client]
-		playerInfos[client.Id] = message.PlayerInfo{
-			Score:        client.Score,
-			InGame:       inGame,
-			SelectedGame: client.SelectedGame,
-			Name:         client.Character.Name,
-			AvatarUrl:    client.Character.ImageUrl,
-		}
+		playerInfos[client.Id] = h.playerInfoInternal(client)
 	}
-	h.gameMutex.RUnlock()
-	payload := message.LobbyUpdateMessage{Players: playerInfos}
+	return message.LobbyUpdateMessage{
+		Players:  playerInfos,
+		HostID:   h.hostIDInternal(),
+		Settings: h.settingsSnapshotInternal(),
+	}
+}
 
-	h.broadcastMessageInternal(message.UpdateLobby, payload)
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) playerInfoInternal(client *Client) message.PlayerInfo {
+	// Check if the client is currently inside a game
+	gameID, inGame := h.clientToGame[client]
+	watchedGameID, spectating := h.spectators[client]
+	currentGame := ""
+	if activeGame, ok := h.activeGames[gameID]; ok && inGame {
+		currentGame = activeGame.Name()
+	} else if activeGame, ok := h.activeGames[watchedGameID]; ok && spectating {
+		currentGame = activeGame.Name()
+	}
+	return message.PlayerInfo{
+		Score:        client.Score,
+		InGame:       inGame,
+		SelectedGame: client.SelectedGame,
+		Name:         client.Character.Name,
+		AvatarUrl:    client.Character.ImageUrl,
+		Spectating:   spectating,
+		CurrentGame:  currentGame,
+	}
 }
 
 // BroadcastMessage - Sendet an ALLE verbundenen Clients (wird jetzt intern genutzt)
+// The payload has to be a value that is not changed anymore, it is
+// marshalled outside of the lock.
 func (h *Hub) broadcastMessageInternal(msgType message.MessageType, payload any) {
 	h.gameMutex.RLock()
-	log.Printf("Broadcasting message type '%s' to %d clients", msgType, len(h.clients))
+	recipients := h.clientListInternal()
+	h.gameMutex.RUnlock()
+
+	sendToAll(recipients, msgType, payload)
+}
+
+// Returns a copy of the connected clients to send to after unlocking.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) clientListInternal() []*Client {
 	clientList := make([]*Client, 0, len(h.clients))
 	for client := range h.clients {
 		clientList = append(clientList, client)
 	}
-	h.gameMutex.RUnlock()
+	return clientList
+}
 
-	for _, client := range clientList {
+// Sends without holding the gameMutex. Only the Id of the clients is
+// read, it never changes after the client connected.
+func sendToAll(clients []*Client, msgType message.MessageType, payload any) {
+	log.Printf("Broadcasting message type '%s' to %d clients", msgType, len(clients))
+	for _, client := range clients {
 		err := client.SendMessage(msgType, payload)
 		if err != nil {
 			log.Printf("Error broadcasting message type %s to client %s: %v", msgType, client.Id, err)
@@ -377,8 +886,9 @@ func (h *Hub) broadcastMessageInternal(msgType message.MessageType, payload any)
 func (h *Hub) checkAndPotentiallyStartGame() {
 	h.gameMutex.RLock()
 	allSelected := h.checkAllPlayersSelectedGameInternal()
-	// At least two players have to be there
-	canStart := len(h.clients) > 1 && allSelected
+	// Enough players have to be there and the host
+	// does not want to start the game on their own
+	canStart := enoughPlayers(h.lobbyVotersInternal()) && allSelected && !h.settings.HostStarts
 	h.gameMutex.RUnlock()
 
 	if canStart {
@@ -388,7 +898,7 @@ func (h *Hub) checkAndPotentiallyStartGame() {
 		h.gameMutex.RLock()
 		lobbyClientsCount := 0
 		for c := range h.clients {
-			if _, inGame := h.clientToGame[c]; !inGame {
+			if h.inLobbyInternal(c) {
 				lobbyClientsCount++
 			}
 		}
@@ -402,25 +912,74 @@ func (h *Hub) checkAndPotentiallyStartGame() {
 	}
 }
 
+// Returns all clients in the lobby that voted for a game.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) lobbyVotersInternal() []*Client {
+	voters := []*Client{}
+	for client := range h.currentGameSelections {
+		if h.inLobbyInternal(client) {
+			voters = append(voters, client)
+		}
+	}
+	return voters
+}
+
+// A game needs at least minPlayers players, unless everyone
+// asked to fill the missing slots with bots or a lone player wants to practice
+func enoughPlayers(clients []*Client) bool {
+	return len(clients) >= minPlayers || wantsBots(clients) || wantsSolo(clients)
+}
+
+// Only a lone Asteroids player can start the solo sandbox
+func wantsSolo(clients []*Client) bool {
+	return len(clients) == 1 && clients[0].Solo && clients[0].SelectedGame == asteroids.GAME_NAME
+}
+
+// Bots are only added if every participating player asked for them
+func wantsBots(clients []*Client) bool {
+	for _, client := range clients {
+		if !client.WithBots {
+			return false
+		}
+	}
+	return len(clients) > 0
+}
+
+// Every client failed for the same reason
+func failedWith(clients []*Client, reason string) map[*Client]string {
+	failed := make(map[*Client]string, len(clients))
+	for _, client := range clients {
+		failed[client] = reason
+	}
+	return failed
+}
+
+// The tier of a score when every tierSize points are one tier.
+// Negative scores round down, so -1 is not in the same tier as 1.
+func scoreTier(score, tierSize int) int {
+	tier := score / tierSize
+	if score < 0 && score%tierSize != 0 {
+		tier--
+	}
+	return tier
+}
+
 // Helper function to reset all the selections
 func (h *Hub) resetSelections(clients []*Client) {
 	for _, client := range clients {
 		delete(h.currentGameSelections, client)
 		client.SelectedGame = ""
+		client.WithBots = false
+		client.Solo = false
 	}
 }
 
+// Applies the score deltas of a finished game.
+// This method requires the gameMutex to be locked by the caller.
 func (h *Hub) updateScoresInternal(scores map[string]int) {
 	log.Println("Updating scores...")
 	for clientID, delta := range scores {
-		var targetClient *Client = nil
-		for c := range h.clients {
-			if c.GetID() == clientID {
-				targetClient = c
-				break
-			}
-		}
-		if targetClient != nil {
+		if targetClient, ok := h.clientsByID[clientID]; ok {
 			targetClient.Score += delta
 			log.Printf("Score updated for %s: new score %d", targetClient.GetID(), targetClient.Score)
 		} else {
@@ -429,11 +988,5 @@ func (h *Hub) updateScoresInternal(scores map[string]int) {
 	}
 }
 
-// An api that the hub implements which can be passed
-// down to the game
-type GameFinisher interface {
-	GameFinished(gameID string, result game.GameResult)
-}
-
 // Checking if the hub implements the game finished interface correctly
-var _ GameFinisher = (*Hub)(nil)
+var _ game.GameFinisher = (*Hub)(nil)
@@ -0,0 +1,1034 @@
+package hub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/character"
+	"github.com/Driemtax/Archaide/internal/config"
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/game/asteroids"
+	"github.com/Driemtax/Archaide/internal/game/pong"
+	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/Driemtax/Archaide/internal/replay"
+	"github.com/gorilla/websocket"
+)
+
+// A client without a connection, everything sent to it stays in Send
+func newTestClient(h *Hub, id string) *Client {
+	return &Client{
+		Hub:       h,
+		Send:      make(chan OutgoingMessage, 64),
+		Id:        id,
+		Character: &character.Character{Name: id},
+	}
+}
+
+// Stops the games a test started. They finish in the background and
+// remove themselves from activeGames, so they are copied out first.
+func stopActiveGames(h *Hub) {
+	h.gameMutex.RLock()
+	games := slices.Collect(maps.Values(h.activeGames))
+	h.gameMutex.RUnlock()
+	for _, activeGame := range games {
+		activeGame.Stop()
+	}
+}
+
+// Returns the types of all messages that are waiting in the send buffer
+func drainMessageTypes(t *testing.T, client *Client) []message.MessageType {
+	t.Helper()
+	types := []message.MessageType{}
+	for {
+		select {
+		case outgoing, ok := <-client.Send:
+			if !ok {
+				// The hub closes Send when it removes the client
+				return types
+			}
+			var msg message.Message
+			if err := json.Unmarshal(outgoing.Data, &msg); err != nil {
+				t.Fatalf("invalid message in send buffer: %v", err)
+			}
+			types = append(types, msg.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestInputSchemaComesFromTheGame(t *testing.T) {
+	config := DefaultConfig()
+	config.AvailableGames = []string{pong.GAME_NAME}
+	h := NewHub(config)
+
+	schema, ok := h.InputSchema(pong.GAME_NAME)
+	if !ok || !bytes.Equal(schema, pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{}).InputSchema()) {
+		t.Errorf("got schema %s (%v), want the one of pong", schema, ok)
+	}
+	// Asteroids is implemented but not available on this server
+	if _, ok := h.InputSchema(asteroids.GAME_NAME); ok {
+		t.Error("got a schema for a game that is not available")
+	}
+	if _, ok := h.InputSchema("Tetris"); ok {
+		t.Error("got a schema for a game that does not exist")
+	}
+}
+
+func TestUnknownGameDoesNotWedgeHub(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.clients[client] = true
+	h.clientsByID[client.Id] = client
+	h.currentGameSelections[client] = "Tetris"
+	// A lone player may only start a game against bots
+	client.WithBots = true
+
+	done := make(chan struct{})
+	go func() {
+		h.selectAndStartGame()
+		// Would block forever if the mutex leaked
+		h.gameMutex.Lock()
+		h.gameMutex.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hub is still locked after selecting an unknown game")
+	}
+
+	types := drainMessageTypes(t, client)
+	gotError := false
+	for _, msgType := range types {
+		gotError = gotError || msgType == message.Error
+	}
+	if !gotError {
+		t.Errorf("client got %v, want an error message", types)
+	}
+	if _, selected := h.currentGameSelections[client]; selected {
+		t.Error("selection of the unknown game was not reset")
+	}
+}
+
+func TestGameFinishedTwiceIsNoOp(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.clients[client] = true
+	h.clientsByID[client.Id] = client
+	h.activeGames["g1"] = pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.clientToGame[client] = "g1"
+
+	result := game.GameResult{Scores: map[string]int{"c1": 3}}
+	done := make(chan struct{})
+	go func() {
+		h.GameFinished("g1", result)
+		h.GameFinished("g1", result)
+		// Would block forever if the second call leaked the mutex
+		h.gameMutex.Lock()
+		h.gameMutex.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hub is still locked after the second GameFinished")
+	}
+
+	if client.Score != 3 {
+		t.Errorf("score = %d, want 3 (applied once)", client.Score)
+	}
+	backToLobby := 0
+	for _, msgType := range drainMessageTypes(t, client) {
+		if msgType == message.BackToLobby {
+			backToLobby++
+		}
+	}
+	if backToLobby != 1 {
+		t.Errorf("got %d back_to_lobby messages, want 1", backToLobby)
+	}
+}
+
+func TestConfiguredSpeedMultiplierReachesPong(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Games.Pong.SpeedMultiplier = 1.5
+	h := NewHub(cfg)
+
+	if got := h.settings.SpeedMultiplier; got != 1.5 {
+		t.Errorf("room starts with speed multiplier %.2f, want the configured 1.5", got)
+	}
+	h.gameMutex.RLock()
+	got := h.pongConfigInternal().SpeedMultiplier
+	h.gameMutex.RUnlock()
+	if got != 1.5 {
+		t.Errorf("pong game gets speed multiplier %.2f, want 1.5", got)
+	}
+}
+
+// A target score from the game config file has to be one the host could
+// also pick, otherwise the room starts with settings it would reject
+func TestRoomAcceptsEveryTargetScoreTheConfigAllows(t *testing.T) {
+	for _, targetScore := range []int{1, pong.MAX_TARGET_SCORE} {
+		games, err := config.Parse([]byte(fmt.Sprintf(`{"pong": {"targetScore": %d}}`, targetScore)))
+		if err != nil {
+			t.Fatalf("targetScore %d: %v", targetScore, err)
+		}
+		cfg := DefaultConfig()
+		cfg.Games = games
+		h := NewHub(cfg)
+		if err := h.validateRoomSettings(h.settings); err != nil {
+			t.Errorf("targetScore %d: room rejects its own settings: %v", targetScore, err)
+		}
+	}
+
+	if _, err := config.Parse([]byte(fmt.Sprintf(`{"pong": {"targetScore": %d}}`, pong.MAX_TARGET_SCORE+1))); err == nil {
+		t.Errorf("config accepts targetScore %d, the room does not", pong.MAX_TARGET_SCORE+1)
+	}
+}
+
+func TestLonePlayerWaitsForMorePlayers(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.clients[client] = true
+	h.clientsByID[client.Id] = client
+	h.currentGameSelections[client] = pong.GAME_NAME
+
+	h.selectAndStartGame()
+
+	if len(h.activeGames) != 0 {
+		t.Fatalf("started %d games with a single player", len(h.activeGames))
+	}
+	if _, selected := h.currentGameSelections[client]; !selected {
+		t.Error("selection of the waiting player was reset")
+	}
+	for _, msgType := range drainMessageTypes(t, client) {
+		if msgType == message.GameSelected {
+			t.Error("lone player got a game_selected message")
+		}
+	}
+}
+
+func TestGameLimitKeepsPlayersInLobby(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxActiveGames = 1
+	h := NewHub(config)
+	h.activeGames["g1"] = pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	clients := []*Client{newTestClient(h, "c1"), newTestClient(h, "c2")}
+	for _, client := range clients {
+		h.clients[client] = true
+		h.clientsByID[client.Id] = client
+		h.currentGameSelections[client] = pong.GAME_NAME
+	}
+
+	h.selectAndStartGame()
+
+	if len(h.activeGames) != 1 {
+		t.Fatalf("got %d active games, want the second one refused", len(h.activeGames))
+	}
+	for _, client := range clients {
+		if _, selected := h.currentGameSelections[client]; !selected {
+			t.Errorf("vote of %s was reset, want it kept for the next free slot", client.Id)
+		}
+		if !slices.Contains(drainMessageTypes(t, client), message.Error) {
+			t.Errorf("%s was not told that the server is busy", client.Id)
+		}
+	}
+
+	// A finished game frees its slot
+	h.GameFinished("g1", game.GameResult{})
+	h.selectAndStartGame()
+
+	if len(h.activeGames) != 1 {
+		t.Fatalf("got %d active games after a slot was freed, want 1", len(h.activeGames))
+	}
+	stopActiveGames(h)
+}
+
+func TestSpectatorChatOnlyReachesSpectatorsOfTheSameGame(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	sender, watcher, otherGame, player := newTestClient(h, "s1"), newTestClient(h, "s2"), newTestClient(h, "s3"), newTestClient(h, "p1")
+	for _, client := range []*Client{sender, watcher, otherGame, player} {
+		h.clients[client] = true
+		h.clientsByID[client.Id] = client
+	}
+	h.spectators[sender] = "g1"
+	h.spectators[watcher] = "g1"
+	h.spectators[otherGame] = "g2"
+	h.clientToGame[player] = "g1"
+
+	payload, _ := json.Marshal(message.SpectatorChatPayload{Text: "nice shot"})
+	h.handleIncoming(hubMessage{client: sender, message: message.Message{Type: message.SpectatorChat, Payload: payload}})
+
+	for client, want := range map[*Client]bool{sender: true, watcher: true, otherGame: false, player: false} {
+		got := slices.Contains(drainMessageTypes(t, client), message.SpectatorChat)
+		if got != want {
+			t.Errorf("%s got the chat message: %v, want %v", client.Id, got, want)
+		}
+	}
+}
+
+func TestHelloWithUnsupportedVersionDisconnects(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	current := newTestClient(h, "current")
+	outdated := newTestClient(h, "outdated")
+	h.addClient(current)
+	h.addClient(outdated)
+	drainMessageTypes(t, current)
+	drainMessageTypes(t, outdated)
+
+	hello := func(client *Client, version int) {
+		payload, _ := json.Marshal(message.HelloPayload{ProtocolVersion: version})
+		h.handleIncoming(hubMessage{client: client, message: message.Message{Type: message.Hello, Payload: payload}})
+	}
+	hello(current, message.ProtocolVersion)
+	hello(outdated, message.MinProtocolVersion-1)
+
+	if !h.clients[current] {
+		t.Error("client with the current protocol version was removed")
+	}
+	if h.clients[outdated] {
+		t.Error("client with an outdated protocol version is still connected")
+	}
+	if types := drainMessageTypes(t, outdated); !slices.Contains(types, message.Error) {
+		t.Errorf("outdated client got %v, want an error", types)
+	}
+}
+
+func TestErrorResponseCarriesRequestID(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.addClient(client)
+	drainMessageTypes(t, client)
+
+	payload, _ := json.Marshal(message.SelectGamePayload{Game: "Tetris"})
+	h.handleIncoming(hubMessage{client: client, message: message.Message{Type: message.SelectGame, Payload: payload, ID: "req-1"}})
+
+	var msg message.Message
+	if err := json.Unmarshal((<-client.Send).Data, &msg); err != nil {
+		t.Fatalf("invalid message in send buffer: %v", err)
+	}
+	if msg.Type != message.Error || msg.ID != "req-1" {
+		t.Errorf("got %s with id %q, want an error with id %q", msg.Type, msg.ID, "req-1")
+	}
+}
+
+func TestOnlyConfiguredGamesAreAvailable(t *testing.T) {
+	config := DefaultConfig()
+	config.AvailableGames = []string{pong.GAME_NAME}
+	h := NewHub(config)
+
+	welcome, _ := h.addClient(newTestClient(h, "c1"))
+	if len(welcome.CurrentGames) != 1 || welcome.CurrentGames[0].Name != pong.GAME_NAME {
+		t.Errorf("welcome lists %v, want only %s", welcome.CurrentGames, pong.GAME_NAME)
+	}
+	if !slices.Equal(h.settings.EnabledGames, []string{pong.GAME_NAME}) {
+		t.Errorf("enabled games are %v, want only %s", h.settings.EnabledGames, pong.GAME_NAME)
+	}
+
+	config.AvailableGames = []string{"Space Invaders"}
+	if err := config.Validate(); err == nil {
+		t.Error("config with an unimplemented game is valid")
+	}
+}
+
+func TestSendingToARemovedClientIsDropped(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.addClient(client)
+	drainMessageTypes(t, client)
+
+	// The ReadPump answers invalid messages itself, even after a kick
+	h.removeClient(client)
+	if err := client.SendMessage(message.Error, message.ErrorMessage{Message: "late"}); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if types := drainMessageTypes(t, client); len(types) != 0 {
+		t.Errorf("removed client got %v", types)
+	}
+}
+
+// Returns the server side of a real websocket connection
+func newTestConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	serverConn, _ := newTestConnPair(t)
+	return serverConn
+}
+
+// Like newTestConn, but also returns the other end to play the browser
+func newTestConnPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrading connection: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	clientConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing test server: %v", err)
+	}
+	t.Cleanup(func() { clientConn.Close() })
+	return <-conns, clientConn
+}
+
+func TestPumpsUnregisterOnceWhenBothFail(t *testing.T) {
+	// The hub does not run, the unregisters just pile up
+	h := NewHub(DefaultConfig())
+	h.unregister = make(chan *Client, 4)
+
+	client := newTestClient(h, "c1")
+	client.Conn = newTestConn(t)
+	client.SendMessage(message.Error, message.ErrorMessage{Message: "never arrives"})
+	// Every read and write fails from now on
+	client.Conn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { client.ReadPump(); done <- struct{}{} }()
+	go func() { client.WritePump(); done <- struct{}{} }()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("pumps did not stop after the connection failed")
+		}
+	}
+
+	if got := len(h.unregister); got != 1 {
+		t.Errorf("hub got %d unregisters, want 1", got)
+	}
+}
+
+func TestClientsThatHangUpRightAwayAreRemoved(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	go h.Run()
+
+	// Connects like serveWs, but the connection is gone before the pumps start
+	for i := range 5 {
+		client := newTestClient(h, fmt.Sprintf("c%d", i))
+		client.Conn = newTestConn(t)
+		client.Conn.Close()
+		h.Register <- client
+		go client.WritePump()
+		go client.ReadPump()
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		h.gameMutex.RLock()
+		remaining := len(h.clients)
+		h.gameMutex.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("%d clients are still in the hub", remaining)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRemovingAClientTwiceClosesSendOnce(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	// Never registered, its WritePump still has to stop
+	client := newTestClient(h, "c1")
+
+	h.removeClient(client)
+	h.removeClient(client)
+
+	if _, open := <-client.Send; open {
+		t.Error("send channel of the removed client is still open")
+	}
+}
+
+func TestWhoAmIAnswersInLobbyAndInGame(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	client.Score = 7
+	h.addClient(client)
+	drainMessageTypes(t, client)
+
+	whoAmI := func() message.WhoAmIMessage {
+		t.Helper()
+		h.handleIncoming(hubMessage{client: client, message: message.Message{Type: message.WhoAmIRequest, ID: "me"}})
+		var msg message.Message
+		if err := json.Unmarshal((<-client.Send).Data, &msg); err != nil {
+			t.Fatalf("invalid message in send buffer: %v", err)
+		}
+		if msg.Type != message.WhoAmIResponse || msg.ID != "me" {
+			t.Fatalf("got %s with id %q, want %s with id \"me\"", msg.Type, msg.ID, message.WhoAmIResponse)
+		}
+		var payload message.WhoAmIMessage
+		json.Unmarshal(msg.Payload, &payload)
+		return payload
+	}
+
+	lobby := whoAmI()
+	if lobby.ClientID != "c1" || lobby.Score != 7 || lobby.InGame || !lobby.IsHost {
+		t.Errorf("got %+v in the lobby", lobby)
+	}
+
+	// Games get the messages of their players, this one must not
+	g := pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g1"] = g
+	h.clientToGame[client] = "g1"
+	inGame := whoAmI()
+	if !inGame.InGame || inGame.GameID != "g1" || inGame.CurrentGame != pong.GAME_NAME {
+		t.Errorf("got %+v in a game", inGame)
+	}
+}
+
+// A pong game that keeps the points of players who leave, like Asteroids does
+type scoringGame struct {
+	game.Game
+	score int
+}
+
+func (g *scoringGame) PlayerScore(playerID string) (int, bool) {
+	return g.score, true
+}
+
+func TestLeavingAGameKeepsTheConnectionAndTheScore(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	leaver := newTestClient(h, "c1")
+	h.addClient(leaver)
+	g := &scoringGame{Game: pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{}), score: 40}
+	h.activeGames["g1"] = g
+	h.joinGameInternal(leaver, "g1", g)
+	drainMessageTypes(t, leaver)
+
+	h.handleIncoming(hubMessage{client: leaver, message: message.Message{Type: message.LeaveGame}})
+
+	if _, inGame := h.clientToGame[leaver]; inGame || leaver.currentGame() != nil {
+		t.Error("client is still mapped to the game")
+	}
+	if !h.clients[leaver] {
+		t.Fatal("client was disconnected")
+	}
+	if leaver.Score != 40 {
+		t.Errorf("client has score %d, want the 40 it scored before leaving", leaver.Score)
+	}
+	if types := drainMessageTypes(t, leaver); !slices.Contains(types, message.BackToLobby) {
+		t.Errorf("client got %v, want %s", types, message.BackToLobby)
+	}
+
+	// Leaving again is an error, there is nothing to leave
+	h.handleIncoming(hubMessage{client: leaver, message: message.Message{Type: message.LeaveGame}})
+	if types := drainMessageTypes(t, leaver); !slices.Contains(types, message.Error) {
+		t.Errorf("client got %v, want %s", types, message.Error)
+	}
+}
+
+// A pong game that crashes when a player is taken out of it
+type panickingGame struct {
+	game.Game
+}
+
+func (g *panickingGame) RemovePlayer(player game.Player) {
+	panic("remove player failed")
+}
+
+func TestPanicWhileLeavingDoesNotWedgeHub(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	leaver := newTestClient(h, "c1")
+	h.addClient(leaver)
+	g := &panickingGame{Game: pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})}
+	h.activeGames["g1"] = g
+	h.joinGameInternal(leaver, "g1", g)
+
+	done := make(chan struct{})
+	go func() {
+		h.handleIncoming(hubMessage{client: leaver, message: message.Message{Type: message.LeaveGame}})
+		// Would block forever if the panic left the mutex locked
+		h.gameMutex.Lock()
+		h.gameMutex.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hub is still locked after a panic in the game")
+	}
+}
+
+func TestGameMessagesInTheLobbyAreDropped(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.addClient(client)
+	drainMessageTypes(t, client)
+
+	h.handleIncoming(hubMessage{client: client, message: message.Message{Type: message.PongInput}})
+	if types := drainMessageTypes(t, client); len(types) != 0 {
+		t.Errorf("client got %v for late game input, want nothing", types)
+	}
+
+	// A game can not take over the types of the lobby or another game
+	if err := game.RegisterMessages("Tetris", map[message.MessageType]any{message.Welcome: nil}); err == nil {
+		t.Error("registering a lobby message type succeeded")
+	}
+	if err := game.RegisterMessages("Tetris", map[message.MessageType]any{message.PongInput: nil}); err == nil {
+		t.Error("registering a pong message type succeeded")
+	}
+}
+
+// A game from outside the repo, it only brings its own name
+type tetrisGame struct {
+	game.Game
+}
+
+func (g *tetrisGame) Name() string {
+	return "Tetris"
+}
+
+func TestRegisteredHandlerGetsTheMessagesOfItsGame(t *testing.T) {
+	const tetrisDrop message.MessageType = "tetris_drop"
+	game.MustRegisterMessages("Tetris", map[message.MessageType]any{tetrisDrop: nil})
+	handledBy := []game.Game{}
+	game.MustRegisterHandler("Tetris", tetrisDrop, func(activeGame game.Game, player game.Player, msg message.Message) {
+		handledBy = append(handledBy, activeGame)
+	})
+
+	h := NewHub(DefaultConfig())
+	player := newTestClient(h, "c1")
+	h.addClient(player)
+	tetris := &tetrisGame{Game: pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})}
+	h.activeGames["g1"] = tetris
+	h.joinGameInternal(player, "g1", tetris)
+
+	h.handleIncoming(hubMessage{client: player, message: message.Message{Type: tetrisDrop}})
+	if len(handledBy) != 1 || handledBy[0] != tetris {
+		t.Fatalf("handler got the message for %v, want it once for the tetris game", handledBy)
+	}
+
+	// A pong game does not get a tetris message, not even through the handler
+	pongGame := pong.NewPongGame(h, "g2", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g2"] = pongGame
+	h.joinGameInternal(player, "g2", pongGame)
+	h.handleIncoming(hubMessage{client: player, message: message.Message{Type: tetrisDrop}})
+	if len(handledBy) != 1 {
+		t.Errorf("handler was called %d times, want the tetris message dropped in pong", len(handledBy))
+	}
+
+	// Only the owner of a type can handle it
+	if err := game.RegisterHandler("Tetris", message.PongInput, nil); err == nil {
+		t.Error("registering a handler for a pong message type succeeded")
+	}
+	if err := game.RegisterHandler("Tetris", "tetris_rotate", nil); err == nil {
+		t.Error("registering a handler for an unregistered message type succeeded")
+	}
+}
+
+func TestSelectGameWhileInAGameIsRejected(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	player := newTestClient(h, "c1")
+	h.addClient(player)
+	g := pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g1"] = g
+	h.joinGameInternal(player, "g1", g)
+	drainMessageTypes(t, player)
+
+	payload, _ := json.Marshal(message.SelectGamePayload{Game: pong.GAME_NAME})
+	h.handleLobbyMessage(player, message.Message{Type: message.SelectGame, Payload: payload})
+
+	if _, selected := h.currentGameSelections[player]; selected || player.SelectedGame != "" {
+		t.Error("selection of a client in a game was recorded")
+	}
+	if types := drainMessageTypes(t, player); !slices.Contains(types, message.Error) {
+		t.Errorf("client got %v, want %s", types, message.Error)
+	}
+}
+
+func TestStartingAGameSkipsClientsAlreadyInOne(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	busy := newTestClient(h, "busy")
+	h.addClient(busy)
+	running := pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g1"] = running
+	h.joinGameInternal(busy, "g1", running)
+	// A stale vote from before it joined
+	h.currentGameSelections[busy] = pong.GAME_NAME
+	voters := []*Client{newTestClient(h, "c1"), newTestClient(h, "c2")}
+	for _, client := range voters {
+		h.addClient(client)
+		h.currentGameSelections[client] = pong.GAME_NAME
+	}
+
+	h.selectAndStartGame()
+
+	if h.clientToGame[busy] != "g1" {
+		t.Errorf("busy client moved to game %q, want it to stay in g1", h.clientToGame[busy])
+	}
+	for _, client := range voters {
+		gameID, inGame := h.clientToGame[client]
+		if !inGame || gameID == "g1" {
+			t.Errorf("%s is in game %q, want a new game", client.Id, gameID)
+		}
+	}
+	stopActiveGames(h)
+}
+
+func TestScoreTiersFormSeparateGames(t *testing.T) {
+	config := DefaultConfig()
+	config.ScoreTierSize = 10
+	h := NewHub(config)
+	scores := map[string]int{"c1": 0, "c2": 9, "c3": 12, "c4": 19, "c5": 25}
+	clients := map[string]*Client{}
+	for id, score := range scores {
+		client := newTestClient(h, id)
+		client.Score = score
+		h.addClient(client)
+		h.currentGameSelections[client] = pong.GAME_NAME
+		clients[id] = client
+	}
+
+	h.selectAndStartGame()
+	defer stopActiveGames(h)
+
+	if len(h.activeGames) != 2 {
+		t.Fatalf("got %d active games, want one per tier with two players", len(h.activeGames))
+	}
+	if h.clientToGame[clients["c1"]] != h.clientToGame[clients["c2"]] || h.clientToGame[clients["c3"]] != h.clientToGame[clients["c4"]] {
+		t.Error("players of the same tier are in different games")
+	}
+	if h.clientToGame[clients["c1"]] == h.clientToGame[clients["c3"]] {
+		t.Error("players of different tiers play together")
+	}
+	// c5 is alone in its tier and waits with its vote
+	if _, selected := h.currentGameSelections[clients["c5"]]; !selected {
+		t.Error("vote of the lone player in its tier was reset")
+	}
+	if !slices.Contains(drainMessageTypes(t, clients["c5"]), message.Error) {
+		t.Error("lone player in its tier was not told to wait")
+	}
+
+	if tier := scoreTier(-1, 10); tier != -1 {
+		t.Errorf("scoreTier(-1, 10) = %d, want -1", tier)
+	}
+}
+
+func TestLobbySnapshotIsSentPeriodically(t *testing.T) {
+	config := DefaultConfig()
+	config.LobbySnapshotInterval = 10 * time.Millisecond
+	h := NewHub(config)
+	go h.Run()
+	client := newTestClient(h, "c1")
+	h.Register <- client
+
+	// Nothing happens in the lobby, still the snapshots keep coming
+	updates := 0
+	deadline := time.After(time.Second)
+	for updates < 3 {
+		select {
+		case outgoing := <-client.Send:
+			var msg message.Message
+			if err := json.Unmarshal(outgoing.Data, &msg); err != nil {
+				t.Fatalf("invalid message in send buffer: %v", err)
+			}
+			if msg.Type == message.UpdateLobby {
+				updates++
+			}
+		case <-deadline:
+			t.Fatalf("got %d lobby updates within a second, want at least 3", updates)
+		}
+	}
+}
+
+func TestGameIsCleanedUpWhenEveryoneLeavesRightAway(t *testing.T) {
+	// Sometimes the players are gone before the game loop got going and
+	// sometimes after, either way the game has to finish
+	for _, gameName := range []string{pong.GAME_NAME, asteroids.GAME_NAME} {
+		for range 20 {
+			h := NewHub(DefaultConfig())
+			clients := []*Client{newTestClient(h, "c1"), newTestClient(h, "c2")}
+			for _, client := range clients {
+				h.addClient(client)
+				h.currentGameSelections[client] = gameName
+			}
+
+			h.selectAndStartGame()
+			for _, client := range clients {
+				h.removeClient(client)
+			}
+
+			deadline := time.After(time.Second)
+			for {
+				h.gameMutex.RLock()
+				active := len(h.activeGames)
+				h.gameMutex.RUnlock()
+				if active == 0 {
+					break
+				}
+				select {
+				case <-deadline:
+					t.Fatalf("%s game is still active after everyone left", gameName)
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}
+	}
+}
+
+func TestOverlongChatMessageIsRejected(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	sender, watcher := newTestClient(h, "s1"), newTestClient(h, "s2")
+	for _, client := range []*Client{sender, watcher} {
+		h.addClient(client)
+		h.spectators[client] = "g1"
+		drainMessageTypes(t, client)
+	}
+
+	payload, _ := json.Marshal(message.SpectatorChatPayload{Text: strings.Repeat("a", message.MaxChatLength+1)})
+	h.handleIncoming(hubMessage{client: sender, message: message.Message{Type: message.SpectatorChat, Payload: payload}})
+
+	var msg message.Message
+	if err := json.Unmarshal((<-sender.Send).Data, &msg); err != nil {
+		t.Fatalf("invalid message in send buffer: %v", err)
+	}
+	var errPayload message.ErrorMessage
+	json.Unmarshal(msg.Payload, &errPayload)
+	if msg.Type != message.Error || !strings.Contains(errPayload.Message, fmt.Sprintf("at most %d", message.MaxChatLength)) {
+		t.Errorf("got %s %q, want an error naming the limit", msg.Type, errPayload.Message)
+	}
+	if slices.Contains(drainMessageTypes(t, watcher), message.SpectatorChat) {
+		t.Error("the overlong message was forwarded")
+	}
+}
+
+func TestCaptureWritesTheStatesOfOneGame(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CaptureDir = t.TempDir()
+	h := NewHub(cfg)
+	if _, err := h.StartCapture("missing"); !errors.Is(err, ErrGameNotFound) {
+		t.Fatalf("capturing a missing game returned %v, want ErrGameNotFound", err)
+	}
+
+	clients := []*Client{newTestClient(h, "c1"), newTestClient(h, "c2")}
+	for _, client := range clients {
+		h.addClient(client)
+		h.currentGameSelections[client] = pong.GAME_NAME
+	}
+	h.selectAndStartGame()
+	defer stopActiveGames(h)
+	h.gameMutex.RLock()
+	gameID := h.clientToGame[clients[0]]
+	h.gameMutex.RUnlock()
+
+	path, err := h.StartCapture(gameID)
+	if err != nil {
+		t.Fatalf("StartCapture: %v", err)
+	}
+	if again, _ := h.StartCapture(gameID); again != path {
+		t.Errorf("second StartCapture returned %q, want the same file %q", again, path)
+	}
+
+	// The game sends a state every tick, wait for a few of them
+	var frames []replay.Frame
+	deadline := time.Now().Add(time.Second)
+	for len(frames) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d frames captured", len(frames))
+		}
+		time.Sleep(10 * time.Millisecond)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading the capture: %v", err)
+		}
+		frames = frames[:0]
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var frame replay.Frame
+			if json.Unmarshal([]byte(line), &frame) == nil {
+				frames = append(frames, frame)
+			}
+		}
+	}
+	if frames[0].Type != message.PongState {
+		t.Errorf("captured a %s frame, want %s", frames[0].Type, message.PongState)
+	}
+
+	if !h.StopCapture(gameID) {
+		t.Fatal("StopCapture reported no capture")
+	}
+	if h.StopCapture(gameID) {
+		t.Error("second StopCapture reported a capture")
+	}
+}
+
+type sinkGame struct {
+	game.Game
+	sink game.Recorder
+}
+
+func (g *sinkGame) SetDebugSink(recorder game.Recorder) {
+	g.sink = recorder
+	g.Game.SetDebugSink(recorder)
+}
+
+func TestFinishedGameStopsWritingItsCapture(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CaptureDir = t.TempDir()
+	h := NewHub(cfg)
+	g := &sinkGame{Game: pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})}
+	h.activeGames["g1"] = g
+
+	if _, err := h.StartCapture("g1"); err != nil {
+		t.Fatalf("StartCapture: %v", err)
+	}
+	if g.sink == nil {
+		t.Fatal("capture did not set a debug sink")
+	}
+
+	h.finishGame("g1", game.GameResult{})
+	if g.sink != nil {
+		t.Error("finished game still writes to the closed capture")
+	}
+	if h.StopCapture("g1") {
+		t.Error("capture of the finished game is still open")
+	}
+}
+
+func TestStatsCountConnectionsMessagesAndGames(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	client := newTestClient(h, "c1")
+	h.handleRegister(client)
+
+	// Input of a player goes straight to the game, it counts all the same
+	serverConn, browser := newTestConnPair(t)
+	client.Conn = serverConn
+	h.unregister = make(chan *Client, 1) // The hub does not run, the ReadPump unregisters at the end
+	g := pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g1"] = g
+	h.joinGameInternal(client, "g1", g)
+	go client.ReadPump()
+	for _, msgType := range []message.MessageType{message.PongInput, message.PongInput, message.WhoAmIRequest} {
+		if err := browser.WriteJSON(message.Message{Type: msgType, Payload: json.RawMessage(`{"direction":"up"}`)}); err != nil {
+			t.Fatalf("writing %s: %v", msgType, err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for h.Stats().TotalMessages < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	h.GameFinished("g1", game.GameResult{})
+	h.GameFinished("g1", game.GameResult{}) // Only counts once
+
+	stats := h.Stats()
+	if stats.TotalConnections != 1 || stats.TotalMessages != 3 || stats.ConnectedClients != 1 {
+		t.Errorf("got %d connections, %d messages and %d clients, want 1, 3 and 1",
+			stats.TotalConnections, stats.TotalMessages, stats.ConnectedClients)
+	}
+	if played := stats.GamesPlayed[pong.GAME_NAME]; played != 1 || len(stats.GamesPlayed) != 1 {
+		t.Errorf("games played = %v, want one %s game", stats.GamesPlayed, pong.GAME_NAME)
+	}
+}
+
+func TestLobbyHearsAboutEliminations(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	watcher := newTestClient(h, "c1")
+	h.addClient(watcher)
+	player := newTestClient(h, "c2")
+	h.addClient(player)
+	pongGame := pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})
+	h.activeGames["g1"] = pongGame
+	h.joinGameInternal(player, "g1", pongGame)
+	drainMessageTypes(t, watcher)
+	drainMessageTypes(t, player)
+
+	h.PlayerEliminated("g1", "c2")
+
+	// The event is sent from another goroutine
+	var event message.GameEventMessage
+	select {
+	case outgoing := <-watcher.Send:
+		var msg message.Message
+		if err := json.Unmarshal(outgoing.Data, &msg); err != nil {
+			t.Fatalf("invalid message: %v", err)
+		}
+		if msg.Type != message.GameEvent {
+			t.Fatalf("lobby client got %s, want %s", msg.Type, message.GameEvent)
+		}
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			t.Fatalf("invalid game event: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lobby client got no game event")
+	}
+	want := message.GameEventMessage{Event: message.GameEventEliminated, GameID: "g1", GameName: pong.GAME_NAME, PlayerID: "c2", PlayerName: "c2"}
+	if event != want {
+		t.Errorf("got event %+v, want %+v", event, want)
+	}
+	if types := drainMessageTypes(t, player); slices.Contains(types, message.GameEvent) {
+		t.Error("the player in the game got the event as well")
+	}
+}
+
+// A pong game that takes dropped players back, like Asteroids does
+type rejoiningGame struct {
+	game.Game
+	rejoined []game.Player
+}
+
+func (g *rejoiningGame) RejoinPlayer(player game.Player) bool {
+	g.rejoined = append(g.rejoined, player)
+	return true
+}
+
+func TestDroppedPlayerResumesItsGameWithTheSessionToken(t *testing.T) {
+	h := NewHub(DefaultConfig())
+	dropped := newTestClient(h, "c1")
+	h.handleRegister(dropped)
+	var msg message.Message
+	var welcome message.WelcomeMessage
+	if err := json.Unmarshal((<-dropped.Send).Data, &msg); err != nil || msg.Type != message.Welcome {
+		t.Fatalf("first message is %s (%v), want %s", msg.Type, err, message.Welcome)
+	}
+	if err := json.Unmarshal(msg.Payload, &welcome); err != nil || welcome.SessionToken == "" {
+		t.Fatal("welcome carries no session token")
+	}
+	g := &rejoiningGame{Game: pong.NewPongGame(h, "g1", pong.DefaultPongConfig(), game.RealClock{})}
+	h.activeGames["g1"] = g
+	h.joinGameInternal(dropped, "g1", g)
+	dropped.Score = 7
+
+	h.removeClient(dropped)
+
+	back := newTestClient(h, "c2")
+	if !h.ResumeSession(back, welcome.SessionToken) {
+		t.Fatal("session token was not accepted")
+	}
+	h.handleRegister(back)
+	if back.Id != "c1" || back.Score != 7 {
+		t.Errorf("resumed as %s with %d points, want c1 with 7", back.Id, back.Score)
+	}
+	if gameID := h.clientToGame[back]; gameID != "g1" || back.currentGame() != game.Game(g) {
+		t.Errorf("resumed client is in game %q, want g1", gameID)
+	}
+	if len(g.rejoined) != 1 || g.rejoined[0] != back {
+		t.Errorf("game got %v back, want the resumed client", g.rejoined)
+	}
+	if h.ResumeSession(newTestClient(h, "c3"), welcome.SessionToken) {
+		t.Error("the session token was accepted twice")
+	}
+
+	// Once the game is over there is nothing to go back to
+	h.removeClient(back)
+	h.GameFinished("g1", game.GameResult{})
+	if h.ResumeSession(newTestClient(h, "c4"), welcome.SessionToken) {
+		t.Error("the session of a finished game was accepted")
+	}
+}
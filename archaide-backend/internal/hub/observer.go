@@ -0,0 +1,54 @@
+package hub
+
+import (
+	"expvar"
+	"log"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// What happens inside the games, served with the other expvars on /debug/vars
+var (
+	gamesStarted      = expvar.NewMap("games_started") // Key: name of the game
+	playersEliminated = expvar.NewInt("players_eliminated")
+)
+
+// The games call these with their own lock held, so they must not take the
+// gameMutex. The hub locks the other way around, e.g. when a player leaves.
+// That is why the lobby hears about the events from another goroutine.
+
+func (h *Hub) GameStarted(gameID, gameName string) {
+	gamesStarted.Add(gameName, 1)
+	log.Printf("Game %s (%s) is running.", gameID, gameName)
+	go h.broadcastGameEvent(message.GameEventMessage{Event: message.GameEventStarted, GameID: gameID, GameName: gameName})
+}
+
+func (h *Hub) PlayerEliminated(gameID, playerID string) {
+	playersEliminated.Add(1)
+	go h.broadcastGameEvent(message.GameEventMessage{Event: message.GameEventEliminated, GameID: gameID, PlayerID: playerID})
+}
+
+// Sends the event to everyone in the lobby, players and spectators of the
+// game see it happen anyway
+func (h *Hub) broadcastGameEvent(event message.GameEventMessage) {
+	h.gameMutex.RLock()
+	if activeGame, exists := h.activeGames[event.GameID]; exists && event.GameName == "" {
+		event.GameName = activeGame.Name()
+	}
+	if client, ok := h.clientsByID[event.PlayerID]; ok {
+		event.PlayerName = client.GetName()
+	}
+	recipients := []*Client{}
+	for client := range h.clients {
+		if h.inLobbyInternal(client) {
+			recipients = append(recipients, client)
+		}
+	}
+	h.gameMutex.RUnlock()
+
+	sendToAll(recipients, message.GameEvent, event)
+}
+
+// Checking if the hub implements the game observer interface correctly
+var _ game.GameObserver = (*Hub)(nil)
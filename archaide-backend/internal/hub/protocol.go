@@ -0,0 +1,57 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// Checks the protocol version a client announced with its hello. A client
+// the server can not talk to gets an error and is disconnected, instead of
+// breaking on some message later.
+// Clients that never say hello are still let in, the current frontend
+// does not send one yet.
+func (h *Hub) handleHello(client *Client, msg message.Message) {
+	var payload message.HelloPayload
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		log.Printf("Error unmarshalling hello payload from %s: %v", client.Id, err)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Invalid hello payload"})
+		return
+	}
+
+	if payload.ProtocolVersion < message.MinProtocolVersion || payload.ProtocolVersion > message.ProtocolVersion {
+		log.Printf("Client %s speaks protocol version %d, disconnecting.", client.Id, payload.ProtocolVersion)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: fmt.Sprintf(
+			"Unsupported protocol version %d, the server supports %d to %d. Please reload the page.",
+			payload.ProtocolVersion, message.MinProtocolVersion, message.ProtocolVersion,
+		)})
+		// Closing Send lets the WritePump deliver the error before it closes
+		// the connection. The ReadPump unregisters again, which is a no-op.
+		h.handleUnregister(client)
+		return
+	}
+	client.capabilities.Store(&payload.Capabilities)
+}
+
+// Answers a client that wants to know where it is, in the lobby or in a
+// game, and what it selected. Works for players and spectators alike.
+func (h *Hub) handleWhoAmI(client *Client, msg message.Message) {
+	h.gameMutex.RLock()
+	gameID, inGame := h.clientToGame[client]
+	if watchedGameID, spectating := h.spectators[client]; spectating && !inGame {
+		gameID = watchedGameID
+	}
+	response := message.WhoAmIMessage{
+		ClientID:   client.Id,
+		PlayerInfo: h.playerInfoInternal(client),
+		GameID:     gameID,
+		WithBots:   client.WithBots,
+		Solo:       client.Solo,
+		IsHost:     h.host == client,
+	}
+	h.gameMutex.RUnlock()
+
+	client.Reply(msg, message.WhoAmIResponse, response)
+}
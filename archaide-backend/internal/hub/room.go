@@ -0,0 +1,190 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game/asteroids"
+	"github.com/Driemtax/Archaide/internal/game/pong"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// Limits for the room settings a host can choose
+const (
+	minTickRateMs      = 16  // ~60 FPS
+	maxTickRateMs      = 100 // 10 FPS
+	minSpeedMultiplier = 0.25
+	maxSpeedMultiplier = 2.0
+)
+
+// The settings a room starts with, every available game is enabled
+func defaultRoomSettings(availableGames []message.GameInfo, pongConfig pong.PongConfig) message.RoomSettingsInfo {
+	enabled := make([]string, 0, len(availableGames))
+	for _, gameInfo := range availableGames {
+		enabled = append(enabled, gameInfo.Name)
+	}
+	return message.RoomSettingsInfo{
+		EnabledGames:    enabled,
+		TargetScore:     pongConfig.TargetScore,
+		TickRateMs:      0,
+		SpeedMultiplier: pongConfig.SpeedMultiplier,
+		BigPaddle:       false,
+		PaddleMomentum:  pongConfig.PaddleMomentum,
+	}
+}
+
+// Makes the longest connected client the host if the room has none.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) ensureHostInternal() {
+	if h.host != nil {
+		return
+	}
+	for client := range h.clients {
+		if h.host == nil || client.connectedAt.Before(h.host.connectedAt) {
+			h.host = client
+		}
+	}
+	if h.host != nil {
+		log.Printf("Client %s is now the host of the room.", h.host.Id)
+	}
+}
+
+// Returns the id of the current host or an empty string if the room is empty.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) hostIDInternal() string {
+	if h.host == nil {
+		return ""
+	}
+	return h.host.Id
+}
+
+// Returns a copy of the room settings that is safe to send.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) settingsSnapshotInternal() message.RoomSettingsInfo {
+	settings := h.settings
+	settings.EnabledGames = slices.Clone(h.settings.EnabledGames)
+	return settings
+}
+
+// Handles a room_settings message, only the host may change the settings
+func (h *Hub) handleRoomSettings(client *Client, msg message.Message) {
+	h.gameMutex.RLock()
+	isHost := h.host == client
+	h.gameMutex.RUnlock()
+
+	if !isHost {
+		log.Printf("Client %s tried to change the room settings but is not the host.", client.Id)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Only the host can change the room settings"})
+		return
+	}
+
+	var settings message.RoomSettingsInfo
+	if err := json.Unmarshal(msg.Payload, &settings); err != nil {
+		log.Printf("Error unmarshalling room_settings payload from %s: %v", client.Id, err)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Invalid room_settings payload"})
+		return
+	}
+	if err := h.validateRoomSettings(settings); err != nil {
+		log.Printf("Client %s sent invalid room settings: %v", client.Id, err)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: err.Error()})
+		return
+	}
+
+	h.applyRoomSettings(settings)
+
+	log.Printf("Host %s changed the room settings: %+v", client.Id, settings)
+	h.broadcastLobbyUpdate()
+}
+
+// Replaces the room settings, votes for games that just got disabled
+// do not count anymore
+func (h *Hub) applyRoomSettings(settings message.RoomSettingsInfo) {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	h.settings = settings
+	disabledSelections := []*Client{}
+	for c, gameName := range h.currentGameSelections {
+		if !slices.Contains(settings.EnabledGames, gameName) {
+			disabledSelections = append(disabledSelections, c)
+		}
+	}
+	h.resetSelections(disabledSelections)
+}
+
+// Handles a start_round message. The host starts a game for everyone
+// in the lobby that already voted, no matter if the others are done voting.
+func (h *Hub) handleStartRound(client *Client, msg message.Message) {
+	h.gameMutex.RLock()
+	isHost := h.host == client
+	votes := 0
+	for c := range h.currentGameSelections {
+		if h.inLobbyInternal(c) {
+			votes++
+		}
+	}
+	h.gameMutex.RUnlock()
+
+	if !isHost {
+		log.Printf("Client %s tried to start a round but is not the host.", client.Id)
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Only the host can start a round"})
+		return
+	}
+	if votes == 0 {
+		client.Reply(msg, message.Error, message.ErrorMessage{Message: "Nobody voted for a game yet"})
+		return
+	}
+
+	log.Printf("Host %s starts a round with %d voted players.", client.Id, votes)
+	h.selectAndStartGame()
+}
+
+func (h *Hub) validateRoomSettings(settings message.RoomSettingsInfo) error {
+	if len(settings.EnabledGames) == 0 {
+		return fmt.Errorf("At least one game has to be enabled")
+	}
+	for _, name := range settings.EnabledGames {
+		if !slices.ContainsFunc(h.availableGames, func(gameInfo message.GameInfo) bool { return gameInfo.Name == name }) {
+			return fmt.Errorf("Unknown game %q", name)
+		}
+	}
+	if settings.TargetScore < 1 || settings.TargetScore > pong.MAX_TARGET_SCORE {
+		return fmt.Errorf("Target score has to be between 1 and %d", pong.MAX_TARGET_SCORE)
+	}
+	if settings.TickRateMs != 0 && (settings.TickRateMs < minTickRateMs || settings.TickRateMs > maxTickRateMs) {
+		return fmt.Errorf("Tick rate has to be between %d and %d ms", minTickRateMs, maxTickRateMs)
+	}
+	if settings.SpeedMultiplier < minSpeedMultiplier || settings.SpeedMultiplier > maxSpeedMultiplier {
+		return fmt.Errorf("Speed multiplier has to be between %.2f and %.2f", minSpeedMultiplier, maxSpeedMultiplier)
+	}
+	return nil
+}
+
+// Builds the config for a new Pong game from the room settings.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) pongConfigInternal() pong.PongConfig {
+	config := h.config.Games.Pong
+	config.TargetScore = h.settings.TargetScore
+	config.SpeedMultiplier = h.settings.SpeedMultiplier
+	config.PaddleMomentum = h.settings.PaddleMomentum
+	if h.settings.BigPaddle {
+		config.PaddleHeight = pong.BIG_PADDLE_HEIGHT
+	}
+	if h.settings.TickRateMs != 0 {
+		config.TickRate = time.Duration(h.settings.TickRateMs) * time.Millisecond
+	}
+	return config
+}
+
+// Builds the config for a new Asteroids game from the room settings.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) asteroidsConfigInternal() asteroids.AsteroidsConfig {
+	config := h.config.Games.Asteroids
+	if h.settings.TickRateMs != 0 {
+		config.TickRate = time.Duration(h.settings.TickRateMs) * time.Millisecond
+	}
+	return config
+}
@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"log"
+
+	"github.com/Driemtax/Archaide/internal/character"
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/google/uuid"
+)
+
+// A client that dropped out of a game that waits for its players, see
+// game.Rejoiner. It gets its game back when it connects with ?session=TOKEN.
+type droppedSession struct {
+	clientID  string
+	gameID    string
+	score     int
+	character *character.Character
+}
+
+// ResumeSession gives a new connection the identity of the client that
+// dropped with the session token. It has to be called before the client
+// registers, registering then puts it back into its game.
+// Returns false for unknown or used up tokens, the client stays a new one.
+func (h *Hub) ResumeSession(client *Client, token string) bool {
+	if token == "" {
+		return false
+	}
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	session, ok := h.sessions[token]
+	if !ok {
+		return false
+	}
+	delete(h.sessions, token)
+	client.Id = session.clientID
+	client.Score = session.score
+	client.Character = session.character
+	client.session = token
+	client.rejoinGameID = session.gameID
+	log.Printf("Client %s resumes its session to go back to game %s", client.Id, session.gameID)
+	return true
+}
+
+// Every client gets a token it can resume its game with after a drop
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) ensureSessionInternal(client *Client) {
+	if client.session == "" {
+		client.session = uuid.NewString()
+	}
+}
+
+// Keeps the session of a client that drops out of a game that waits for it.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) keepSessionInternal(client *Client, gameID string, activeGame game.Game) {
+	if _, waits := activeGame.(game.Rejoiner); !waits || client.session == "" {
+		return
+	}
+	h.sessions[client.session] = droppedSession{
+		clientID:  client.Id,
+		gameID:    gameID,
+		score:     client.Score,
+		character: client.Character,
+	}
+}
+
+// Nobody can go back into a finished game
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) dropSessionsInternal(gameID string) {
+	for token, session := range h.sessions {
+		if session.gameID == gameID {
+			delete(h.sessions, token)
+		}
+	}
+}
+
+// Puts a client that resumed its session back into its game. If the game
+// is over or does not wait for it anymore, it just stays in the lobby.
+func (h *Hub) rejoinGame(client *Client) {
+	h.gameMutex.Lock()
+	defer h.gameMutex.Unlock()
+
+	gameID := client.rejoinGameID
+	client.rejoinGameID = ""
+	activeGame, exists := h.activeGames[gameID]
+	if !exists {
+		log.Printf("Client %s can not go back to game %s, it is over.", client.Id, gameID)
+		return
+	}
+	rejoiner, ok := activeGame.(game.Rejoiner)
+	if !ok || !rejoiner.RejoinPlayer(client) {
+		log.Printf("Client %s can not go back to game %s, it did not wait.", client.Id, gameID)
+		return
+	}
+	h.joinGameInternal(client, gameID, activeGame)
+	log.Printf("Client %s is back in game %s", client.Id, gameID)
+}
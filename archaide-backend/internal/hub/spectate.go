@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"log"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// Adds a freshly registered client as spectator to the game it asked for.
+// Returns an error message for the client if the game can not be watched,
+// the client then just stays in the lobby.
+// This method requires the gameMutex to be locked by the caller.
+func (h *Hub) startSpectatingInternal(client *Client) string {
+	if client.Spectate == "" {
+		return ""
+	}
+	gameID := client.Spectate
+	client.Spectate = ""
+
+	activeGame, exists := h.activeGames[gameID]
+	if !exists {
+		log.Printf("Client %s wants to spectate game %s, but it does not exist.", client.Id, gameID)
+		return "The game you want to watch is not running anymore"
+	}
+	activeGame.AddSpectator(client)
+	h.spectators[client] = gameID
+	log.Printf("Client %s is spectating game %s", client.Id, gameID)
+	return ""
+}
+
+// A client is in the lobby if it neither plays nor watches a game.
+// This method requires the gameMutex to be (read) locked by the caller.
+func (h *Hub) inLobbyInternal(client *Client) bool {
+	if _, inGame := h.clientToGame[client]; inGame {
+		return false
+	}
+	_, spectating := h.spectators[client]
+	return !spectating
+}
+
+// ActiveGames returns a snapshot of all running games
+func (h *Hub) ActiveGames() []message.ActiveGameInfo {
+	h.gameMutex.RLock()
+	defer h.gameMutex.RUnlock()
+
+	infos := make([]message.ActiveGameInfo, 0, len(h.activeGames))
+	for gameID, activeGame := range h.activeGames {
+		players := []string{}
+		for client, gid := range h.clientToGame {
+			if gid == gameID {
+				players = append(players, client.Character.Name)
+			}
+		}
+		infos = append(infos, message.ActiveGameInfo{
+			ID:          gameID,
+			Type:        activeGame.Name(),
+			Players:     players,
+			Spectatable: true, // Every game sends its state to spectators
+		})
+	}
+	return infos
+}
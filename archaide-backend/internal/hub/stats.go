@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"maps"
+	"sync/atomic"
+	"time"
+)
+
+// Totals since the hub started, for the operator dashboard. Unlike the
+// expvars on /debug/vars they belong to a single hub.
+type hubStats struct {
+	startedAt   time.Time
+	connections atomic.Int64
+	messages    atomic.Int64
+	gamesPlayed map[string]int64 // Key: name of the game. Protected by the gameMutex
+}
+
+// Stats is a human readable summary of what the hub did since it started
+type Stats struct {
+	StartedAt        time.Time        `json:"startedAt"`
+	Uptime           string           `json:"uptime"` // e.g. "26h3m12s"
+	UptimeSeconds    int64            `json:"uptimeSeconds"`
+	TotalConnections int64            `json:"totalConnections"` // Every client that registered, including reconnects
+	TotalMessages    int64            `json:"totalMessages"`    // Valid messages of the clients, in the lobby and in games
+	GamesPlayed      map[string]int64 `json:"gamesPlayed"`      // Key: name of the game, only finished games count
+	ConnectedClients int              `json:"connectedClients"`
+	ActiveGames      int              `json:"activeGames"`
+}
+
+// Stats returns the current totals
+func (h *Hub) Stats() Stats {
+	h.gameMutex.RLock()
+	defer h.gameMutex.RUnlock()
+
+	uptime := time.Since(h.stats.startedAt)
+	return Stats{
+		StartedAt:        h.stats.startedAt,
+		Uptime:           uptime.Truncate(time.Second).String(),
+		UptimeSeconds:    int64(uptime.Seconds()),
+		TotalConnections: h.stats.connections.Load(),
+		TotalMessages:    h.stats.messages.Load(),
+		GamesPlayed:      maps.Clone(h.stats.gamesPlayed),
+		ConnectedClients: len(h.clients),
+		ActiveGames:      len(h.activeGames),
+	}
+}
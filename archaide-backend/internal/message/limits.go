@@ -0,0 +1,25 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limit of the chat messages clients send, shared by the lobby and the games
+// so they can not drift apart. It counts characters and not bytes.
+// Names need no limit, clients can not pick them, see the character package.
+const MaxChatLength = 200
+
+// ValidateChat trims a chat message and checks that it is not empty
+// and not longer than MaxChatLength
+func ValidateChat(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("chat message is empty")
+	}
+	if length := utf8.RuneCountInString(text); length > MaxChatLength {
+		return "", fmt.Errorf("chat message is %d characters long, at most %d are allowed", length, MaxChatLength)
+	}
+	return text, nil
+}
@@ -0,0 +1,20 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateChatRejectsOverlongMessages(t *testing.T) {
+	if _, err := ValidateChat(strings.Repeat("ä", MaxChatLength+1)); err == nil {
+		t.Error("a chat message one character over the limit was accepted")
+	}
+	// Multi byte characters count once, the spaces around are trimmed
+	text, err := ValidateChat("  " + strings.Repeat("ä", MaxChatLength) + " ")
+	if err != nil || text != strings.Repeat("ä", MaxChatLength) {
+		t.Errorf("ValidateChat() = %q, %v, want the trimmed message", text, err)
+	}
+	if _, err := ValidateChat("   "); err == nil {
+		t.Error("a blank chat message was accepted")
+	}
+}
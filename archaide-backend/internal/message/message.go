@@ -9,35 +9,105 @@ import (
 type Message struct {
 	Type    MessageType     `json:"type"`    // e.g. "update_lobby", "select_game", "error", "welcome"
 	Payload json.RawMessage `json:"payload"` // The actual data, depending on the type
+	// Optional, set by the client on a request. The server copies it into
+	// its direct response, so the client can tell which request it answers.
+	ID string `json:"id,omitempty"`
 }
 
 type MessageType string
 
+// The version of the wire format, bumped whenever message types or payloads
+// change in a way old clients can not handle. The server still accepts
+// clients down to MinProtocolVersion.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
 const (
 	// Message types for the WebSocket communication
-	Welcome           MessageType = "welcome"             // Sent when a client connects
-	BackToLobby       MessageType = "back_to_lobby"       // Send when a player returns from a game back to the lobby
-	UpdateLobby       MessageType = "update_lobby"        // Sent to update the lobby state
-	SelectGame        MessageType = "select_game"         // Sent when a client selects a game
-	GameSelected      MessageType = "game_selected"       // Sent when a game is selected
-	Error             MessageType = "error"               // Sent when an error occurs
-	PongInput         MessageType = "pong_input"          // From client: Move paddle
-	PongState         MessageType = "pong_state"          // From server: current game state
-	PongGameOver      MessageType = "pong_game_over"      // From server: game over
-	AsteroidsInput    MessageType = "asteroids_input"     // From client: Move player
-	AsteroidsState    MessageType = "asteroids_state"     // From server: current game state
-	AsteroidsGameOver MessageType = "asteroids_game_over" // From server: game over
+	Hello                  MessageType = "hello"                    // From client: its protocol version, sent right after connecting
+	WhoAmIRequest          MessageType = "who_am_i"                 // From client: ask for its own state, works in the lobby and in games
+	WhoAmIResponse         MessageType = "who_am_i_response"        // From server: the answer to who_am_i
+	Welcome                MessageType = "welcome"                  // Sent when a client connects
+	BackToLobby            MessageType = "back_to_lobby"            // Send when a player returns from a game back to the lobby
+	UpdateLobby            MessageType = "update_lobby"             // Sent to update the lobby state
+	SelectGame             MessageType = "select_game"              // Sent when a client selects a game
+	GameSelected           MessageType = "game_selected"            // Sent when a game is selected
+	Error                  MessageType = "error"                    // Sent when an error occurs
+	RoomSettings           MessageType = "room_settings"            // From host: change the match settings of the room
+	StartRound             MessageType = "start_round"              // From host: start a game with everyone who voted
+	SpectatorChat          MessageType = "spectator_chat"           // Between the spectators of a game, players do not get it
+	LeaveGame              MessageType = "leave_game"               // From client: quit the game it plays or watches and go back to the lobby
+	SuddenDeath            MessageType = "sudden_death"             // From server: the time is up and the game is tied, the next point decides
+	GameEvent              MessageType = "game_event"               // From server: something happened in a running game, only sent to the lobby
+	PongInput              MessageType = "pong_input"               // From client: Move paddle
+	PongState              MessageType = "pong_state"               // From server: current game state
+	PongGameOver           MessageType = "pong_game_over"           // From server: game over
+	PongPointScored        MessageType = "pong_point_scored"        // From server: a player scored, sent before the ball is served again
+	PongSetOver            MessageType = "pong_set_over"            // From server: a set of a best-of match is over, the players swap sides
+	PongPauseRequest       MessageType = "pong_pause_request"       // From client: freeze the match, the opponent can resume it
+	PongResumeRequest      MessageType = "pong_resume_request"      // From client: end the pause
+	AsteroidsInput         MessageType = "asteroids_input"          // From client: Move player
+	AsteroidsState         MessageType = "asteroids_state"          // From server: current game state
+	AsteroidsGameOver      MessageType = "asteroids_game_over"      // From server: game over
+	AsteroidsConfig        MessageType = "asteroids_config"         // From server: the world size of the match, sent when it starts
+	AsteroidsScoreUpdate   MessageType = "asteroids_score_update"   // From server: the scores of all players, only sent when one changed
+	AsteroidsPowerupPickup MessageType = "asteroids_powerup_pickup" // From server: a player picked up a powerup
+	AsteroidsEliminated    MessageType = "asteroids_eliminated"     // From server: a player lost their last life and is out
 )
 
+// Payloads maps the message types that are not tied to a game to an example
+// of their payload, nil if they have none. /protocol.json is built from it,
+// so a new message type belongs in here. Games register their own types
+// with game.RegisterMessages.
+var Payloads = map[MessageType]any{
+	Hello:          HelloPayload{},
+	WhoAmIRequest:  nil,
+	WhoAmIResponse: WhoAmIMessage{},
+	Welcome:        WelcomeMessage{},
+	BackToLobby:    nil,
+	UpdateLobby:    LobbyUpdateMessage{},
+	SelectGame:     SelectGamePayload{},
+	GameSelected:   GameSelectedMessage{},
+	Error:          ErrorMessage{},
+	RoomSettings:   RoomSettingsInfo{},
+	StartRound:     nil,
+	LeaveGame:      nil,
+	SpectatorChat:  SpectatorChatPayload{},
+	SuddenDeath:    nil,
+	GameEvent:      GameEventMessage{},
+}
+
 type GameInfo struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 }
 
+// Optional features a client can ask for in its hello. The server
+// ignores the ones it does not know.
+const (
+	// Asteroids: entities close to an edge also carry the positions of
+	// their copies on the other side of the world, see AsteroidState.Ghosts
+	CapabilityWrapGhosts = "wrap_ghosts"
+)
+
+// HelloPayload is sent by the client right after connecting
+type HelloPayload struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+}
+
 // WelcomeMessage contains the ID of the new client and the list of available games
 type WelcomeMessage struct {
-	ClientID     string     `json:"clientId"`
-	CurrentGames []GameInfo `json:"currentGames"`
+	ClientID     string           `json:"clientId"`
+	SessionToken string           `json:"sessionToken"` // Connect with ?session=TOKEN after a drop to go back into the game
+	CurrentGames []GameInfo       `json:"currentGames"`
+	HostID       string           `json:"hostId"` // The client that controls the room settings
+	Settings     RoomSettingsInfo `json:"settings"`
+	// The protocol versions the server supports, from min to max
+	MinProtocolVersion int `json:"minProtocolVersion"`
+	MaxProtocolVersion int `json:"maxProtocolVersion"`
 }
 
 type PlayerInfo struct {
@@ -46,16 +116,54 @@ type PlayerInfo struct {
 	SelectedGame string `json:"selectedGame"`
 	Name         string `json:"name"`
 	AvatarUrl    string `json:"avatarUrl"`
+	Spectating   bool   `json:"spectating"`  // Watching a running game
+	CurrentGame  string `json:"currentGame"` // The game the player is playing or watching, e.g. "Asteroids"
+}
+
+// WhoAmIMessage tells a client what the server knows about it, e.g. to
+// find its way back after a reconnect
+type WhoAmIMessage struct {
+	ClientID string `json:"clientId"`
+	PlayerInfo
+	GameID   string `json:"gameId,omitempty"` // The game the client is playing or watching
+	WithBots bool   `json:"withBots"`
+	Solo     bool   `json:"solo"`
+	IsHost   bool   `json:"isHost"`
 }
 
 // LobbyUpdateMessage contains the current state of the lobby (players and their scores)
 type LobbyUpdateMessage struct {
-	Players map[string]PlayerInfo `json:"players"` // Map of ClientID to Score
+	Players  map[string]PlayerInfo `json:"players"` // Map of ClientID to Score
+	HostID   string                `json:"hostId"`
+	Settings RoomSettingsInfo      `json:"settings"`
+}
+
+// ActiveGameInfo describes a running game instance, served on /games/active
+type ActiveGameInfo struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`    // e.g. "Pong"
+	Players     []string `json:"players"` // Names of the players, bots are not listed
+	Spectatable bool     `json:"spectatable"`
+}
+
+// RoomSettingsInfo holds the match settings of a room. It is sent by the
+// host to change them and included in lobby updates so everyone sees them.
+type RoomSettingsInfo struct {
+	EnabledGames    []string `json:"enabledGames"`    // The games players can vote for
+	TargetScore     int      `json:"targetScore"`     // Pong: score needed to win
+	TickRateMs      int      `json:"tickRateMs"`      // 0 uses the default tick rate of each game
+	SpeedMultiplier float64  `json:"speedMultiplier"` // Pong: scales ball and paddle speed
+	BigPaddle       bool     `json:"bigPaddle"`       // Pong: doubles the paddle height
+	PaddleMomentum  bool     `json:"paddleMomentum"`  // Pong: paddles speed up and coast to a stop instead of moving at full speed right away
+	HostStarts      bool     `json:"hostStarts"`      // Games only start when the host sends start_round
+	RecordReplays   bool     `json:"recordReplays"`   // Record the games so they can be watched again on /replays/{gameId}
 }
 
 // SelectGamePayload is sent by the client when they select a game
 type SelectGamePayload struct {
-	Game string `json:"game"`
+	Game     string `json:"game"`
+	WithBots bool   `json:"withBots"` // Fill missing players with bots (e.g. Pong against the computer)
+	Solo     bool   `json:"solo"`     // Practice alone, only supported by Asteroids
 }
 
 // GameSelectedMessage is sent to all when a game is selected
@@ -64,7 +172,31 @@ type GameSelectedMessage struct {
 	GameID       string `json:"gameId"`
 }
 
+// SpectatorChatPayload is a chat message between spectators. Clients only
+// send the text, the server fills in who wrote it.
+type SpectatorChatPayload struct {
+	Text     string `json:"text"`
+	SenderID string `json:"senderId,omitempty"`
+	Sender   string `json:"sender,omitempty"` // Display name of the sender
+}
+
 // ErrorMessage is sent in case of errors
 type ErrorMessage struct {
 	Message string `json:"message"`
 }
+
+// The events of a running game the lobby hears about
+const (
+	GameEventStarted    = "started"
+	GameEventEliminated = "eliminated"
+)
+
+// GameEventMessage tells the clients in the lobby what happens in the
+// running games, e.g. to show a ticker next to the game list
+type GameEventMessage struct {
+	Event      string `json:"event"` // GameEventStarted or GameEventEliminated
+	GameID     string `json:"gameId"`
+	GameName   string `json:"gameName"`
+	PlayerID   string `json:"playerId,omitempty"`   // Only for GameEventEliminated
+	PlayerName string `json:"playerName,omitempty"` // Empty for bots
+}
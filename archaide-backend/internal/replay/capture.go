@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// Capture writes every frame of a game straight to a file, one JSON
+// encoded Frame per line. It is meant for debugging a single game, so
+// unlike the Recorder it has no size cap and keeps nothing in memory.
+type Capture struct {
+	mu        sync.Mutex
+	gameID    string
+	path      string
+	file      *os.File
+	encoder   *json.Encoder
+	startedAt time.Time
+	closed    bool
+}
+
+// NewCapture creates the file, an existing one is truncated
+func NewCapture(gameID, path string) (*Capture, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Capture{
+		gameID:    gameID,
+		path:      path,
+		file:      file,
+		encoder:   json.NewEncoder(file),
+		startedAt: time.Now(),
+	}, nil
+}
+
+// Path returns the file the frames are written to
+func (c *Capture) Path() string {
+	return c.path
+}
+
+// RecordFrame appends the frame to the file. Frames that arrive after
+// Close are dropped, a tick can still be running while the capture stops.
+func (c *Capture) RecordFrame(msgType message.MessageType, payload any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[Capture %s] Error marshalling frame: %v", c.gameID, err)
+		return
+	}
+	err = c.encoder.Encode(Frame{
+		Offset:  time.Since(c.startedAt),
+		Type:    msgType,
+		Payload: payloadBytes,
+	})
+	if err != nil {
+		log.Printf("[Capture %s] Error writing frame: %v", c.gameID, err)
+	}
+}
+
+// Close stops the capture, calling it again does nothing
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.file.Close()
+}
+
+// Checking if the capture implements the game recorder interface correctly
+var _ game.Recorder = (*Capture)(nil)
@@ -0,0 +1,91 @@
+package replay
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/game"
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+// A recording stops when its frames take up more memory than this,
+// long Asteroids matches would otherwise eat up the server
+const DEFAULT_MAX_BYTES = 16 << 20 // 16 MB
+
+// Frame is a single message a game sent to its players
+type Frame struct {
+	Offset  time.Duration       `json:"offset"` // Time since the recording started
+	Type    message.MessageType `json:"type"`
+	Payload json.RawMessage     `json:"payload"` // Exactly what the clients received
+}
+
+// Replay is everything that was recorded of one game. The frames contain
+// the same messages the clients got, so a client can play them back with
+// its normal message handlers.
+type Replay struct {
+	GameID    string    `json:"gameId"`
+	GameType  string    `json:"gameType"`
+	StartedAt time.Time `json:"startedAt"`
+	Frames    []Frame   `json:"frames"`
+	Truncated bool      `json:"truncated"` // The recording hit its memory cap and misses the end
+}
+
+// Recorder collects the frames of a running game
+type Recorder struct {
+	mu       sync.Mutex
+	replay   Replay
+	size     int
+	maxBytes int
+}
+
+func NewRecorder(gameID, gameType string, maxBytes int) *Recorder {
+	return &Recorder{
+		replay: Replay{
+			GameID:    gameID,
+			GameType:  gameType,
+			StartedAt: time.Now(),
+			Frames:    []Frame{},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// RecordFrame stores a message that was sent to the players
+func (r *Recorder) RecordFrame(msgType message.MessageType, payload any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.replay.Truncated {
+		return
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[Replay %s] Error marshalling frame: %v", r.replay.GameID, err)
+		return
+	}
+	if r.size+len(payloadBytes) > r.maxBytes {
+		log.Printf("[Replay %s] Recording reached %d bytes, dropping the remaining frames.", r.replay.GameID, r.size)
+		r.replay.Truncated = true
+		return
+	}
+	r.size += len(payloadBytes)
+	r.replay.Frames = append(r.replay.Frames, Frame{
+		Offset:  time.Since(r.replay.StartedAt),
+		Type:    msgType,
+		Payload: payloadBytes,
+	})
+}
+
+// Replay returns what has been recorded so far
+func (r *Recorder) Replay() Replay {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	replay := r.replay
+	replay.Frames = append([]Frame(nil), r.replay.Frames...)
+	return replay
+}
+
+// Checking if the recorder implements the game recorder interface correctly
+var _ game.Recorder = (*Recorder)(nil)
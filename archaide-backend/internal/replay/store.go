@@ -0,0 +1,50 @@
+package replay
+
+import "sync"
+
+// Store keeps the replays of finished games
+type Store interface {
+	Save(replay Replay) error
+	Load(gameID string) (Replay, bool)
+}
+
+// MemoryStore keeps the latest replays in memory, the oldest one is
+// thrown away when the store is full
+type MemoryStore struct {
+	mu      sync.RWMutex
+	replays map[string]Replay
+	order   []string // Game IDs, oldest first
+	limit   int
+}
+
+func NewMemoryStore(limit int) *MemoryStore {
+	return &MemoryStore{
+		replays: make(map[string]Replay),
+		limit:   limit,
+	}
+}
+
+func (s *MemoryStore) Save(replay Replay) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.replays[replay.GameID]; !exists {
+		s.order = append(s.order, replay.GameID)
+	}
+	s.replays[replay.GameID] = replay
+
+	for len(s.order) > s.limit {
+		delete(s.replays, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+func (s *MemoryStore) Load(gameID string) (Replay, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	replay, ok := s.replays[gameID]
+	return replay, ok
+}
+
+var _ Store = (*MemoryStore)(nil)
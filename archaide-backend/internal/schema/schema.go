@@ -0,0 +1,144 @@
+// Package schema describes the wire protocol as JSON schema. The schemas are
+// built with reflection from the payload structs, so they can not get out
+// of date like hand written docs.
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/message"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	timeType       = reflect.TypeFor[time.Time]()
+	durationType   = reflect.TypeFor[time.Duration]()
+)
+
+// Protocol returns a JSON schema document that describes every message type
+// and the shape of its payload. A nil payload means the message carries none.
+func Protocol(payloads map[message.MessageType]any) ([]byte, error) {
+	types := make([]string, 0, len(payloads))
+	for msgType := range payloads {
+		types = append(types, string(msgType))
+	}
+	// Sorted, so the document does not change between requests
+	slices.Sort(types)
+
+	defs := make(map[string]any, len(types))
+	messages := make([]any, 0, len(types))
+	for _, msgType := range types {
+		defs[msgType] = Of(payloads[message.MessageType(msgType)])
+		messages = append(messages, map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"type":    map[string]any{"const": msgType},
+				"payload": map[string]any{"$ref": "#/$defs/" + msgType},
+				"id":      map[string]any{"type": "string"},
+			},
+			"required": []string{"type"},
+		})
+	}
+
+	return json.MarshalIndent(map[string]any{
+		"$schema":            draft,
+		"title":              "Archaide protocol",
+		"description":        "Every websocket message is an object with a type and a payload, $defs holds the payload of each type.",
+		"protocolVersion":    message.ProtocolVersion,
+		"minProtocolVersion": message.MinProtocolVersion,
+		"oneOf":              messages,
+		"$defs":              defs,
+	}, "", "  ")
+}
+
+// Of returns the JSON schema of the JSON encoding of v
+func Of(v any) map[string]any {
+	if v == nil {
+		// No payload, clients send null or leave it out
+		return map[string]any{}
+	}
+	return ofType(reflect.TypeOf(v), map[reflect.Type]bool{})
+}
+
+// visiting holds the structs we are inside of, a struct that contains
+// itself would recurse forever otherwise
+func ofType(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	switch t {
+	case rawMessageType:
+		return map[string]any{}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "description": "nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return ofType(t.Elem(), visiting)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json sends bytes as base64
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": ofType(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": ofType(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]any{}
+		addFields(t, properties, visiting)
+		return map[string]any{"type": "object", "properties": properties}
+	default:
+		// Interfaces can hold anything
+		return map[string]any{}
+	}
+}
+
+// Adds the fields of a struct the way encoding/json encodes them,
+// the fields of embedded structs end up next to the others
+func addFields(t reflect.Type, properties map[string]any, visiting map[reflect.Type]bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addFields(fieldType, properties, visiting)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = ofType(fieldType, visiting)
+	}
+}
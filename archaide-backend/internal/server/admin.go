@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Driemtax/Archaide/internal/hub"
+)
+
+// Only lets requests through that send the admin token as bearer token
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// POST starts writing every state of the game to a file and answers with
+// its path, DELETE stops it again
+func serveCapture(hubInstance *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	gameID := r.PathValue("gameId")
+	switch r.Method {
+	case http.MethodPost:
+		path, err := hubInstance.StartCapture(gameID)
+		if errors.Is(err, hub.ErrGameNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Printf("Error starting the capture of game %s: %v", gameID, err)
+			http.Error(w, "Could not start the capture", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]string{"path": path}); err != nil {
+			log.Printf("Error encoding capture path: %v", err)
+		}
+	case http.MethodDelete:
+		if !hubInstance.StopCapture(gameID) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
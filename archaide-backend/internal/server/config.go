@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/hub"
+)
+
+// Config holds the settings of the game server
+type Config struct {
+	Addr string // http service address
+	// Serve HTTPS, and with it wss://, if both are set. Browsers only allow
+	// wss:// from HTTPS pages. Plain HTTP is fine for local development.
+	TLSCertFile string
+	TLSKeyFile  string
+	Compression hub.CompressionConfig
+	Hub         hub.Config
+	// Messages buffered per client before they get dropped. Every tick of
+	// a game sends one state frame, so the buffer decides how long a client
+	// may stall: 512 messages last ~8s at 60 FPS and ~17s at 30 FPS.
+	SendBufferSize int
+	// After SIGINT/SIGTERM /readyz reports 503 this long before the server
+	// stops, so load balancers notice it. Should be longer than their
+	// health check interval.
+	DrainPeriod time.Duration
+	// Serves the /admin endpoints, e.g. to capture every state of a single
+	// game, and the metrics on /debug/vars for requests with
+	// "Authorization: Bearer <AdminToken>". Empty leaves them out.
+	AdminToken string
+}
+
+// Validate checks settings that can not be fixed with a default
+func (c Config) Validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+	if c.DrainPeriod < 0 {
+		return fmt.Errorf("drain period %s is negative", c.DrainPeriod)
+	}
+	if err := c.Hub.Validate(); err != nil {
+		return fmt.Errorf("hub: %w", err)
+	}
+	return nil
+}
+
+// Reports if the server should serve HTTPS
+func (c Config) useTLS() bool {
+	return c.TLSCertFile != ""
+}
+
+// SendBufferSizeFor returns a buffer size that holds all state frames a game
+// with the given tick rate sends during the stall, plus some room for lobby
+// and chat messages
+func SendBufferSizeFor(tickRate, stall time.Duration) int {
+	const lobbyHeadroom = 32
+	return int(stall/tickRate) + lobbyHeadroom
+}
+
+// DefaultConfig returns the settings the server runs with if nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Addr: ":3030",
+		Compression: hub.CompressionConfig{
+			Enabled: true,
+			// Below that deflate barely saves anything and
+			// just burns CPU at 30-60 frames per second
+			MinBytes: 256,
+		},
+		Hub: hub.DefaultConfig(),
+		// The fastest tick rate a room can choose is 16ms (~60 FPS)
+		SendBufferSize: SendBufferSizeFor(16*time.Millisecond, 8*time.Second),
+		DrainPeriod:    5 * time.Second,
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/hub"
+)
+
+// A hub that did not beat for this long is considered wedged.
+// It beats every second, so this leaves room for a slow event.
+const healthTimeout = 5 * time.Second
+
+// 200 as long as the Run loop of the hub is processing, 503 if it is wedged
+func serveHealth(hubInstance *hub.Hub, w http.ResponseWriter) {
+	lastBeat := hubInstance.LastHeartbeat()
+	if lastBeat.IsZero() || time.Since(lastBeat) > healthTimeout {
+		http.Error(w, "hub is not processing", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// 503 until the hub is running and again once the server shuts down
+func serveReady(hubInstance *hub.Hub, draining *atomic.Bool, w http.ResponseWriter) {
+	if draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if hubInstance.LastHeartbeat().IsZero() {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready"))
+}
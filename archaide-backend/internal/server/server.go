@@ -1,25 +1,161 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/Driemtax/Archaide/internal/hub"
 )
 
-func Run(addr *string) {
-	hubInstance := hub.NewHub()
+// Time the open requests get to finish when the server shuts down
+const shutdownTimeout = 10 * time.Second
+
+func Run(cfg Config) {
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid server config: %v", err)
+	}
+
+	draining := new(atomic.Bool)
+	srv := &http.Server{Addr: cfg.Addr, Handler: newHandler(cfg, draining)}
+
+	// On SIGINT/SIGTERM /readyz reports 503 for the drain period first, so
+	// a load balancer stops sending new players before the server goes away
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		draining.Store(true)
+		log.Printf("Draining for %s before shutting down...", cfg.DrainPeriod)
+		time.Sleep(cfg.DrainPeriod)
+		log.Println("Shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	var err error
+	if cfg.useTLS() {
+		log.Printf("Server starting on %s (TLS)", cfg.Addr)
+		err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		log.Printf("Server starting on %s", cfg.Addr)
+		// Start the HTTP server
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("ListenAndServe failed: %v", err)
+	}
+	// ListenAndServe returns as soon as Shutdown starts, the open
+	// requests are still being finished
+	<-shutdownDone
+	log.Println("Server stopped")
+}
+
+// NewHandler starts a new hub and returns the handler serving all endpoints.
+// Run uses it to serve on cfg.Addr, tests can put it behind an httptest.Server.
+func NewHandler(cfg Config) http.Handler {
+	return newHandler(cfg, new(atomic.Bool))
+}
+
+// draining is set once the server shuts down, /readyz reports it
+func newHandler(cfg Config, draining *atomic.Bool) http.Handler {
+	hubInstance := hub.NewHub(cfg.Hub)
+	upgrader := newUpgrader(cfg.Compression)
 
 	go hubInstance.Run()
 
+	mux := http.NewServeMux()
+
 	// Register the WebSocket handler
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		// Pass the single hub instance to the handler
-		serveWs(hubInstance, w, r)
+		serveWs(hubInstance, upgrader, cfg, w, r)
+	})
+
+	// Serves the JSON schema of the input payload a game accepts
+	mux.HandleFunc("/games/{name}/schema", func(w http.ResponseWriter, r *http.Request) {
+		schema, ok := hubInstance.InputSchema(r.PathValue("name"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(schema)
+	})
+
+	// Describes every message type and its payload, for the frontend developers
+	mux.HandleFunc("/protocol.json", func(w http.ResponseWriter, r *http.Request) {
+		protocol, err := hubInstance.ProtocolSchema()
+		if err != nil {
+			log.Printf("Error building the protocol schema: %v", err)
+			http.Error(w, "Could not build the protocol schema", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(protocol)
+	})
+
+	// Lists the running games, so people can pick one to watch
+	mux.HandleFunc("/games/active", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(hubInstance.ActiveGames()); err != nil {
+			log.Printf("Error encoding active games: %v", err)
+		}
+	})
+
+	// Serves the recorded frames of a finished game for playing it back
+	mux.HandleFunc("/replays/{gameId}", func(w http.ResponseWriter, r *http.Request) {
+		recording, ok := hubInstance.Replay(r.PathValue("gameId"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(recording); err != nil {
+			log.Printf("Error encoding replay: %v", err)
+		}
+	})
+
+	// Debugging tools for operators, only served with an admin token
+	if cfg.AdminToken != "" {
+		mux.HandleFunc("/admin/games/{gameId}/capture", requireAdmin(cfg.AdminToken, func(w http.ResponseWriter, r *http.Request) {
+			serveCapture(hubInstance, w, r)
+		}))
+		// Uptime and totals since the start, a readable addition to /debug/vars
+		mux.HandleFunc("/admin/stats", requireAdmin(cfg.AdminToken, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(hubInstance.Stats()); err != nil {
+				log.Printf("Error encoding stats: %v", err)
+			}
+		}))
+		// Metrics like the number of active games, they tell too much
+		// about the server to serve them to everyone
+		mux.HandleFunc("/debug/vars", requireAdmin(cfg.AdminToken, expvar.Handler().ServeHTTP))
+	}
+
+	// Liveness and readiness probes for load balancers and k8s
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serveHealth(hubInstance, w)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		serveReady(hubInstance, draining, w)
 	})
 
 	// Simple handler for the root path
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
@@ -28,10 +164,5 @@ func Run(addr *string) {
 		w.Write([]byte("Game server running. Connect via WebSocket on /ws"))
 	})
 
-	log.Printf("Server starting on %s", *addr)
-	// Start the HTTP server
-	err := http.ListenAndServe(*addr, nil) // Use the default ServeMux
-	if err != nil {
-		log.Fatalf("ListenAndServe failed: %v", err)
-	}
+	return mux
 }
@@ -0,0 +1,322 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Driemtax/Archaide/internal/client"
+	"github.com/Driemtax/Archaide/internal/game/pong"
+	"github.com/Driemtax/Archaide/internal/hub"
+	"github.com/Driemtax/Archaide/internal/message"
+	"github.com/Driemtax/Archaide/internal/server"
+	"github.com/gorilla/websocket"
+)
+
+// Starts a server on an ephemeral port and returns the URL of its WebSocket endpoint
+func startServer(t *testing.T, cfg server.Config) string {
+	t.Helper()
+	srv := httptest.NewServer(server.NewHandler(cfg))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+func TestHealthEndpointsReportRunningHub(t *testing.T) {
+	srv := httptest.NewServer(server.NewHandler(server.DefaultConfig()))
+	defer srv.Close()
+
+	// The hub starts in the background, it is ready with its first heartbeat
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(srv.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("GET /readyz: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/readyz still returns %d", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz returned %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestProtocolSchemaDescribesEveryMessage(t *testing.T) {
+	srv := httptest.NewServer(server.NewHandler(server.DefaultConfig()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/protocol.json")
+	if err != nil {
+		t.Fatalf("GET /protocol.json: %v", err)
+	}
+	defer resp.Body.Close()
+	var protocol struct {
+		Defs map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&protocol); err != nil {
+		t.Fatalf("decoding protocol schema: %v", err)
+	}
+
+	for _, msgType := range []message.MessageType{message.Welcome, message.PongState, message.AsteroidsInput} {
+		if _, ok := protocol.Defs[string(msgType)]; !ok {
+			t.Errorf("protocol schema does not describe %s", msgType)
+		}
+	}
+	// Field names come from the json tags
+	if _, ok := protocol.Defs[string(message.PongState)].Properties["ball_x"]; !ok {
+		t.Errorf("pong_state payload has properties %v, want ball_x", protocol.Defs[string(message.PongState)].Properties)
+	}
+}
+
+func connect(t *testing.T, url string) *client.Client {
+	t.Helper()
+	c, err := client.Connect(url)
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if _, err := c.WaitFor(message.Welcome, time.Second); err != nil {
+		t.Fatalf("waiting for welcome: %v", err)
+	}
+	return c
+}
+
+// Walks through the whole pipeline: register, vote, game start,
+// input, game over and back to the lobby
+func TestTwoClientsCompleteAPongMatch(t *testing.T) {
+	cfg := server.DefaultConfig()
+	// One point ends the match, so the test does not have to play for long
+	cfg.Hub.Games.Pong.TargetScore = 1
+	url := startServer(t, cfg)
+
+	players := []*client.Client{connect(t, url), connect(t, url)}
+	for _, c := range players {
+		if err := c.Send(message.SelectGame, message.SelectGamePayload{Game: pong.GAME_NAME}); err != nil {
+			t.Fatalf("selecting pong: %v", err)
+		}
+	}
+
+	for i, c := range players {
+		if _, err := c.WaitFor(message.GameSelected, time.Second); err != nil {
+			t.Fatalf("player %d: %v", i+1, err)
+		}
+	}
+
+	// Both park their paddle at the top edge, the ball is served through
+	// the middle and the first one to miss loses the match
+	for i, c := range players {
+		if _, err := c.WaitFor(message.PongState, time.Second); err != nil {
+			t.Fatalf("player %d: %v", i+1, err)
+		}
+		if err := c.Send(message.PongInput, pong.PongInputPayload{Direction: "up"}); err != nil {
+			t.Fatalf("player %d sending input: %v", i+1, err)
+		}
+	}
+
+	for i, c := range players {
+		if _, err := c.WaitFor(message.PongGameOver, 30*time.Second); err != nil {
+			t.Fatalf("player %d: %v", i+1, err)
+		}
+		if _, err := c.WaitFor(message.BackToLobby, 5*time.Second); err != nil {
+			t.Fatalf("player %d after game over: %v", i+1, err)
+		}
+	}
+}
+
+func TestMetricsNeedTheAdminToken(t *testing.T) {
+	closed := httptest.NewServer(server.NewHandler(server.DefaultConfig()))
+	defer closed.Close()
+	cfg := server.DefaultConfig()
+	cfg.AdminToken = "secret"
+	srv := httptest.NewServer(server.NewHandler(cfg))
+	defer srv.Close()
+
+	debugVars := func(baseURL, token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/debug/vars", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /debug/vars: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := debugVars(closed.URL, ""); status != http.StatusNotFound {
+		t.Errorf("metrics without an admin token configured got %d, want 404", status)
+	}
+	if status := debugVars(srv.URL, ""); status != http.StatusUnauthorized {
+		t.Errorf("metrics without a token got %d, want 401", status)
+	}
+	if status := debugVars(srv.URL, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("metrics with a wrong token got %d, want 401", status)
+	}
+	if status := debugVars(srv.URL, "secret"); status != http.StatusOK {
+		t.Errorf("metrics with the token got %d, want 200", status)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *server.Config)
+		wantErr bool
+	}{
+		{"defaults", func(cfg *server.Config) {}, false},
+		{"TLS with both files", func(cfg *server.Config) { cfg.TLSCertFile, cfg.TLSKeyFile = "cert.pem", "key.pem" }, false},
+		{"TLS without a key", func(cfg *server.Config) { cfg.TLSCertFile = "cert.pem" }, true},
+		{"TLS without a certificate", func(cfg *server.Config) { cfg.TLSKeyFile = "key.pem" }, true},
+		{"no drain period", func(cfg *server.Config) { cfg.DrainPeriod = 0 }, false},
+		{"negative drain period", func(cfg *server.Config) { cfg.DrainPeriod = -time.Second }, true},
+		{"known game", func(cfg *server.Config) { cfg.Hub.AvailableGames = []string{pong.GAME_NAME} }, false},
+		{"unknown game", func(cfg *server.Config) { cfg.Hub.AvailableGames = []string{"Tetris"} }, true},
+		{"negative score tier size", func(cfg *server.Config) { cfg.Hub.ScoreTierSize = -1 }, true},
+		{"negative lobby snapshot interval", func(cfg *server.Config) { cfg.Hub.LobbySnapshotInterval = -time.Second }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := server.DefaultConfig()
+			tt.change(&cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientSendingGarbageIsDisconnected(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.Hub.MaxParseFailures = 3
+	url := startServer(t, cfg)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	defer conn.Close()
+	for range cfg.Hub.MaxParseFailures {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+			t.Fatalf("sending garbage: %v", err)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	invalid := 0
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("connection ended with %v, want it closed by the server", err)
+			}
+			break
+		}
+		var msg message.Message
+		if json.Unmarshal(data, &msg) == nil && msg.Type == message.Error {
+			invalid++
+		}
+	}
+	if invalid == 0 {
+		t.Error("client got no error for its invalid messages")
+	}
+}
+
+func TestAdminEndpointsNeedTheToken(t *testing.T) {
+	closed := httptest.NewServer(server.NewHandler(server.DefaultConfig()))
+	defer closed.Close()
+	cfg := server.DefaultConfig()
+	cfg.AdminToken = "secret"
+	srv := httptest.NewServer(server.NewHandler(cfg))
+	defer srv.Close()
+
+	capture := func(baseURL, token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, baseURL+"/admin/games/missing/capture", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST capture: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := capture(closed.URL, "secret"); status != http.StatusNotFound {
+		t.Errorf("without an admin token configured got %d, want 404", status)
+	}
+	if status := capture(srv.URL, ""); status != http.StatusUnauthorized {
+		t.Errorf("without a token got %d, want 401", status)
+	}
+	if status := capture(srv.URL, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("with a wrong token got %d, want 401", status)
+	}
+	if status := capture(srv.URL, "secret"); status != http.StatusNotFound {
+		t.Errorf("capturing a missing game got %d, want 404", status)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/admin/stats", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /admin/stats: %v", err)
+	}
+	defer resp.Body.Close()
+	var stats hub.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decoding stats: %v", err)
+	}
+	if stats.StartedAt.IsZero() || stats.GamesPlayed == nil {
+		t.Errorf("got incomplete stats %+v", stats)
+	}
+}
+
+func TestEveryServerKeepsItsOwnCompressionSetting(t *testing.T) {
+	compressed := server.DefaultConfig()
+	compressed.Compression.Enabled = true
+	plain := server.DefaultConfig()
+	plain.Compression.Enabled = false
+	compressedURL := startServer(t, compressed)
+	// Built after the compressed one, it must not turn compression off for it
+	plainURL := startServer(t, plain)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	negotiated := func(url string) bool {
+		t.Helper()
+		conn, resp, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dialing: %v", err)
+		}
+		conn.Close()
+		return strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+	}
+	if !negotiated(compressedURL) {
+		t.Error("server with compression did not negotiate it")
+	}
+	if negotiated(plainURL) {
+		t.Error("server without compression negotiated it")
+	}
+	if server.Upgrader.EnableCompression {
+		t.Error("the default upgrader was changed")
+	}
+}
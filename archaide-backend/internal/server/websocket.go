@@ -10,6 +10,7 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// The defaults every handler copies its upgrader from, it is never changed
 var Upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -20,8 +21,18 @@ var Upgrader = websocket.Upgrader{
 	},
 }
 
-func serveWs(hubInstance *hub.Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := Upgrader.Upgrade(w, r, nil)
+// Copies the default Upgrader for one handler, so two servers in the
+// same process do not overwrite each others settings
+func newUpgrader(compression hub.CompressionConfig) *websocket.Upgrader {
+	upgrader := Upgrader
+	// Compression is negotiated per connection, clients that do not
+	// support it just get uncompressed frames
+	upgrader.EnableCompression = compression.Enabled
+	return &upgrader
+}
+
+func serveWs(hubInstance *hub.Hub, upgrader *websocket.Upgrader, cfg Config, w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
@@ -31,12 +42,16 @@ func serveWs(hubInstance *hub.Hub, w http.ResponseWriter, r *http.Request) {
 	client := &hub.Client{
 		Hub:          hubInstance,
 		Conn:         conn,
-		Send:         make(chan []byte, 256), // Use a buffered channel
+		Send:         make(chan hub.OutgoingMessage, cfg.SendBufferSize), // Use a buffered channel
+		Compression:  cfg.Compression,
 		Id:           uuid.New().String(),
 		Character:    character.GetCharacter(),
 		Score:        0,
 		SelectedGame: "",
+		Spectate:     r.URL.Query().Get("spectate"), // Watch a running game instead of joining the lobby
 	}
+	// A client that dropped out of a game takes over its old identity, so the game takes it back
+	hubInstance.ResumeSession(client, r.URL.Query().Get("session"))
 
 	client.Hub.Register <- client // Use the Register channel from the hub instance
 